@@ -4,6 +4,7 @@ package auth
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/google/go-github/github"
 	"github.com/parkr/auto-reply/ctx"
@@ -21,17 +22,50 @@ type authenticator struct {
 }
 
 func CommenterHasPushAccess(context *ctx.Context, event github.IssueCommentEvent) bool {
+	return UserHasPushAccess(context, *event.Repo.Owner.Login, *event.Repo.Name, *event.Comment.User.Login)
+}
+
+// UserHasPushAccess returns true if the user is a member of a team in the
+// owner's org which has push or admin access to the repo.
+func UserHasPushAccess(context *ctx.Context, owner, repo, login string) bool {
 	auth := authenticator{context: context}
-	orgTeams := auth.teamsForOrg(*event.Repo.Owner.Login)
+	orgTeams := auth.teamsForOrg(owner)
 	for _, team := range orgTeams {
-		if auth.isTeamMember(*team.ID, *event.Comment.User.Login) &&
-			auth.teamHasPushAccess(*team.ID, *event.Repo.Owner.Login, *event.Repo.Name) {
+		if auth.isTeamMember(*team.ID, login) &&
+			auth.teamHasPushAccess(*team.ID, owner, repo) {
 			return true
 		}
 	}
 	return false
 }
 
+// UserHasTriageAccess returns true if the user is a member of a team in the
+// owner's org which has at least triage access to the repo, e.g. to label
+// issues. Read-only access isn't enough.
+func UserHasTriageAccess(context *ctx.Context, owner, repo, login string) bool {
+	auth := authenticator{context: context}
+	orgTeams := auth.teamsForOrg(owner)
+	for _, team := range orgTeams {
+		if auth.isTeamMember(*team.ID, login) &&
+			auth.teamHasTriageAccess(*team.ID, owner, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserIsTeamMember returns true if the user is a member of the team with the
+// given slug in the org.
+func UserIsTeamMember(context *ctx.Context, org, teamSlug, login string) bool {
+	auth := authenticator{context: context}
+	for _, team := range auth.teamsForOrg(org) {
+		if strings.EqualFold(team.GetSlug(), teamSlug) {
+			return auth.isTeamMember(*team.ID, login)
+		}
+	}
+	return false
+}
+
 func UserIsOrgOwner(context *ctx.Context, org, login string) bool {
 	auth := authenticator{context: context}
 	for _, owner := range auth.ownersForOrg(org) {
@@ -57,6 +91,24 @@ func (auth authenticator) isTeamMember(teamId int64, login string) bool {
 }
 
 func (auth authenticator) teamHasPushAccess(teamId int64, owner, repo string) bool {
+	if !auth.teamHasAccess(teamId, owner, repo) {
+		return false
+	}
+	permissions := *teamHasPushAccessCache[auth.cacheKeyTeamHashPushAccess(teamId, owner, repo)].Permissions
+	return permissions["push"] || permissions["admin"]
+}
+
+func (auth authenticator) teamHasTriageAccess(teamId int64, owner, repo string) bool {
+	if !auth.teamHasAccess(teamId, owner, repo) {
+		return false
+	}
+	permissions := *teamHasPushAccessCache[auth.cacheKeyTeamHashPushAccess(teamId, owner, repo)].Permissions
+	return permissions["triage"] || permissions["maintain"] || permissions["push"] || permissions["admin"]
+}
+
+// teamHasAccess returns true if the team has any access to the repo. It
+// caches the team's repository so its permissions can be checked.
+func (auth authenticator) teamHasAccess(teamId int64, owner, repo string) bool {
 	cacheKey := auth.cacheKeyTeamHashPushAccess(teamId, owner, repo)
 	if _, ok := teamHasPushAccessCache[cacheKey]; !ok {
 		repository, _, err := auth.context.GitHub.Teams.IsTeamRepo(
@@ -65,27 +117,31 @@ func (auth authenticator) teamHasPushAccess(teamId int64, owner, repo string) bo
 			log.Printf("ERROR performing IsTeamRepo(%d, \"%s\", \"%s\"): %v", teamId, owner, repo, err)
 			return false
 		}
-		if repository == nil {
+		if repository == nil || repository.Permissions == nil {
 			return false
 		}
 		teamHasPushAccessCache[cacheKey] = repository
 	}
-	permissions := *teamHasPushAccessCache[cacheKey].Permissions
-	return permissions["push"] || permissions["admin"]
+	return true
 }
 
 func (auth authenticator) teamsForOrg(org string) []*github.Team {
 	if _, ok := teamsCache[org]; !ok {
-		teamz, _, err := auth.context.GitHub.Teams.ListTeams(
-			auth.context.Context(),
-			org,
-			&github.ListOptions{Page: 0, PerPage: 100},
-		)
-		if err != nil {
-			log.Printf("ERROR performing ListTeams(\"%s\"): %v", org, err)
-			return nil
+		allTeams := []*github.Team{}
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			teamz, resp, err := auth.context.GitHub.Teams.ListTeams(auth.context.Context(), org, opts)
+			if err != nil {
+				log.Printf("ERROR performing ListTeams(\"%s\"): %v", org, err)
+				return nil
+			}
+			allTeams = append(allTeams, teamz...)
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
 		}
-		teamsCache[org] = teamz
+		teamsCache[org] = allTeams
 	}
 	return teamsCache[org]
 }
@@ -0,0 +1,160 @@
+// backport recreates merged pull requests on other branches, e.g. to bring a
+// fix to 3.x-stable, and opens pull requests for them.
+package backport
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/commands"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// Command backports a merged PR with "@jekyllbot: backport 3.x-stable".
+var Command = &commands.Command{
+	Name:            "backport",
+	Usage:           "backport <branch>",
+	Description:     "Opens a pull request which cherry-picks this merged pull request's commits onto the branch, e.g. `3.x-stable`.",
+	Permission:      commands.Push,
+	PullRequestOnly: true,
+	Run:             runBackport,
+}
+
+func runBackport(context *ctx.Context, invocation *commands.Invocation) error {
+	fields := strings.Fields(invocation.Args)
+	if len(fields) != 1 {
+		return fmt.Errorf("tell me which branch to backport to, e.g. `@%s: backport 3.x-stable`", invocation.Bot)
+	}
+	target := fields[0]
+
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), invocation.Owner, invocation.Repo, invocation.Number)
+	if err != nil {
+		return err
+	}
+	if !pr.GetMerged() {
+		return fmt.Errorf("only merged pull requests can be backported")
+	}
+	if pr.GetBase().GetRef() == target {
+		return fmt.Errorf("this was merged into `%s` already", target)
+	}
+
+	backport, err := Backport(context, invocation.Owner, invocation.Repo, pr, target)
+	if err != nil {
+		return err
+	}
+	return invocation.Reply(context, fmt.Sprintf("I opened #%d to backport this to `%s`.", backport.GetNumber(), target))
+}
+
+// Backport cherry-picks the PR's commits onto a new branch off the target
+// and opens a PR to merge it. If a commit conflicts, the branch is deleted
+// and the returned error explains how to backport it by hand.
+func Backport(context *ctx.Context, owner, repo string, pr *github.PullRequest, target string) (*github.PullRequest, error) {
+	number := pr.GetNumber()
+	branch := fmt.Sprintf("backport-%d-to-%s", number, target)
+	backport, err := portPR(context, owner, repo, pr, target, branch, &github.NewPullRequest{
+		Title: github.String(fmt.Sprintf("Backport #%d to %s", number, target)),
+		Body: github.String(fmt.Sprintf(
+			"This backports #%d, %s, to `%s`.\n\nOriginal pull request: %s",
+			number, pr.GetTitle(), target, pr.GetHTMLURL())),
+	})
+	switch err := err.(type) {
+	case nil:
+		return backport, nil
+	case conflictError:
+		return nil, fmt.Errorf("%s doesn't apply cleanly to `%s`, so this needs to be done by hand:\n\n%s",
+			shortSHA(err.commit.GetSHA()), target, manualInstructions(target, branch, err.commits))
+	default:
+		if err == errAlreadyApplied {
+			return nil, fmt.Errorf("its changes are already in `%s`", target)
+		}
+		return nil, err
+	}
+}
+
+// manualInstructions explain how to port the commits by hand.
+func manualInstructions(target, branch string, commits []*github.RepositoryCommit) string {
+	return fmt.Sprintf("```\ngit checkout -b %s origin/%s\ngit cherry-pick -x %s\n```\n\n"+
+		"Resolve the conflicts, then push the branch and open a pull request.",
+		branch, target, commitSHAs(commits))
+}
+
+// portPR recreates the PR's commits on a new branch off the target and opens
+// a PR from it with the given title and body. If the commits conflict or
+// are already on the target, the branch is deleted and a conflictError or
+// errAlreadyApplied returned.
+func portPR(context *ctx.Context, owner, repo string, pr *github.PullRequest, target, branch string, newPR *github.NewPullRequest) (*github.PullRequest, error) {
+	targetRef, resp, err := context.GitHub.Git.GetRef(context.Context(), owner, repo, "heads/"+target)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("there's no `%s` branch", target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	base := targetRef.GetObject().GetSHA()
+
+	commits, err := listCommits(context, owner, repo, pr.GetNumber())
+	if err != nil {
+		return nil, err
+	}
+
+	_, resp, err = context.GitHub.Git.CreateRef(context.Context(), owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(base)},
+	})
+	if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil, fmt.Errorf("the `%s` branch already exists", branch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := cherryPick(context, owner, repo, branch, base, commits)
+	if err == nil && head == base {
+		err = errAlreadyApplied
+	}
+	if err != nil {
+		if _, deleteErr := context.GitHub.Git.DeleteRef(context.Context(), owner, repo, "heads/"+branch); deleteErr != nil {
+			context.Log("backport: couldn't delete %s on %s/%s: %v", branch, owner, repo, deleteErr)
+		}
+		if conflict, ok := err.(conflictError); ok {
+			conflict.commits = commits
+			return nil, conflict
+		}
+		return nil, err
+	}
+
+	newPR.Head = github.String(branch)
+	newPR.Base = github.String(target)
+	created, _, err := context.GitHub.PullRequests.Create(context.Context(), owner, repo, newPR)
+	return created, err
+}
+
+func listCommits(context *ctx.Context, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	allCommits := []*github.RepositoryCommit{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		commits, resp, err := context.GitHub.PullRequests.ListCommits(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		allCommits = append(allCommits, commits...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allCommits, nil
+}
+
+// commitSHAs lists the SHAs of the commits which can be cherry-picked.
+func commitSHAs(commits []*github.RepositoryCommit) string {
+	shas := []string{}
+	for _, commit := range commits {
+		if len(commit.Parents) == 1 {
+			shas = append(shas, commit.GetSHA())
+		}
+	}
+	return strings.Join(shas, " ")
+}
@@ -0,0 +1,167 @@
+package backport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRepo records what porting PR #5 from o/r onto the target branch does.
+// PR #5 has one commit, c1, and a merge commit which should be skipped.
+type fakeRepo struct {
+	target, branch string
+	conflict       bool
+
+	commits []*github.Commit
+	refs    []string
+	deleted []string
+	newPR   *github.NewPullRequest
+	issue   *github.IssueRequest
+	labels  []string
+}
+
+func (f *fakeRepo) serve(t *testing.T) (*ctx.Context, func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/git/refs/heads/"+f.target, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"ref": "refs/heads/%s", "object": {"sha": "base"}}`, f.target)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/5/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"sha": "c1", "parents": [{"sha": "p1"}], "commit": {"message": "Fix it", "author": {"name": "Parker", "email": "parker@example.com"}}},
+			{"sha": "m1", "parents": [{"sha": "c1"}, {"sha": "master"}], "commit": {"message": "Merge master"}}
+		]`)
+	})
+	mux.HandleFunc("/repos/o/r/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		v := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&v)
+		f.refs = append(f.refs, fmt.Sprintf("%s@%s", v["ref"], v["sha"]))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/refs/heads/"+f.branch, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PATCH":
+			v := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&v)
+			f.refs = append(f.refs, fmt.Sprintf("%s@%s", f.branch, v["sha"]))
+			fmt.Fprint(w, `{}`)
+		case "DELETE":
+			f.deleted = append(f.deleted, f.branch)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/git/commits/base", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "base", "tree": {"sha": "base-tree"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		v := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&v)
+		parents := []string{}
+		for _, parent := range v["parents"].([]interface{}) {
+			parents = append(parents, parent.(string))
+		}
+		commit := &github.Commit{
+			SHA:     github.String(fmt.Sprintf("new%d", len(f.commits)+1)),
+			Message: github.String(v["message"].(string)),
+			Tree:    &github.Tree{SHA: github.String(v["tree"].(string))},
+		}
+		for _, parent := range parents {
+			commit.Parents = append(commit.Parents, github.Commit{SHA: github.String(parent)})
+		}
+		f.commits = append(f.commits, commit)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(commit)
+	})
+	mux.HandleFunc("/repos/o/r/merges", func(w http.ResponseWriter, r *http.Request) {
+		if f.conflict {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"message": "Merge conflict"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha": "merged", "commit": {"tree": {"sha": "picked-tree"}}}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		f.newPR = new(github.NewPullRequest)
+		json.NewDecoder(r.Body).Decode(f.newPR)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"number": 9}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+		f.issue = new(github.IssueRequest)
+		json.NewDecoder(r.Body).Decode(f.issue)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"number": 10}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/9/labels", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&f.labels)
+		fmt.Fprint(w, `[]`)
+	})
+	server := httptest.NewServer(mux)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return &ctx.Context{GitHub: client}, server.Close
+}
+
+var mergedPR = &github.PullRequest{
+	Number:  github.Int(5),
+	Base:    &github.PullRequestBranch{Ref: github.String("3.x-stable")},
+	Title:   github.String("Fix it"),
+	HTMLURL: github.String("https://github.com/o/r/pull/5"),
+	Merged:  github.Bool(true),
+}
+
+func TestBackport(t *testing.T) {
+	repo := &fakeRepo{target: "3.x-stable", branch: "backport-5-to-3.x-stable"}
+	context, teardown := repo.serve(t)
+	defer teardown()
+
+	backport, err := Backport(context, "o", "r", mergedPR, "3.x-stable")
+	assert.NoError(t, err)
+	assert.Equal(t, 9, backport.GetNumber())
+
+	if assert.Len(t, repo.commits, 2) {
+		// The temporary commit has the target's tree on the commit's parent.
+		assert.Equal(t, "base-tree", repo.commits[0].GetTree().GetSHA())
+		assert.Equal(t, "p1", repo.commits[0].Parents[0].GetSHA())
+		// The cherry-picked commit has the merged tree on the target.
+		assert.Equal(t, "picked-tree", repo.commits[1].GetTree().GetSHA())
+		assert.Equal(t, "base", repo.commits[1].Parents[0].GetSHA())
+		assert.Equal(t, "Fix it\n\n(cherry picked from commit c1)", repo.commits[1].GetMessage())
+	}
+	assert.Equal(t, []string{
+		"refs/heads/backport-5-to-3.x-stable@base",
+		"backport-5-to-3.x-stable@new1",
+		"backport-5-to-3.x-stable@new2",
+	}, repo.refs)
+	assert.Empty(t, repo.deleted)
+
+	if assert.NotNil(t, repo.newPR) {
+		assert.Equal(t, "Backport #5 to 3.x-stable", repo.newPR.GetTitle())
+		assert.Equal(t, "backport-5-to-3.x-stable", repo.newPR.GetHead())
+		assert.Equal(t, "3.x-stable", repo.newPR.GetBase())
+		assert.Contains(t, repo.newPR.GetBody(), "https://github.com/o/r/pull/5")
+	}
+}
+
+func TestBackportConflict(t *testing.T) {
+	repo := &fakeRepo{target: "3.x-stable", branch: "backport-5-to-3.x-stable", conflict: true}
+	context, teardown := repo.serve(t)
+	defer teardown()
+
+	_, err := Backport(context, "o", "r", mergedPR, "3.x-stable")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "c1 doesn't apply cleanly to `3.x-stable`")
+		assert.Contains(t, err.Error(), "git cherry-pick -x c1\n")
+	}
+	assert.Equal(t, []string{"backport-5-to-3.x-stable"}, repo.deleted)
+	assert.Nil(t, repo.newPR)
+}
@@ -0,0 +1,109 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// errAlreadyApplied is returned when none of the commits change the branch.
+var errAlreadyApplied = errors.New("the changes are already applied")
+
+// conflictError is returned when a commit can't be applied cleanly.
+type conflictError struct {
+	commit *github.RepositoryCommit
+	// commits are all of the commits being applied.
+	commits []*github.RepositoryCommit
+}
+
+func (e conflictError) Error() string {
+	return fmt.Sprintf("%s conflicts", shortSHA(e.commit.GetSHA()))
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// cherryPick applies each commit on top of the branch, which must exist and
+// point at head, returning the branch's new head. Merge commits are skipped,
+// as are commits whose changes are already on the branch.
+//
+// There's no API for cherry-picking, so each commit is applied with the
+// merges API: the branch is pointed at a temporary commit with the branch's
+// tree and the commit's parent, then the commit is merged in. Only the
+// commit's own changes differ from the merge base, so the merged tree is the
+// branch with the commit applied, which is then committed on the real head.
+func cherryPick(context *ctx.Context, owner, repo, branch, head string, commits []*github.RepositoryCommit) (string, error) {
+	for _, commit := range commits {
+		if len(commit.Parents) != 1 {
+			continue
+		}
+
+		headCommit, _, err := context.GitHub.Git.GetCommit(context.Context(), owner, repo, head)
+		if err != nil {
+			return "", err
+		}
+
+		temp, _, err := context.GitHub.Git.CreateCommit(context.Context(), owner, repo, &github.Commit{
+			Message: github.String("Temporary commit for cherry-picking " + commit.GetSHA()),
+			Tree:    &github.Tree{SHA: headCommit.GetTree().SHA},
+			Parents: []github.Commit{{SHA: commit.Parents[0].SHA}},
+		})
+		if err != nil {
+			return "", err
+		}
+		if err := setBranch(context, owner, repo, branch, temp.GetSHA()); err != nil {
+			return "", err
+		}
+
+		merged, resp, err := context.GitHub.Repositories.Merge(context.Context(), owner, repo, &github.RepositoryMergeRequest{
+			Base:          github.String(branch),
+			Head:          github.String(commit.GetSHA()),
+			CommitMessage: github.String("Cherry-pick " + commit.GetSHA()),
+		})
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			setBranch(context, owner, repo, branch, head)
+			return "", conflictError{commit: commit}
+		}
+		if err != nil {
+			return "", err
+		}
+		if merged == nil || merged.GetCommit().GetTree().GetSHA() == headCommit.GetTree().GetSHA() {
+			// Nothing changed: the changes are already on the branch.
+			if err := setBranch(context, owner, repo, branch, head); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		picked, _, err := context.GitHub.Git.CreateCommit(context.Context(), owner, repo, &github.Commit{
+			Message: github.String(fmt.Sprintf("%s\n\n(cherry picked from commit %s)", commit.GetCommit().GetMessage(), commit.GetSHA())),
+			Tree:    &github.Tree{SHA: merged.GetCommit().GetTree().SHA},
+			Parents: []github.Commit{{SHA: github.String(head)}},
+			Author:  commit.GetCommit().Author,
+		})
+		if err != nil {
+			return "", err
+		}
+		if err := setBranch(context, owner, repo, branch, picked.GetSHA()); err != nil {
+			return "", err
+		}
+		head = picked.GetSHA()
+	}
+	return head, nil
+}
+
+// setBranch forces the branch to point at the SHA.
+func setBranch(context *ctx.Context, owner, repo, branch, sha string) error {
+	_, _, err := context.GitHub.Git.UpdateRef(context.Context(), owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}, true)
+	return err
+}
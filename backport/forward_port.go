@@ -0,0 +1,129 @@
+package backport
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var (
+	// forwardPortLabel marks forward-port PRs and issues. chlog files PRs
+	// with it under "Forward Ports".
+	forwardPortLabel = "forward-port"
+
+	// defaultForwardPortPattern matches the branches forward-ported from in
+	// repos without their own pattern.
+	defaultForwardPortPattern = "*-stable"
+
+	forwardPortPatterns = map[string]string{}
+)
+
+// SetForwardPortPattern sets the pattern, e.g. "*-stable", matching the
+// branches of the repo whose PRs are forward-ported to the default branch.
+// An empty pattern turns forward-porting off.
+func SetForwardPortPattern(owner, repo, pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("backport.SetForwardPortPattern: invalid pattern %q for %s/%s: %v", pattern, owner, repo, err)
+	}
+	forwardPortPatterns[owner+"/"+repo] = pattern
+	return nil
+}
+
+func forwardPortPatternFor(owner, repo string) string {
+	if pattern, ok := forwardPortPatterns[owner+"/"+repo]; ok {
+		return pattern
+	}
+	return defaultForwardPortPattern
+}
+
+// isForwardPortable returns true if PRs merged into the branch should be
+// forward-ported.
+func isForwardPortable(owner, repo, branch string) bool {
+	pattern := forwardPortPatternFor(owner, repo)
+	if pattern == "" {
+		return false
+	}
+	matched, _ := path.Match(pattern, branch)
+	return matched
+}
+
+// ForwardPortOnMerge forward-ports PRs merged into a stable branch to the
+// default branch. It opens a PR with the changes if they aren't already
+// there, or an issue if they don't apply cleanly.
+func ForwardPortOnMerge(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PullRequestEvent)
+	if !ok {
+		return context.NewError("backport.ForwardPortOnMerge: not a pull request event")
+	}
+
+	pr := event.GetPullRequest()
+	if event.GetAction() != "closed" || !pr.GetMerged() {
+		return nil
+	}
+
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	if !isForwardPortable(owner, repo, pr.GetBase().GetRef()) {
+		return nil
+	}
+
+	// Backports already came from the default branch.
+	if strings.HasPrefix(pr.GetHead().GetRef(), "backport-") {
+		return nil
+	}
+
+	target := event.GetRepo().GetDefaultBranch()
+	if target == "" {
+		target = "master"
+	}
+
+	forwardPort, err := ForwardPort(context, owner, repo, pr, target)
+	if err != nil {
+		return context.NewError("backport.ForwardPortOnMerge: couldn't forward-port %s/%s#%d: %v", owner, repo, pr.GetNumber(), err)
+	}
+	if forwardPort != 0 {
+		context.Log("backport.ForwardPortOnMerge: opened %s/%s#%d to forward-port #%d", owner, repo, forwardPort, pr.GetNumber())
+	}
+	return nil
+}
+
+// ForwardPort opens a PR, labeled forward-port, which applies the PR's
+// commits to the target. If they don't apply cleanly, it opens an issue
+// instead, and if they're already on the target, it does nothing. It returns
+// the number of the PR or issue opened, if any.
+func ForwardPort(context *ctx.Context, owner, repo string, pr *github.PullRequest, target string) (int, error) {
+	number := pr.GetNumber()
+	branch := fmt.Sprintf("forward-port-%d-to-%s", number, target)
+	title := fmt.Sprintf("Forward-port #%d to %s", number, target)
+	forwardPort, err := portPR(context, owner, repo, pr, target, branch, &github.NewPullRequest{
+		Title: github.String(title),
+		Body: github.String(fmt.Sprintf(
+			"This forward-ports #%d, %s, from `%s` to `%s`.\n\nOriginal pull request: %s",
+			number, pr.GetTitle(), pr.GetBase().GetRef(), target, pr.GetHTMLURL())),
+	})
+
+	if err == errAlreadyApplied {
+		return 0, nil
+	}
+	if conflict, ok := err.(conflictError); ok {
+		issue, _, err := context.GitHub.Issues.Create(context.Context(), owner, repo, &github.IssueRequest{
+			Title:  github.String(title),
+			Labels: &[]string{forwardPortLabel},
+			Body: github.String(fmt.Sprintf(
+				"#%d, %s, was merged into `%s`, but %s doesn't apply cleanly to `%s`, so it needs to be forward-ported by hand:\n\n%s",
+				number, pr.GetTitle(), pr.GetBase().GetRef(), shortSHA(conflict.commit.GetSHA()), target,
+				manualInstructions(target, branch, conflict.commits))),
+		})
+		return issue.GetNumber(), err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, _, err := context.GitHub.Issues.AddLabelsToIssue(context.Context(), owner, repo, forwardPort.GetNumber(), []string{forwardPortLabel}); err != nil {
+		context.Log("backport.ForwardPort: couldn't label %s/%s#%d: %v", owner, repo, forwardPort.GetNumber(), err)
+	}
+	return forwardPort.GetNumber(), nil
+}
@@ -0,0 +1,76 @@
+package backport
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsForwardPortable(t *testing.T) {
+	defer delete(forwardPortPatterns, "o/r")
+
+	assert.True(t, isForwardPortable("o", "r", "3.x-stable"))
+	assert.False(t, isForwardPortable("o", "r", "master"))
+
+	assert.Error(t, SetForwardPortPattern("o", "r", "[stable"))
+
+	assert.NoError(t, SetForwardPortPattern("o", "r", "v*"))
+	assert.True(t, isForwardPortable("o", "r", "v3"))
+	assert.False(t, isForwardPortable("o", "r", "3.x-stable"))
+
+	assert.NoError(t, SetForwardPortPattern("o", "r", ""))
+	assert.False(t, isForwardPortable("o", "r", "3.x-stable"))
+}
+
+func TestForwardPort(t *testing.T) {
+	repo := &fakeRepo{target: "master", branch: "forward-port-5-to-master"}
+	context, teardown := repo.serve(t)
+	defer teardown()
+
+	number, err := ForwardPort(context, "o", "r", mergedPR, "master")
+	assert.NoError(t, err)
+	assert.Equal(t, 9, number)
+	if assert.NotNil(t, repo.newPR) {
+		assert.Equal(t, "Forward-port #5 to master", repo.newPR.GetTitle())
+		assert.Equal(t, "forward-port-5-to-master", repo.newPR.GetHead())
+		assert.Contains(t, repo.newPR.GetBody(), "from `3.x-stable` to `master`")
+	}
+	assert.Equal(t, []string{"forward-port"}, repo.labels)
+	assert.Nil(t, repo.issue)
+}
+
+func TestForwardPortConflict(t *testing.T) {
+	repo := &fakeRepo{target: "master", branch: "forward-port-5-to-master", conflict: true}
+	context, teardown := repo.serve(t)
+	defer teardown()
+
+	number, err := ForwardPort(context, "o", "r", mergedPR, "master")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, number)
+	assert.Nil(t, repo.newPR)
+	assert.Equal(t, []string{"forward-port-5-to-master"}, repo.deleted)
+	if assert.NotNil(t, repo.issue) {
+		assert.Equal(t, "Forward-port #5 to master", repo.issue.GetTitle())
+		assert.Equal(t, []string{"forward-port"}, *repo.issue.Labels)
+		assert.Contains(t, repo.issue.GetBody(), "c1 doesn't apply cleanly to `master`")
+	}
+}
+
+func TestForwardPortOnMergeIgnoresOtherBranches(t *testing.T) {
+	event := &github.PullRequestEvent{
+		Action: github.String("closed"),
+		Repo:   &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+		PullRequest: &github.PullRequest{
+			Merged: github.Bool(true),
+			Base:   &github.PullRequestBranch{Ref: github.String("master")},
+			Head:   &github.PullRequestBranch{Ref: github.String("fix")},
+		},
+	}
+	// No requests are made, so there's no server.
+	assert.NoError(t, ForwardPortOnMerge(nil, event))
+
+	event.PullRequest.Base.Ref = github.String("3.x-stable")
+	event.PullRequest.Head.Ref = github.String("backport-4-to-3.x-stable")
+	assert.NoError(t, ForwardPortOnMerge(nil, event))
+}
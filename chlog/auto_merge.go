@@ -0,0 +1,410 @@
+package chlog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/auth"
+	"github.com/parkr/auto-reply/commands"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var (
+	// mergeCommands finds merge commands addressed to any bot in the
+	// comments of PRs whose auto-merge request was forgotten.
+	mergeCommands *commands.Registry
+
+	// autoMergeLabel marks PRs which should be merged once they're green.
+	// Maintainers can add it directly instead of commenting.
+	autoMergeLabel = "auto-merge"
+
+	pendingAutoMerges = autoMergeMap{data: make(map[string]*autoMerge)}
+)
+
+// autoMerge is a request to merge a PR once its statuses and checks pass.
+type autoMerge struct {
+	changeSectionLabel string
+	method             string
+	requester          string
+}
+
+type autoMergeMap struct {
+	sync.Mutex // protects 'data'
+	data       map[string]*autoMerge
+}
+
+func (m *autoMergeMap) get(ref string) *autoMerge {
+	m.Lock()
+	defer m.Unlock()
+	return m.data[ref]
+}
+
+func (m *autoMergeMap) set(ref string, request *autoMerge) {
+	m.Lock()
+	m.data[ref] = request
+	m.Unlock()
+}
+
+func (m *autoMergeMap) delete(ref string) {
+	m.Lock()
+	delete(m.data, ref)
+	m.Unlock()
+}
+
+func prRefString(owner, repo string, number int) string {
+	return fmt.Sprintf("%s/%s#%d", owner, repo, number)
+}
+
+// MergeCommand's Run leads back here, so it's registered once the package
+// is initialized.
+func init() {
+	mergeCommands = commands.NewRegistry("")
+	if err := mergeCommands.Register(MergeCommand); err != nil {
+		panic(err)
+	}
+}
+
+// parseAutoMergeRequestComment parses "@jekyllbot: merge when ready +bug" as
+// the merge command does.
+func parseAutoMergeRequestComment(commentBody string, categories []ChangelogCategory) (bool, mergeRequest) {
+	command, args := mergeCommands.Parse(commentBody)
+	if command == nil || command.Name != mergeCommandName {
+		return false, mergeRequest{}
+	}
+
+	request, err := parseMergeArgs(args, categories)
+	if err != nil || !request.autoMerge {
+		return false, mergeRequest{}
+	}
+	return true, request
+}
+
+func changeSectionLabelFor(labelFromComment string, categories []ChangelogCategory) string {
+	if labelFromComment == "" {
+		return "none"
+	}
+	return sectionForLabel(labelFromComment, categories)
+}
+
+// requestAutoMerge labels the PR auto-merge so it's merged once everything
+// is green, which might be right away.
+func requestAutoMerge(context *ctx.Context, owner, repo string, number int, requester, changeSectionLabel, method string) error {
+	ref := prRefString(owner, repo, number)
+
+	pendingAutoMerges.set(ref, &autoMerge{
+		changeSectionLabel: changeSectionLabel,
+		method:             method,
+		requester:          requester,
+	})
+
+	if _, _, err := context.GitHub.Issues.AddLabelsToIssue(context.Context(), owner, repo, number, []string{autoMergeLabel}); err != nil {
+		return context.NewError("chlog.requestAutoMerge: couldn't label %s: %v", ref, err)
+	}
+
+	return attemptAutoMerge(context, owner, repo, number)
+}
+
+// AutoMergeOnStatus attempts to merge the auto-merge PRs whose head just got
+// a successful status.
+func AutoMergeOnStatus(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.StatusEvent)
+	if !ok {
+		return context.NewError("AutoMergeOnStatus: not a status event")
+	}
+
+	if event.GetState() != "success" {
+		return nil
+	}
+
+	owner, repo := *event.Repo.Owner.Login, *event.Repo.Name
+	numbers, err := autoMergePRsForSHA(context, owner, repo, event.GetSHA())
+	if err != nil {
+		return context.NewError("AutoMergeOnStatus: couldn't find PRs for %s on %s/%s: %v", event.GetSHA(), owner, repo, err)
+	}
+
+	for _, number := range numbers {
+		if err := attemptAutoMerge(context, owner, repo, number); err != nil {
+			context.Log("AutoMergeOnStatus: %v", err)
+		}
+	}
+	return nil
+}
+
+// AutoMergeOnCheckSuite attempts to merge the PRs of a completed check suite.
+func AutoMergeOnCheckSuite(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.CheckSuiteEvent)
+	if !ok {
+		return context.NewError("AutoMergeOnCheckSuite: not a check suite event")
+	}
+
+	if event.GetAction() != "completed" {
+		return nil
+	}
+
+	owner, repo := *event.Repo.Owner.Login, *event.Repo.Name
+	for _, pr := range event.GetCheckSuite().PullRequests {
+		if err := attemptAutoMerge(context, owner, repo, pr.GetNumber()); err != nil {
+			context.Log("AutoMergeOnCheckSuite: %v", err)
+		}
+	}
+	return nil
+}
+
+// AutoMergeOnPullRequest attempts the merge when someone who can merge adds
+// the auto-merge label, forgets the request when it's removed, and cancels it
+// when new commits are pushed. The label is removed again if it was added by
+// someone who can't merge, e.g. with triage access.
+func AutoMergeOnPullRequest(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PullRequestEvent)
+	if !ok {
+		return context.NewError("AutoMergeOnPullRequest: not a pull request event")
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Number
+	ref := prRefString(owner, repo, number)
+
+	switch event.GetAction() {
+	case "labeled":
+		if event.GetLabel().GetName() != autoMergeLabel {
+			return nil
+		}
+		sender := event.GetSender().GetLogin()
+		if context.GitHubAuthedAs(sender) {
+			// requestAutoMerge added it and has already attempted the merge.
+			return nil
+		}
+		if !auth.UserHasPushAccess(context, owner, repo, sender) {
+			context.Log("AutoMergeOnPullRequest: @%s can't merge %s, removing the %s label", sender, ref, autoMergeLabel)
+			if _, err := context.GitHub.Issues.RemoveLabelForIssue(context.Context(), owner, repo, number, autoMergeLabel); err != nil {
+				return context.NewError("AutoMergeOnPullRequest: couldn't remove %s label from %s: %v", autoMergeLabel, ref, err)
+			}
+			return nil
+		}
+		return attemptAutoMerge(context, owner, repo, number)
+	case "unlabeled":
+		if event.GetLabel().GetName() == autoMergeLabel {
+			pendingAutoMerges.delete(ref)
+		}
+	case "closed":
+		pendingAutoMerges.delete(ref)
+		dequeueMerge(context, owner, repo, number, "it was closed")
+	case "synchronize":
+		if queued, ok := mergeQueues.get(owner, repo).find(number); ok && queued.sha == event.GetPullRequest().GetHead().GetSHA() {
+			// The merge queue updated the branch.
+			return nil
+		}
+		dequeueMerge(context, owner, repo, number, "new commits were pushed")
+		if isAutoMergePending(context, owner, repo, number, event.PullRequest) {
+			return cancelAutoMerge(context, owner, repo, number, "new commits were pushed")
+		}
+	}
+	return nil
+}
+
+// CancelAutoMergeOnReview cancels a pending auto-merge when a reviewer
+// requests changes.
+func CancelAutoMergeOnReview(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PullRequestReviewEvent)
+	if !ok {
+		return context.NewError("CancelAutoMergeOnReview: not a pull request review event")
+	}
+
+	if !strings.EqualFold(event.GetReview().GetState(), "changes_requested") {
+		return nil
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, event.GetPullRequest().GetNumber()
+	if !isAutoMergePending(context, owner, repo, number, event.PullRequest) {
+		return nil
+	}
+	return cancelAutoMerge(context, owner, repo, number,
+		fmt.Sprintf("@%s requested changes", event.GetReview().GetUser().GetLogin()))
+}
+
+func isAutoMergePending(context *ctx.Context, owner, repo string, number int, pr *github.PullRequest) bool {
+	if pendingAutoMerges.get(prRefString(owner, repo, number)) != nil {
+		return true
+	}
+	if pr != nil && pr.Labels != nil {
+		return hasLabel(pr.Labels, autoMergeLabel)
+	}
+	labels, _, err := context.GitHub.Issues.ListLabelsByIssue(context.Context(), owner, repo, number, nil)
+	if err != nil {
+		context.Log("chlog: couldn't list labels for %s: %v", prRefString(owner, repo, number), err)
+		return false
+	}
+	return hasLabel(labels, autoMergeLabel)
+}
+
+func hasLabel(labels []*github.Label, name string) bool {
+	for _, label := range labels {
+		if label.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func cancelAutoMerge(context *ctx.Context, owner, repo string, number int, reason string) error {
+	ref := prRefString(owner, repo, number)
+	pendingAutoMerges.delete(ref)
+
+	if _, err := context.GitHub.Issues.RemoveLabelForIssue(context.Context(), owner, repo, number, autoMergeLabel); err != nil {
+		context.Log("chlog: couldn't remove %s label from %s: %v", autoMergeLabel, ref, err)
+	}
+
+	_, _, err := context.GitHub.Issues.CreateComment(context.Context(), owner, repo, number, &github.IssueComment{
+		Body: github.String(fmt.Sprintf("I cancelled the auto-merge of this PR because %s. Ask me again once it's ready.", reason)),
+	})
+	if err != nil {
+		return context.NewError("chlog: couldn't comment on cancelled auto-merge of %s: %v", ref, err)
+	}
+	return nil
+}
+
+// autoMergePRsForSHA finds the open auto-merge PRs whose head is the SHA.
+func autoMergePRsForSHA(context *ctx.Context, owner, repo, sha string) ([]int, error) {
+	query := fmt.Sprintf("%s repo:%s/%s is:pr is:open label:%s", sha, owner, repo, autoMergeLabel)
+	result, _, err := context.GitHub.Search.Issues(context.Context(), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	numbers := []int{}
+	for _, issue := range result.Issues {
+		numbers = append(numbers, issue.GetNumber())
+	}
+	return numbers, nil
+}
+
+// attemptAutoMerge queues the PR to be merged if auto-merge was requested
+// and everything is green.
+func attemptAutoMerge(context *ctx.Context, owner, repo string, number int) error {
+	ref := prRefString(owner, repo, number)
+
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), owner, repo, number)
+	if err != nil {
+		return context.NewError("chlog.attemptAutoMerge: couldn't get %s: %v", ref, err)
+	}
+
+	if pr.GetState() != "open" {
+		pendingAutoMerges.delete(ref)
+		return nil
+	}
+
+	if !isAutoMergePending(context, owner, repo, number, pr) {
+		return nil
+	}
+
+	request := pendingAutoMerges.get(ref)
+	if request == nil {
+		// The label may have been added by anyone with triage access, and
+		// AutoMergeOnPullRequest may have missed it or not yet removed it.
+		labeler, err := autoMergeLabeler(context, owner, repo, number)
+		if err != nil {
+			return context.NewError("chlog.attemptAutoMerge: couldn't find who labeled %s: %v", ref, err)
+		}
+		if labeler == "" || (!context.GitHubAuthedAs(labeler) && !auth.UserHasPushAccess(context, owner, repo, labeler)) {
+			context.Log("chlog.attemptAutoMerge: %s was labeled %s by @%s, who can't merge it, removing the label", ref, autoMergeLabel, labeler)
+			if _, err := context.GitHub.Issues.RemoveLabelForIssue(context.Context(), owner, repo, number, autoMergeLabel); err != nil {
+				return context.NewError("chlog.attemptAutoMerge: couldn't remove %s label from %s: %v", autoMergeLabel, ref, err)
+			}
+			return nil
+		}
+	}
+
+	// Auto-merges always wait for everything to be green.
+	config := preflightConfigFor(owner, repo)
+	config.RequireGreenStatuses = true
+	if err := preflight(context, owner, repo, pr, config); err != nil {
+		context.Log("chlog.attemptAutoMerge: %s isn't ready to merge: %v", ref, err)
+		return nil
+	}
+
+	if request == nil {
+		request = findAutoMergeRequest(context, owner, repo, number)
+	}
+
+	enqueueMerge(context, owner, repo, &queuedMerge{
+		number:             number,
+		changeSectionLabel: request.changeSectionLabel,
+		method:             request.method,
+		sha:                pr.GetHead().GetSHA(),
+		autoMerge:          true,
+	})
+	return nil
+}
+
+// finishAutoMerge forgets the auto-merge request of the merged PR.
+func finishAutoMerge(context *ctx.Context, owner, repo string, number int) {
+	ref := prRefString(owner, repo, number)
+	pendingAutoMerges.delete(ref)
+	if _, err := context.GitHub.Issues.RemoveLabelForIssue(context.Context(), owner, repo, number, autoMergeLabel); err != nil {
+		context.Log("chlog.finishAutoMerge: couldn't remove %s label from %s: %v", autoMergeLabel, ref, err)
+	}
+}
+
+// autoMergeLabeler returns who last added the auto-merge label to the PR, or
+// an empty string if nobody did.
+func autoMergeLabeler(context *ctx.Context, owner, repo string, number int) (string, error) {
+	labeler := ""
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := context.GitHub.Issues.ListIssueEvents(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, event := range events {
+			if event.GetEvent() == "labeled" && event.GetLabel().GetName() == autoMergeLabel {
+				labeler = event.GetActor().GetLogin()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return labeler, nil
+}
+
+// findAutoMergeRequest recovers the auto-merge request from the PR's
+// comments, e.g. after a restart. If the auto-merge label was added without
+// a comment, the merge isn't filed under any changelog section.
+func findAutoMergeRequest(context *ctx.Context, owner, repo string, number int) *autoMerge {
+	config := mergeConfigFor(owner, repo)
+	categories := categoriesFor(owner, repo)
+	comments := []*github.IssueComment{}
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := context.GitHub.Issues.ListComments(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			context.Log("chlog.findAutoMergeRequest: couldn't list comments for %s: %v", prRefString(owner, repo, number), err)
+			return &autoMerge{changeSectionLabel: "none", method: config.DefaultMethod}
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		isReq, request := parseAutoMergeRequestComment(comment.GetBody(), categories)
+		if !isReq || !auth.UserHasPushAccess(context, owner, repo, comment.GetUser().GetLogin()) {
+			continue
+		}
+		method, err := config.resolve(request.method)
+		if err != nil {
+			continue
+		}
+		return &autoMerge{
+			changeSectionLabel: changeSectionLabelFor(request.label, categories),
+			method:             method,
+			requester:          comment.GetUser().GetLogin(),
+		}
+	}
+
+	return &autoMerge{changeSectionLabel: "none", method: config.DefaultMethod}
+}
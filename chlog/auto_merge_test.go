@@ -0,0 +1,163 @@
+package chlog
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAutoMergeRequestComment(t *testing.T) {
+	comments := []struct {
+		comment string
+		isReq   bool
+		request mergeRequest
+	}{
+		{"merge it when it's ready", false, mergeRequest{}},
+		{"@jekyllbot: merge", false, mergeRequest{}},
+		{"@jekyllbot: merge when ready", true, mergeRequest{autoMerge: true}},
+		{"@jekyllbot: merge when green", true, mergeRequest{autoMerge: true}},
+		{"@jekyllbot: merge when ready +Bug Fix\n", true, mergeRequest{autoMerge: true, label: "bug-fixes"}},
+		{"@jekyllbot: :shipit: when green +major --rebase", true, mergeRequest{autoMerge: true, label: "major-enhancements", method: "rebase"}},
+		{"@jekyllbot: merge when green --nope", false, mergeRequest{}},
+		{"@jekyllbot: backport 3.8-stable when ready", false, mergeRequest{}},
+	}
+	for _, c := range comments {
+		isReq, request := parseAutoMergeRequestComment(c.comment, defaultCategories)
+		assert.Equal(t, c.isReq, isReq, "'%s' should have isReq=%v", c.comment, c.isReq)
+		assert.Equal(t, c.request, request, "'%s' should have request=%+v", c.comment, c.request)
+	}
+}
+
+func TestChangeSectionLabelFor(t *testing.T) {
+	assert.Equal(t, "none", changeSectionLabelFor("", defaultCategories))
+	assert.Equal(t, "Bug Fixes", changeSectionLabelFor("bug-fixes", defaultCategories))
+}
+
+func TestHasLabel(t *testing.T) {
+	labels := []*github.Label{{Name: github.String("bug")}, {Name: github.String(autoMergeLabel)}}
+	assert.True(t, hasLabel(labels, autoMergeLabel))
+	assert.False(t, hasLabel(labels[:1], autoMergeLabel))
+}
+
+func TestAutoMergeOnPullRequestLabeled(t *testing.T) {
+	cases := []struct {
+		sender        string
+		labelRemoved  bool
+		mergeAttempts int
+	}{
+		{"jekyllbot", false, 0},
+		{"triager", true, 0},
+		{"parkr", false, 1},
+	}
+	for _, c := range cases {
+		labelRemoved, mergeAttempts := false, 0
+		setup() // server & client!
+		mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"login": "jekyllbot"}`)
+		})
+		mux.HandleFunc("/orgs/labelers/teams", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"id": 7}]`)
+		})
+		mux.HandleFunc("/teams/7/members/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/teams/7/members/parkr" {
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		mux.HandleFunc("/teams/7/repos/labelers/r", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"permissions": {"pull": true, "push": true}}`)
+		})
+		mux.HandleFunc("/repos/labelers/r/issues/1/labels/auto-merge", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "DELETE", r.Method)
+			labelRemoved = true
+		})
+		mux.HandleFunc("/repos/labelers/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+			mergeAttempts++
+			fmt.Fprint(w, `{"number": 1, "state": "closed"}`)
+		})
+
+		context := &ctx.Context{GitHub: client}
+
+		err := AutoMergeOnPullRequest(context, &github.PullRequestEvent{
+			Action: github.String("labeled"),
+			Number: github.Int(1),
+			Label:  &github.Label{Name: github.String(autoMergeLabel)},
+			Sender: &github.User{Login: github.String(c.sender)},
+			Repo: &github.Repository{
+				Name:  github.String("r"),
+				Owner: &github.User{Login: github.String("labelers")},
+			},
+		})
+		assert.NoError(t, err, "sender: %s", c.sender)
+		assert.Equal(t, c.labelRemoved, labelRemoved, "sender: %s", c.sender)
+		assert.Equal(t, c.mergeAttempts, mergeAttempts, "sender: %s", c.sender)
+		teardown()
+	}
+}
+
+func TestAttemptAutoMergeChecksLabeler(t *testing.T) {
+	cases := []struct {
+		lastLabeler      string
+		labelRemoved     bool
+		reachedPreflight bool
+	}{
+		{"triager", true, false},
+		{"parkr", false, true},
+	}
+	for _, c := range cases {
+		labelRemoved, reachedPreflight := false, false
+		setup() // server & client!
+		mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"login": "jekyllbot"}`)
+		})
+		mux.HandleFunc("/orgs/mergers/teams", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"id": 8}]`)
+		})
+		mux.HandleFunc("/teams/8/members/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/teams/8/members/parkr" {
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		mux.HandleFunc("/teams/8/repos/mergers/r", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"permissions": {"pull": true, "push": true}}`)
+		})
+		mux.HandleFunc("/repos/mergers/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"number": 1, "state": "open", "labels": [{"name": "auto-merge"}], "head": {"sha": "abc"}}`)
+		})
+		// The events are paginated, and the label was last added by
+		// lastLabeler.
+		mux.HandleFunc("/repos/mergers/r/issues/1/events", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "2" {
+				fmt.Fprintf(w, `[{"event": "labeled", "label": {"name": "auto-merge"}, "actor": {"login": %q}}]`, c.lastLabeler)
+				return
+			}
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s/repos/mergers/r/issues/1/events?page=2>; rel="next"`, r.Host, baseURLPath))
+			fmt.Fprint(w, `[{"event": "labeled", "label": {"name": "auto-merge"}, "actor": {"login": "someone"}}]`)
+		})
+		mux.HandleFunc("/repos/mergers/r/issues/1/labels/auto-merge", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "DELETE", r.Method)
+			labelRemoved = true
+		})
+		mux.HandleFunc("/repos/mergers/r/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+			reachedPreflight = true
+			fmt.Fprint(w, `{"statuses": [{"context": "ci", "state": "pending"}]}`)
+		})
+		mux.HandleFunc("/repos/mergers/r/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"check_runs": []}`)
+		})
+
+		context := &ctx.Context{GitHub: client}
+
+		assert.NoError(t, attemptAutoMerge(context, "mergers", "r", 1), "labeler: %s", c.lastLabeler)
+		assert.Equal(t, c.labelRemoved, labelRemoved, "labeler: %s", c.lastLabeler)
+		assert.Equal(t, c.reachedPreflight, reachedPreflight, "labeler: %s", c.lastLabeler)
+		teardown()
+	}
+}
@@ -0,0 +1,188 @@
+package chlog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// ChangelogCategory is a changelog category, like "Site Enhancements" and
+// such. A "+label" in a merge request selects the first category whose
+// Prefix it starts with.
+type ChangelogCategory struct {
+	Prefix, Slug, Section string
+	// Labels are applied to PRs merged into this category.
+	Labels []string
+}
+
+var (
+	defaultCategories = []ChangelogCategory{
+		{
+			Prefix:  "major",
+			Slug:    "major-enhancements",
+			Section: "Major Enhancements",
+			Labels:  []string{"feature"},
+		},
+		{
+			Prefix:  "minor",
+			Slug:    "minor-enhancements",
+			Section: "Minor Enhancements",
+			Labels:  []string{"enhancement"},
+		},
+		{
+			Prefix:  "bug",
+			Slug:    "bug-fixes",
+			Section: "Bug Fixes",
+			Labels:  []string{"bug", "fix"},
+		},
+		{
+			Prefix:  "fix",
+			Slug:    "fix",
+			Section: "Bug Fixes",
+			Labels:  []string{"bug", "fix"},
+		},
+		{
+			Prefix:  "dev",
+			Slug:    "development-fixes",
+			Section: "Development Fixes",
+			Labels:  []string{"internal", "fix"},
+		},
+		{
+			Prefix:  "doc",
+			Slug:    "documentation",
+			Section: "Documentation",
+			Labels:  []string{"documentation"},
+		},
+		{
+			Prefix:  "port",
+			Slug:    "forward-ports",
+			Section: "Forward Ports",
+			Labels:  []string{"forward-port"},
+		},
+		{
+			Prefix:  "site",
+			Slug:    "site-enhancements",
+			Section: "Site Enhancements",
+			Labels:  []string{"documentation"},
+		},
+	}
+
+	repoCategories = map[string][]ChangelogCategory{}
+
+	// forwardPortLabel marks the PRs opened by backport.ForwardPortOnMerge.
+	forwardPortLabel = "forward-port"
+)
+
+// DefaultCategories returns a copy of the categories used by repos which
+// haven't configured their own.
+func DefaultCategories() []ChangelogCategory {
+	categories := make([]ChangelogCategory, len(defaultCategories))
+	copy(categories, defaultCategories)
+	return categories
+}
+
+// SetCategories configures the changelog categories for the repo.
+func SetCategories(owner, repo string, categories []ChangelogCategory) error {
+	if err := validateCategories(categories); err != nil {
+		return fmt.Errorf("chlog.SetCategories: %s/%s: %v", owner, repo, err)
+	}
+	repoCategories[owner+"/"+repo] = categories
+	return nil
+}
+
+func categoriesFor(owner, repo string) []ChangelogCategory {
+	if categories, ok := repoCategories[owner+"/"+repo]; ok {
+		return categories
+	}
+	return defaultCategories
+}
+
+// validateCategories ensures each category is complete and that every
+// "+label" matches at most one category's prefix.
+func validateCategories(categories []ChangelogCategory) error {
+	if len(categories) == 0 {
+		return fmt.Errorf("at least one category is required")
+	}
+	for i, category := range categories {
+		if category.Prefix == "" || category.Slug == "" || category.Section == "" {
+			return fmt.Errorf("category %d needs a prefix, slug and section", i+1)
+		}
+		if category.Prefix != downcaseAndHyphenize(category.Prefix) {
+			return fmt.Errorf("prefix %q must be lowercase and contain no spaces", category.Prefix)
+		}
+		for _, other := range categories[:i] {
+			if strings.HasPrefix(category.Prefix, other.Prefix) || strings.HasPrefix(other.Prefix, category.Prefix) {
+				return fmt.Errorf("prefixes %q and %q both match \"+%s\"", other.Prefix, category.Prefix, longer(other.Prefix, category.Prefix))
+			}
+		}
+	}
+	return nil
+}
+
+func longer(a, b string) string {
+	if len(a) >= len(b) {
+		return a
+	}
+	return b
+}
+
+func normalizeLabel(label string, categories []ChangelogCategory) string {
+	for _, category := range categories {
+		if strings.HasPrefix(label, category.Prefix) {
+			return category.Slug
+		}
+	}
+
+	return label
+}
+
+func sectionForLabel(slug string, categories []ChangelogCategory) string {
+	for _, category := range categories {
+		if slug == category.Slug {
+			return category.Section
+		}
+	}
+
+	return slug
+}
+
+// categoryForLabels returns the first category matching one of a PR's
+// labels, either by its slug or one of the labels it applies.
+func categoryForLabels(labels []string, categories []ChangelogCategory) (ChangelogCategory, bool) {
+	for _, category := range categories {
+		for _, label := range labels {
+			if label == category.Slug || containsString(category.Labels, label) {
+				return category, true
+			}
+		}
+	}
+	return ChangelogCategory{}, false
+}
+
+// forwardPortSection returns the section of the category which applies the
+// forward-port label if the PR has it, or "none". Forward ports are the only
+// PRs filed by their labels: any other merge needs a "+category".
+func forwardPortSection(labels []*github.Label, categories []ChangelogCategory) string {
+	for _, label := range labels {
+		if label.GetName() != forwardPortLabel {
+			continue
+		}
+		for _, category := range categories {
+			if containsString(category.Labels, forwardPortLabel) {
+				return category.Section
+			}
+		}
+	}
+	return "none"
+}
+
+func labelsForSubsection(changeSectionLabel string, categories []ChangelogCategory) []string {
+	for _, category := range categories {
+		if changeSectionLabel == category.Section {
+			return category.Labels
+		}
+	}
+
+	return []string{}
+}
@@ -0,0 +1,61 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCategories(t *testing.T) {
+	assert.NoError(t, validateCategories(defaultCategories))
+
+	assert.Error(t, validateCategories(nil))
+	assert.Error(t, validateCategories([]ChangelogCategory{{Prefix: "bug", Slug: "bug-fixes"}}))
+	assert.Error(t, validateCategories([]ChangelogCategory{{Prefix: "Bug Fix", Slug: "bug-fixes", Section: "Bug Fixes"}}))
+
+	err := validateCategories([]ChangelogCategory{
+		{Prefix: "doc", Slug: "documentation", Section: "Documentation"},
+		{Prefix: "docs", Slug: "docs-site", Section: "Docs Site"},
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `"+docs"`)
+	}
+
+	assert.Error(t, validateCategories([]ChangelogCategory{
+		{Prefix: "fix", Slug: "bug-fixes", Section: "Bug Fixes"},
+		{Prefix: "fix", Slug: "other-fixes", Section: "Other Fixes"},
+	}))
+}
+
+func TestSetCategories(t *testing.T) {
+	defer delete(repoCategories, "jekyll/minima")
+
+	assert.Equal(t, defaultCategories, categoriesFor("jekyll", "minima"))
+
+	theme := ChangelogCategory{Prefix: "theme", Slug: "theme-enhancements", Section: "Theme Enhancements", Labels: []string{"enhancement"}}
+	assert.NoError(t, SetCategories("jekyll", "minima", []ChangelogCategory{theme}))
+
+	categories := categoriesFor("jekyll", "minima")
+	assert.Equal(t, "theme-enhancements", normalizeLabel("theme-tweak", categories))
+	assert.Equal(t, "site-enhancements", normalizeLabel("site-enhancements", categories))
+	assert.Equal(t, "Theme Enhancements", sectionForLabel("theme-enhancements", categories))
+	assert.Equal(t, []string{"enhancement"}, labelsForSubsection("Theme Enhancements", categories))
+
+	assert.Error(t, SetCategories("jekyll", "minima", []ChangelogCategory{theme, theme}))
+	assert.Equal(t, []ChangelogCategory{theme}, categoriesFor("jekyll", "minima"))
+}
+
+func TestDefaultCategoriesIsACopy(t *testing.T) {
+	categories := DefaultCategories()
+	categories[0].Section = "Changed"
+	assert.NotEqual(t, "Changed", defaultCategories[0].Section)
+}
+
+func TestForwardPortSection(t *testing.T) {
+	labels := []*github.Label{{Name: github.String("pending-rebase")}, {Name: github.String("forward-port")}}
+	assert.Equal(t, "Forward Ports", forwardPortSection(labels, defaultCategories))
+	assert.Equal(t, "none", forwardPortSection(labels[:1], defaultCategories))
+	assert.Equal(t, "none", forwardPortSection([]*github.Label{{Name: github.String("bug")}}, defaultCategories))
+	assert.Equal(t, "none", forwardPortSection(labels, []ChangelogCategory{{Prefix: "bug", Slug: "bug-fixes", Section: "Bug Fixes"}}))
+}
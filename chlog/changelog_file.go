@@ -0,0 +1,188 @@
+package chlog
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var (
+	// historyUpdateAttempts is how many times to try to commit the change
+	// to the changelog before giving up.
+	historyUpdateAttempts = 5
+	// historyUpdateBackoff is how long to wait before the first retry. It
+	// doubles with each retry.
+	historyUpdateBackoff = time.Second
+)
+
+// fileFormat is the syntax of a changelog kept in a single file.
+type fileFormat interface {
+	// addChange returns the contents with the PR added to the unreleased
+	// changes.
+	addChange(contents, section, title string, number int) (string, error)
+	// versionNotes returns the changes listed under the version, where
+	// "HEAD" is the unreleased changes.
+	versionNotes(contents, version string) (string, error)
+	// cutVersion returns the contents with the unreleased changes moved
+	// under the version, released on the date.
+	cutVersion(contents, version, date string) (string, error)
+}
+
+// singleFileChangelog is a changelog kept in a single file, like
+// History.markdown or CHANGELOG.md.
+type singleFileChangelog struct {
+	ChangelogConfig
+	format fileFormat
+}
+
+// addChange adds the merged PR to the changelog. If the file changed between
+// reading and committing it, e.g. because two PRs were merged at once, the
+// change is re-applied to the new contents and retried.
+func (c singleFileChangelog) addChange(context *ctx.Context, owner, repo string, number int, section, title string) error {
+	backoff := historyUpdateBackoff
+	var err error
+	for attempt := 1; attempt <= historyUpdateAttempts; attempt++ {
+		var contents, sha, newContents string
+		contents, sha, err = readChangelogFile(context, owner, repo, c.ChangelogConfig)
+		if err != nil {
+			return err
+		}
+
+		newContents, err = c.format.addChange(contents, section, title, number)
+		if err != nil {
+			return err
+		}
+
+		err = commitFile(context, owner, repo, c.Path, c.Branch, sha, newContents,
+			fmt.Sprintf("Update history to reflect merge of #%d [ci skip]", number))
+		if err == nil || !isConflict(err) {
+			return err
+		}
+
+		if attempt < historyUpdateAttempts {
+			context.Log("chlog.addChange: %s changed while adding #%d to %s/%s, retrying in %s", c.Path, number, owner, repo, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("%s kept changing, gave up after %d attempts: %v", c.Path, historyUpdateAttempts, err)
+}
+
+func (c singleFileChangelog) releaseNotes(context *ctx.Context, owner, repo, version string) (string, error) {
+	contents, _, err := readChangelogFile(context, owner, repo, c.ChangelogConfig)
+	if err != nil {
+		return "", err
+	}
+	return c.format.versionNotes(contents, version)
+}
+
+func (c singleFileChangelog) cutVersion(context *ctx.Context, owner, repo, version, date string) (*github.TreeEntry, error) {
+	contents, _, err := readChangelogFile(context, owner, repo, c.ChangelogConfig)
+	if err != nil {
+		return nil, err
+	}
+	newContents, err := c.format.cutVersion(contents, version, date)
+	if err != nil {
+		return nil, err
+	}
+	return &github.TreeEntry{
+		Path:    github.String(c.Path),
+		Mode:    github.String("100644"),
+		Type:    github.String("blob"),
+		Content: github.String(newContents),
+	}, nil
+}
+
+// readChangelogFile returns the contents and blob SHA of the changelog. If
+// the file doesn't exist yet, both are empty.
+func readChangelogFile(context *ctx.Context, owner, repo string, config ChangelogConfig) (content, sha string, err error) {
+	return readFileAt(context, owner, repo, config.Path, "heads/"+config.Branch)
+}
+
+// readFileAt reads the file at the ref, returning its contents and SHA. A
+// file which doesn't exist is empty.
+func readFileAt(context *ctx.Context, owner, repo, path, ref string) (content, sha string, err error) {
+	contents, _, resp, err := context.GitHub.Repositories.GetContents(
+		context.Context(),
+		owner,
+		repo,
+		path,
+		&github.RepositoryContentGetOptions{Ref: ref},
+	)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	content, err = contents.GetContent()
+	if err != nil {
+		return "", "", err
+	}
+	return content, contents.GetSHA(), nil
+}
+
+// commitFile writes the file at path on the branch. The sha is that of the
+// file being replaced, or empty to create it.
+func commitFile(context *ctx.Context, owner, repo, path, branch, sha, contents, message string) error {
+	repositoryContentsOptions := &github.RepositoryContentFileOptions{
+		Message: github.String(message),
+		Content: []byte(contents),
+		Branch:  github.String(branch),
+		Committer: &github.CommitAuthor{
+			Name:  github.String("jekyllbot"),
+			Email: github.String("jekyllbot@jekyllrb.com"),
+		},
+	}
+	if sha != "" {
+		repositoryContentsOptions.SHA = github.String(sha)
+	}
+	_, _, err := context.GitHub.Repositories.UpdateFile(context.Context(), owner, repo, path, repositoryContentsOptions)
+	return err
+}
+
+// historyMarkdown is the History.markdown format of
+// github.com/parkr/changelog.
+type historyMarkdown struct{}
+
+func (historyMarkdown) addChange(contents, section, title string, number int) (string, error) {
+	if _, err := parseChangelog(contents); err != nil {
+		return "", err
+	}
+	return addMergeReference(contents, section, title, number), nil
+}
+
+func (historyMarkdown) versionNotes(contents, version string) (string, error) {
+	changes, err := parseChangelog(contents)
+	if err != nil {
+		return "", fmt.Errorf("could not parse history file: %v", err)
+	}
+
+	versionLog := changes.GetVersion(version)
+	if versionLog == nil {
+		return "", fmt.Errorf("no '%s' version in history file", version)
+	}
+
+	return strings.Join(strings.SplitN(versionLog.String(), "\n\n", 2)[1:], "\n"), nil
+}
+
+func (historyMarkdown) cutVersion(contents, version, date string) (string, error) {
+	changes, err := parseChangelog(contents)
+	if err != nil {
+		return "", fmt.Errorf("could not parse history file: %v", err)
+	}
+	if changes.GetVersion(version) != nil {
+		return "", fmt.Errorf("history file already has a '%s' version", version)
+	}
+
+	head := changes.GetVersion("HEAD")
+	if head == nil {
+		return "", fmt.Errorf("no 'HEAD' version in history file")
+	}
+	head.Version, head.Date = version, date
+	return changes.String(), nil
+}
@@ -0,0 +1,98 @@
+package chlog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestHistoryServer serves History.markdown, which changes to include
+// another merge after each of the first conflicts commits, which fail.
+func newTestHistoryServer(t *testing.T, conflicts int) (*ctx.Context, *[]string, func()) {
+	history := "## HEAD\n\n### Bug Fixes\n\n  * Fix a bug (#1)\n"
+	sha := 0
+	commits := []string{}
+
+	setup() // server & client!
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(&github.RepositoryContent{
+				Encoding: github.String("base64"),
+				Content:  github.String(base64.StdEncoding.EncodeToString([]byte(history))),
+				SHA:      github.String(fmt.Sprintf("sha%d", sha)),
+			})
+		case "PUT":
+			v := new(github.RepositoryContentFileOptions)
+			json.NewDecoder(r.Body).Decode(v)
+			if conflicts > 0 {
+				conflicts--
+				// Someone else merged in the meantime.
+				history += "  * Fix another bug (#2)\n"
+				sha++
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"message":"History.markdown does not match"}`)
+				return
+			}
+			assert.Equal(t, fmt.Sprintf("sha%d", sha), v.GetSHA())
+			history = string(v.Content)
+			commits = append(commits, history)
+			fmt.Fprint(w, `{}`)
+		}
+	})
+
+	return &ctx.Context{GitHub: client}, &commits, teardown
+}
+
+func TestRecordChangeRetriesConflicts(t *testing.T) {
+	historyUpdateBackoff = time.Millisecond
+	context, commits, teardown := newTestHistoryServer(t, 2)
+	defer teardown()
+
+	assert.NoError(t, recordChange(context, "o", "r", 3, "Bug Fixes", "Fix a third bug"))
+	assert.Equal(t, []string{
+		"## HEAD\n\n### Bug Fixes\n\n  * Fix a bug (#1)\n  * Fix another bug (#2)\n  * Fix another bug (#2)\n  * Fix a third bug (#3)\n",
+	}, *commits)
+}
+
+func TestRecordChangeGivesUp(t *testing.T) {
+	historyUpdateBackoff = time.Millisecond
+	context, commits, teardown := newTestHistoryServer(t, historyUpdateAttempts)
+	defer teardown()
+
+	err := recordChange(context, "o", "r", 3, "Bug Fixes", "Fix a third bug")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "gave up after 5 attempts")
+	assert.Empty(t, *commits)
+}
+
+func TestHistoryMarkdownVersionNotes(t *testing.T) {
+	history := "## HEAD\n\n### Bug Fixes\n\n  * Fix a bug (#1)\n\n## 1.0.0 / 2018-01-01\n\n  * Initial release (#0)\n"
+
+	notes, err := historyMarkdown{}.versionNotes(history, "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "### Bug Fixes\n\n  * Fix a bug (#1)", notes)
+
+	_, err = historyMarkdown{}.versionNotes(history, "2.0.0")
+	assert.Error(t, err)
+}
+
+func TestHistoryMarkdownCutVersion(t *testing.T) {
+	history := "## HEAD\n\n### Bug Fixes\n\n  * Fix a bug (#1)\n\n## 1.0.0 / 2018-01-01\n\n  * Initial release (#0)\n"
+
+	cut, err := historyMarkdown{}.cutVersion(history, "1.1.0", "2018-02-01")
+	assert.NoError(t, err)
+	assert.Equal(t, "## 1.1.0 / 2018-02-01\n\n### Bug Fixes\n\n  * Fix a bug (#1)\n\n## 1.0.0 / 2018-01-01\n\n  * Initial release (#0)\n", cut)
+
+	_, err = historyMarkdown{}.cutVersion(history, "1.0.0", "2018-02-01")
+	assert.Error(t, err)
+	_, err = historyMarkdown{}.cutVersion(cut, "1.2.0", "2018-03-01")
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package chlog
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+const (
+	// HistoryFormat is the History.markdown format read and written by
+	// github.com/parkr/changelog, with unreleased changes under "## HEAD".
+	HistoryFormat = "history"
+	// KeepAChangelogFormat is the https://keepachangelog.com format, with
+	// unreleased changes under "## [Unreleased]".
+	KeepAChangelogFormat = "keep-a-changelog"
+	// FragmentsFormat is a directory with one release note file per PR.
+	FragmentsFormat = "fragments"
+)
+
+var (
+	// defaultChangelogPaths are used for repos which configure a format
+	// without a path.
+	defaultChangelogPaths = map[string]string{
+		HistoryFormat:        "History.markdown",
+		KeepAChangelogFormat: "CHANGELOG.md",
+		FragmentsFormat:      "changelog.d",
+	}
+
+	// defaultChangelogConfig applies to repos without a ChangelogConfig.
+	defaultChangelogConfig = ChangelogConfig{Format: HistoryFormat, Path: "History.markdown", Branch: "master"}
+
+	changelogConfigs = map[string]ChangelogConfig{}
+)
+
+// ChangelogConfig configures where and how a repo keeps its changelog.
+type ChangelogConfig struct {
+	// Format is one of HistoryFormat, KeepAChangelogFormat or
+	// FragmentsFormat.
+	Format string
+	// Path is the changelog file or, for FragmentsFormat, the directory of
+	// fragments. It defaults to the format's conventional path.
+	Path string
+	// Branch is where the changelog is read from and committed to. It
+	// defaults to master.
+	Branch string
+}
+
+// SetChangelogConfig configures the repo's changelog.
+func SetChangelogConfig(owner, repo string, config ChangelogConfig) error {
+	defaultPath, ok := defaultChangelogPaths[config.Format]
+	if !ok {
+		return fmt.Errorf("chlog.SetChangelogConfig: unknown changelog format %q for %s/%s", config.Format, owner, repo)
+	}
+	if config.Path == "" {
+		config.Path = defaultPath
+	}
+	if config.Branch == "" {
+		config.Branch = defaultChangelogConfig.Branch
+	}
+	changelogConfigs[owner+"/"+repo] = config
+	return nil
+}
+
+func changelogConfigFor(owner, repo string) ChangelogConfig {
+	if config, ok := changelogConfigs[owner+"/"+repo]; ok {
+		return config
+	}
+	return defaultChangelogConfig
+}
+
+// changelogFormat records merged PRs in a repo's changelog and reads them
+// back out when releasing.
+type changelogFormat interface {
+	// addChange records the merged PR in the section of the unreleased
+	// changes. A section of "none" records it outside of any section.
+	addChange(context *ctx.Context, owner, repo string, number int, section, title string) error
+	// releaseNotes returns the changes recorded for the version, where
+	// "HEAD" is the unreleased changes.
+	releaseNotes(context *ctx.Context, owner, repo, version string) (string, error)
+	// cutVersion returns the changelog with the unreleased changes moved
+	// under the version, released on the date, as a tree entry to commit.
+	// It returns nil if the changelog has nothing to change.
+	cutVersion(context *ctx.Context, owner, repo, version, date string) (*github.TreeEntry, error)
+}
+
+// changelogFor returns the repo's configured changelog.
+func changelogFor(owner, repo string) changelogFormat {
+	config := changelogConfigFor(owner, repo)
+	switch config.Format {
+	case KeepAChangelogFormat:
+		return singleFileChangelog{ChangelogConfig: config, format: keepAChangelog{}}
+	case FragmentsFormat:
+		return fragmentsChangelog{ChangelogConfig: config}
+	default:
+		return singleFileChangelog{ChangelogConfig: config, format: historyMarkdown{}}
+	}
+}
+
+// recordChange adds the merged PR to the repo's changelog.
+func recordChange(context *ctx.Context, owner, repo string, number int, changeSectionLabel, prTitle string) error {
+	return changelogFor(owner, repo).addChange(context, owner, repo, number, changeSectionLabel, prTitle)
+}
+
+// releaseNotesFor returns the changes recorded in the repo's changelog for
+// the version, where "HEAD" is the unreleased changes.
+func releaseNotesFor(context *ctx.Context, owner, repo, version string) (string, error) {
+	return changelogFor(owner, repo).releaseNotes(context, owner, repo, version)
+}
+
+// UnreleasedChanges returns the changes recorded in the repo's changelog
+// since the last release, grouped by section.
+func UnreleasedChanges(context *ctx.Context, owner, repo string) (string, error) {
+	return releaseNotesFor(context, owner, repo, "HEAD")
+}
+
+// isConflict returns true if the error is GitHub refusing to update a file
+// because the given SHA is no longer that of the file.
+func isConflict(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == http.StatusConflict
+}
+
+// reportChangelogFailure lets the PR know it's missing from the changelog
+// so a maintainer can add it by hand.
+func reportChangelogFailure(context *ctx.Context, owner, repo string, number int, changeSectionLabel, prTitle string, changelogErr error) error {
+	section := "the unreleased changes"
+	if changeSectionLabel != "none" {
+		section = fmt.Sprintf("`%s` in the unreleased changes", changeSectionLabel)
+	}
+	body := fmt.Sprintf(
+		"I merged this, but I couldn't add it to %s: %v\n\nPlease add `%s (#%d)` to %s by hand.",
+		changelogConfigFor(owner, repo).Path, changelogErr, prTitle, number, section)
+	_, _, err := context.GitHub.Issues.CreateComment(context.Context(), owner, repo, number, &github.IssueComment{
+		Body: github.String(body),
+	})
+	return err
+}
@@ -0,0 +1,61 @@
+package chlog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetChangelogConfig(t *testing.T) {
+	defer delete(changelogConfigs, "o/r")
+
+	assert.Equal(t, defaultChangelogConfig, changelogConfigFor("o", "r"))
+	assert.IsType(t, singleFileChangelog{}, changelogFor("o", "r"))
+
+	assert.Error(t, SetChangelogConfig("o", "r", ChangelogConfig{Format: "towncrier"}))
+
+	assert.NoError(t, SetChangelogConfig("o", "r", ChangelogConfig{Format: KeepAChangelogFormat}))
+	assert.Equal(t, ChangelogConfig{Format: KeepAChangelogFormat, Path: "CHANGELOG.md", Branch: "master"}, changelogConfigFor("o", "r"))
+	assert.Equal(t, keepAChangelog{}, changelogFor("o", "r").(singleFileChangelog).format)
+
+	assert.NoError(t, SetChangelogConfig("o", "r", ChangelogConfig{Format: FragmentsFormat, Path: "docs/notes", Branch: "main"}))
+	assert.Equal(t, fragmentsChangelog{ChangelogConfig{Format: FragmentsFormat, Path: "docs/notes", Branch: "main"}}, changelogFor("o", "r"))
+}
+
+func TestRecordChangeUsesConfiguredFile(t *testing.T) {
+	assert.NoError(t, SetChangelogConfig("o", "r", ChangelogConfig{Format: KeepAChangelogFormat, Branch: "main"}))
+	defer delete(changelogConfigs, "o/r")
+
+	var committed *github.RepositoryContentFileOptions
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/contents/CHANGELOG.md", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			assert.Equal(t, "heads/main", r.URL.Query().Get("ref"))
+			json.NewEncoder(w).Encode(&github.RepositoryContent{
+				Encoding: github.String("base64"),
+				Content:  github.String(base64.StdEncoding.EncodeToString([]byte("# Changelog\n\n## [Unreleased]\n"))),
+				SHA:      github.String("abc"),
+			})
+		case "PUT":
+			committed = new(github.RepositoryContentFileOptions)
+			json.NewDecoder(r.Body).Decode(committed)
+			w.Write([]byte(`{}`))
+		}
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	assert.NoError(t, recordChange(context, "o", "r", 4, "Bug Fixes", "Fix it"))
+	if assert.NotNil(t, committed) {
+		assert.Equal(t, "main", committed.GetBranch())
+		assert.Equal(t, "abc", committed.GetSHA())
+		assert.Equal(t, "# Changelog\n\n## [Unreleased]\n\n### Fixed\n\n- Fix it (#4)\n", string(committed.Content))
+	}
+}
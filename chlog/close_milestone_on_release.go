@@ -1,10 +1,22 @@
 package chlog
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/google/go-github/github"
 	"github.com/parkr/auto-reply/ctx"
 )
 
+// milestoneSummaryMarker starts the milestone summary appended to release
+// bodies.
+const milestoneSummaryMarker = "<!-- milestone summary -->"
+
+// CloseMilestoneOnRelease closes the milestone named after a published
+// release, e.g. "v3.2.0" or "3.2.0". Its open issues and PRs are moved to the
+// next version's milestone, which is created if there isn't one, and a
+// summary of what was closed and moved is added to the release.
 func CloseMilestoneOnRelease(context *ctx.Context, payload interface{}) error {
 	release, ok := payload.(*github.ReleaseEvent)
 	if !ok {
@@ -29,19 +41,167 @@ func CloseMilestoneOnRelease(context *ctx.Context, payload interface{}) error {
 		return context.NewError("chlog.CloseMilestoneOnRelease: couldn't fetch milestones for %s/%s: %+v", owner, repo, err)
 	}
 
+	tag := *release.Release.TagName
+	milestone := milestoneForTag(milestones, tag)
+	if milestone == nil {
+		context.Log("chlog.CloseMilestoneOnRelease: no milestone with title '%s' on %s/%s", tag, owner, repo)
+		return nil
+	}
+	context.Log("chlog.CloseMilestoneOnRelease: found milestone (%d)", *milestone.Number)
+
+	moved, next, err := moveOpenItems(context, owner, repo, milestone, milestones)
+	if err != nil {
+		return context.NewError("chlog.CloseMilestoneOnRelease: couldn't move open items out of %s on %s/%s: %+v", milestone.GetTitle(), owner, repo, err)
+	}
+
+	_, _, err = context.GitHub.Issues.EditMilestone(
+		context.Context(), owner, repo, *milestone.Number, &github.Milestone{State: github.String("closed")})
+	if err != nil {
+		return context.NewError("chlog.CloseMilestoneOnRelease: couldn't close milestone for %s/%s: %+v", owner, repo, err)
+	}
+
+	if strings.Contains(release.Release.GetBody(), milestoneSummaryMarker) {
+		return nil
+	}
+	_, _, err = context.GitHub.Repositories.EditRelease(context.Context(), owner, repo, release.Release.GetID(), &github.RepositoryRelease{
+		Body: github.String(strings.TrimRight(release.Release.GetBody(), "\n") + "\n\n" + milestoneSummary(milestone, moved, next)),
+	})
+	if err != nil {
+		return context.NewError("chlog.CloseMilestoneOnRelease: couldn't add the milestone summary to %s on %s/%s: %+v", tag, owner, repo, err)
+	}
+
+	return nil
+}
+
+// milestoneVersion returns the version a milestone is titled after, or an
+// empty string if it isn't titled after one.
+func milestoneVersion(title string) string {
+	version := strings.TrimPrefix(title, "v")
+	if !isGemVersion(version) {
+		return ""
+	}
+	return version
+}
+
+// milestoneForTag returns the milestone titled after the tag, with or
+// without its "v", or nil if there isn't one.
+func milestoneForTag(milestones []*github.Milestone, tag string) *github.Milestone {
 	for _, milestone := range milestones {
-		if *milestone.Title == *release.Release.TagName {
-			context.Log("chlog.CloseMilestoneOnRelease: found milestone (%d)", *milestone.Number)
+		if milestone.GetTitle() == tag || milestone.GetTitle() == strings.TrimPrefix(tag, "v") {
+			return milestone
+		}
+	}
+	return nil
+}
 
-			_, _, err := context.GitHub.Issues.EditMilestone(
-				context.Context(), owner, repo, *milestone.Number, &github.Milestone{State: github.String("closed")})
-			if err != nil {
-				return context.NewError("chlog.CloseMilestoneOnRelease: couldn't close milestone for %s/%s: %+v", owner, repo, err)
-			}
+// nextPatchVersion returns the version after a release, e.g. "3.2.1" after
+// "3.2.0", or "3.2.0" after "3.2.0.beta1".
+func nextPatchVersion(version string) string {
+	v, _ := parseGemVersion(version)
+	if v.prerelease() {
+		return v.release()
+	}
+	parts := strings.Split(v.release(), ".")
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+	patch, _ := strconv.Atoi(parts[2])
+	return fmt.Sprintf("%s.%s.%d", parts[0], parts[1], patch+1)
+}
+
+// NextMilestone returns the milestone with the lowest version after the
+// title's, e.g. a milestone or tag, or nil if there's none. Versions are
+// ordered as RubyGems orders them.
+func NextMilestone(title string, milestones []*github.Milestone) *github.Milestone {
+	version := milestoneVersion(title)
+	var next *github.Milestone
+	for _, candidate := range milestones {
+		candidateVersion := milestoneVersion(candidate.GetTitle())
+		if candidateVersion == "" || compareVersions(candidateVersion, version) <= 0 {
+			continue
+		}
+		if next == nil || compareVersions(candidateVersion, milestoneVersion(next.GetTitle())) < 0 {
+			next = candidate
 		}
 	}
+	return next
+}
 
-	context.Log("chlog.CloseMilestoneOnRelease: no milestone with title '%s' on %s/%s", *release.Release.TagName, owner, repo)
+// moveOpenItems moves the milestone's open issues and PRs to the next
+// milestone, creating it if needed, and comments on each. It returns the
+// numbers of the moved items and the milestone they were moved to, if any.
+func moveOpenItems(context *ctx.Context, owner, repo string, milestone *github.Milestone, milestones []*github.Milestone) ([]int, *github.Milestone, error) {
+	items := []*github.Issue{}
+	opts := &github.IssueListByRepoOptions{
+		Milestone:   strconv.Itoa(milestone.GetNumber()),
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), owner, repo, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, issues...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if len(items) == 0 {
+		return nil, nil, nil
+	}
 
-	return nil
+	version := milestoneVersion(milestone.GetTitle())
+	if version == "" {
+		return nil, nil, fmt.Errorf("can't tell which milestone comes after %s", milestone.GetTitle())
+	}
+	next := NextMilestone(milestone.GetTitle(), milestones)
+	if next == nil {
+		title := nextPatchVersion(version)
+		if strings.HasPrefix(milestone.GetTitle(), "v") {
+			title = "v" + title
+		}
+		var err error
+		next, _, err = context.GitHub.Issues.CreateMilestone(context.Context(), owner, repo, &github.Milestone{Title: github.String(title)})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	moved := []int{}
+	for _, item := range items {
+		_, _, err := context.GitHub.Issues.Edit(context.Context(), owner, repo, item.GetNumber(), &github.IssueRequest{
+			Milestone: next.Number,
+		})
+		if err != nil {
+			return moved, next, err
+		}
+		moved = append(moved, item.GetNumber())
+
+		_, _, err = context.GitHub.Issues.CreateComment(context.Context(), owner, repo, item.GetNumber(), &github.IssueComment{
+			Body: github.String(fmt.Sprintf(
+				"%s was released while this was still open, so I moved this to the %s milestone.",
+				milestone.GetTitle(), next.GetTitle())),
+		})
+		if err != nil {
+			context.Log("chlog.CloseMilestoneOnRelease: couldn't comment on %s/%s#%d: %+v", owner, repo, item.GetNumber(), err)
+		}
+	}
+	return moved, next, nil
+}
+
+// milestoneSummary describes what was closed in and moved out of the
+// milestone.
+func milestoneSummary(milestone *github.Milestone, moved []int, next *github.Milestone) string {
+	summary := fmt.Sprintf("%s\n### Milestone\n\n%d issues and pull requests were closed in the %s milestone.",
+		milestoneSummaryMarker, milestone.GetClosedIssues(), milestone.GetTitle())
+	if len(moved) > 0 {
+		references := []string{}
+		for _, number := range moved {
+			references = append(references, fmt.Sprintf("#%d", number))
+		}
+		summary += fmt.Sprintf(" %d still open were moved to %s: %s.", len(moved), next.GetTitle(), strings.Join(references, ", "))
+	}
+	return summary + "\n"
 }
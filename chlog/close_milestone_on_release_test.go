@@ -0,0 +1,114 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextPatchVersion(t *testing.T) {
+	assert.Equal(t, "3.2.1", nextPatchVersion("3.2.0"))
+	assert.Equal(t, "3.10.10", nextPatchVersion("3.10.9"))
+}
+
+func TestNextMilestone(t *testing.T) {
+	milestones := []*github.Milestone{
+		{Title: github.String("v3.2.0")},
+		{Title: github.String("Backlog")},
+		{Title: github.String("v4.0.0")},
+		{Title: github.String("v3.3.0")},
+		{Title: github.String("v3.1.0")},
+	}
+	assert.Equal(t, "v3.3.0", NextMilestone(milestones[0].GetTitle(), milestones).GetTitle())
+	assert.Nil(t, NextMilestone(milestones[2].GetTitle(), milestones))
+}
+
+func TestMilestoneForTag(t *testing.T) {
+	milestones := []*github.Milestone{{Title: github.String("3.2.0")}, {Title: github.String("v3.1.0")}}
+	assert.Equal(t, "3.2.0", milestoneForTag(milestones, "v3.2.0").GetTitle())
+	assert.Equal(t, "v3.1.0", milestoneForTag(milestones, "v3.1.0").GetTitle())
+	assert.Nil(t, milestoneForTag(milestones, "v3.3.0"))
+}
+
+func TestCloseMilestoneOnRelease(t *testing.T) {
+	var closed bool
+	var created *github.Milestone
+	var releaseBody string
+	moved := map[int]int{}
+	comments := map[int]string{}
+
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/milestones", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			created = new(github.Milestone)
+			json.NewDecoder(r.Body).Decode(created)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"number": 3, "title": %q}`, created.GetTitle())
+			return
+		}
+		fmt.Fprint(w, `[{"number": 2, "title": "v3.2.0", "closed_issues": 7}, {"number": 1, "title": "Backlog"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/milestones/2", func(w http.ResponseWriter, r *http.Request) {
+		v := new(github.Milestone)
+		json.NewDecoder(r.Body).Decode(v)
+		closed = v.GetState() == "closed"
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("milestone"))
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		fmt.Fprint(w, `[{"number": 10}, {"number": 11}]`)
+	})
+	for _, number := range []int{10, 11} {
+		number := number
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d", number), func(w http.ResponseWriter, r *http.Request) {
+			v := new(github.IssueRequest)
+			json.NewDecoder(r.Body).Decode(v)
+			moved[number] = v.GetMilestone()
+			fmt.Fprint(w, `{}`)
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d/comments", number), func(w http.ResponseWriter, r *http.Request) {
+			v := new(github.IssueComment)
+			json.NewDecoder(r.Body).Decode(v)
+			comments[number] = v.GetBody()
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{}`)
+		})
+	}
+	mux.HandleFunc("/repos/o/r/releases/1", func(w http.ResponseWriter, r *http.Request) {
+		v := new(github.RepositoryRelease)
+		json.NewDecoder(r.Body).Decode(v)
+		releaseBody = v.GetBody()
+		fmt.Fprint(w, `{}`)
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	err := CloseMilestoneOnRelease(context, &github.ReleaseEvent{
+		Action: github.String("published"),
+		Repo:   &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+		Release: &github.RepositoryRelease{
+			ID:         github.Int64(1),
+			TagName:    github.String("v3.2.0"),
+			Body:       github.String("  * Fix a bug (#1)\n"),
+			Prerelease: github.Bool(false),
+			Draft:      github.Bool(false),
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, closed)
+	if assert.NotNil(t, created) {
+		assert.Equal(t, "v3.2.1", created.GetTitle())
+	}
+	assert.Equal(t, map[int]int{10: 3, 11: 3}, moved)
+	assert.Equal(t, "v3.2.0 was released while this was still open, so I moved this to the v3.2.1 milestone.", comments[10])
+	assert.Equal(t, "  * Fix a bug (#1)\n\n"+milestoneSummaryMarker+"\n### Milestone\n\n"+
+		"7 issues and pull requests were closed in the v3.2.0 milestone. 2 still open were moved to v3.2.1: #10, #11.\n", releaseBody)
+}
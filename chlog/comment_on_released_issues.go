@@ -0,0 +1,106 @@
+package chlog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/parkr/auto-reply/labeler"
+)
+
+// CommentOnReleasedIssues lets the PRs merged since the previous release,
+// and the issues they closed, know which release they shipped in. Each is
+// only commented on once per release, even if it's published again.
+func CommentOnReleasedIssues(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.ReleaseEvent)
+	if !ok {
+		return context.NewError("chlog.CommentOnReleasedIssues: not a release event")
+	}
+
+	release := event.GetRelease()
+	if event.GetAction() != "published" || release.GetPrerelease() || release.GetDraft() {
+		return nil
+	}
+
+	owner, repo, tag := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), release.GetTagName()
+	previous, err := previousVersionTag(context, owner, repo, tag)
+	if err != nil {
+		return context.NewError("chlog.CommentOnReleasedIssues: couldn't find the release before %s on %s/%s: %v", tag, owner, repo, err)
+	}
+	if previous == "" {
+		context.Log("chlog.CommentOnReleasedIssues: no release before %s on %s/%s", tag, owner, repo)
+		return nil
+	}
+
+	prs, err := mergedPRsBetween(context, owner, repo, previous, tag)
+	if err != nil {
+		return context.NewError("chlog.CommentOnReleasedIssues: couldn't list the PRs in %s on %s/%s: %v", tag, owner, repo, err)
+	}
+
+	marker := releasedCommentMarker(tag)
+	body := fmt.Sprintf("%s\nThis was released in [%s](%s).", marker, tag, release.GetHTMLURL())
+	for _, number := range releasedItems(prs) {
+		commented, err := hasCommentContaining(context, owner, repo, number, marker)
+		if err != nil {
+			context.Log("chlog.CommentOnReleasedIssues: couldn't list comments on %s/%s#%d: %v", owner, repo, number, err)
+			continue
+		}
+		if commented {
+			continue
+		}
+		_, _, err = context.GitHub.Issues.CreateComment(context.Context(), owner, repo, number, &github.IssueComment{
+			Body: github.String(body),
+		})
+		if err != nil {
+			context.Log("chlog.CommentOnReleasedIssues: couldn't comment on %s/%s#%d: %v", owner, repo, number, err)
+		}
+	}
+	return nil
+}
+
+// releasedCommentMarker identifies the comment announcing the release.
+func releasedCommentMarker(tag string) string {
+	return fmt.Sprintf("<!-- released in %s -->", tag)
+}
+
+// releasedItems returns the PRs and the issues they closed, in order and
+// without duplicates.
+func releasedItems(prs []releaseNotesPR) []int {
+	items := []int{}
+	seen := map[int]bool{}
+	add := func(number int) {
+		if !seen[number] {
+			seen[number] = true
+			items = append(items, number)
+		}
+	}
+	for _, pr := range prs {
+		add(pr.number)
+		for _, issue := range labeler.LinkedIssues(pr.body) {
+			add(issue)
+		}
+	}
+	return items
+}
+
+// hasCommentContaining returns true if a comment on the issue or PR contains
+// the text.
+func hasCommentContaining(context *ctx.Context, owner, repo string, number int, text string) (bool, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := context.GitHub.Issues.ListComments(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return false, err
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), text) {
+				return true, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
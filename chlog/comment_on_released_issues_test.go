@@ -0,0 +1,118 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleasedItems(t *testing.T) {
+	assert.Equal(t, []int{3, 1, 2, 5}, releasedItems([]releaseNotesPR{
+		{number: 3, body: "Fixes #1. Closes #2"},
+		{number: 5, body: "Also fixes #1"},
+	}))
+}
+
+func TestCommentOnReleasedIssues(t *testing.T) {
+	comments := map[int][]string{
+		// Already told when the release was first published.
+		2: {releasedCommentMarker("v3.2.0") + "\nThis was released in v3.2.0."},
+	}
+
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "v3.2.0"}, {"name": "v3.1.0"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/compare/v3.1.0...v3.2.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commits": [{"commit": {"message": "Fix it (#3)"}}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 3, "merged": true, "body": "Fixes #1, fixes #2"}`)
+	})
+	for _, number := range []int{1, 2, 3} {
+		number := number
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d/comments", number), func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "POST" {
+				v := new(github.IssueComment)
+				json.NewDecoder(r.Body).Decode(v)
+				comments[number] = append(comments[number], v.GetBody())
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{}`)
+				return
+			}
+			existing := []*github.IssueComment{}
+			for _, body := range comments[number] {
+				existing = append(existing, &github.IssueComment{Body: github.String(body)})
+			}
+			json.NewEncoder(w).Encode(existing)
+		})
+	}
+
+	context := &ctx.Context{GitHub: client}
+
+	event := &github.ReleaseEvent{
+		Action: github.String("published"),
+		Repo:   &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+		Release: &github.RepositoryRelease{
+			TagName: github.String("v3.2.0"),
+			HTMLURL: github.String("https://github.com/o/r/releases/tag/v3.2.0"),
+		},
+	}
+	assert.NoError(t, CommentOnReleasedIssues(context, event))
+	assert.NoError(t, CommentOnReleasedIssues(context, event))
+
+	expected := releasedCommentMarker("v3.2.0") + "\nThis was released in [v3.2.0](https://github.com/o/r/releases/tag/v3.2.0)."
+	assert.Equal(t, []string{expected}, comments[1])
+	assert.Len(t, comments[2], 1)
+	assert.Equal(t, []string{expected}, comments[3])
+}
+
+func TestCommentOnReleasedIssuesInLargeReleases(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "v4.0.0"}, {"name": "v3.2.0"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/compare/v3.2.0...v4.0.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_commits": 251, "merge_base_commit": {"sha": "v3", "commit": {"committer": {"date": "2019-01-01T00:00:00Z"}}}, "commits": [
+			{"sha": "a", "commit": {"message": "Fix it (#3)"}}
+		]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"sha": "a", "commit": {"message": "Fix it (#3)"}},
+			{"sha": "b", "commit": {"message": "Fix that (#4)"}}
+		]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 3, "merged": true}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/4", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 4, "merged": true, "body": "Fixes #1"}`)
+	})
+	commented := []int{}
+	for _, number := range []int{1, 3, 4} {
+		number := number
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d/comments", number), func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "POST" {
+				commented = append(commented, number)
+			}
+			fmt.Fprint(w, `[]`)
+		})
+	}
+
+	context := &ctx.Context{GitHub: client}
+
+	assert.NoError(t, CommentOnReleasedIssues(context, &github.ReleaseEvent{
+		Action:  github.String("published"),
+		Repo:    &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+		Release: &github.RepositoryRelease{TagName: github.String("v4.0.0")},
+	}))
+	assert.Equal(t, []int{3, 4, 1}, commented)
+}
@@ -1,6 +1,8 @@
 package chlog
 
 import (
+	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
 
@@ -8,7 +10,9 @@ import (
 	"github.com/parkr/auto-reply/ctx"
 )
 
-var versionTagRegexp = regexp.MustCompile(`v(\d+\.\d+\.\d+)(\.pre\.(beta|rc)\d+)?`)
+// versionTagRegexp matches tags like "v3.2.0", "v4.0.0.pre.alpha1" and
+// "v4.0.0-rc.1".
+var versionTagRegexp = regexp.MustCompile(`\Av(` + gemVersionPattern + `)\z`)
 
 func CreateReleaseOnTagHandler(context *ctx.Context, payload interface{}) error {
 	create, ok := payload.(*github.CreateEvent)
@@ -25,49 +29,131 @@ func CreateReleaseOnTagHandler(context *ctx.Context, payload interface{}) error
 		return context.NewError("chlog.CreateReleaseOnTagHandler: not a version tag (%s)", *create.Ref)
 	}
 
-	isPreRelease := strings.Index(version, ".pre") >= 0
-	desiredRef := version
-	if isPreRelease {
-		// Working with a pre-release. Use HEAD.
-		desiredRef = "HEAD"
-	}
-
 	owner, name := *create.Repo.Owner.Login, *create.Repo.Name
+	if err := createRelease(context, owner, name, *create.Ref, ""); err != nil {
+		return context.NewError("chlog.CreateReleaseOnTagHandler: %v", err)
+	}
+	return nil
+}
 
-	// Read History.markdown, add line to appropriate change section
-	historyFileContents, _ := getHistoryContents(context, owner, name)
-	changes, err := parseChangelog(historyFileContents)
-	if err != nil {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: could not parse history file: %v", err)
+// createRelease creates the release for the version tag, unless it's been
+// created already. The commitish is what the tag is created at if it doesn't
+// exist yet; it's ignored if it does.
+func createRelease(context *ctx.Context, owner, name, tag, commitish string) error {
+	_, resp, err := context.GitHub.Repositories.GetReleaseByTag(context.Context(), owner, name, tag)
+	if err == nil {
+		context.Log("chlog.createRelease: %s/%s already has a release for %s", owner, name, tag)
+		return nil
 	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("couldn't check for a release for %s: %v", tag, err)
+	}
+
+	version := extractVersion(tag)
+	isPreRelease := isPrerelease(version)
 
-	versionLog := changes.GetVersion(desiredRef)
-	if versionLog == nil {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: no '%s' version in history file", desiredRef)
+	// Read the changes for this version from the changelog, falling back to
+	// the PRs merged since the previous version. Pre-releases without their
+	// own section use the unreleased changes.
+	head := tag
+	if commitish != "" {
+		head = commitish
+	}
+	releaseBodyForVersion, err := releaseNotesFor(context, owner, name, version)
+	if isPreRelease && (err != nil || strings.TrimSpace(releaseBodyForVersion) == "") {
+		releaseBodyForVersion, err = releaseNotesFor(context, owner, name, "HEAD")
+	}
+	if err != nil || strings.TrimSpace(releaseBodyForVersion) == "" {
+		context.Log("chlog.createRelease: no changelog for %s, generating release notes: %v", tag, err)
+		releaseBodyForVersion, err = generateReleaseNotesForTag(context, owner, name, tag, head)
+		if err != nil {
+			return fmt.Errorf("couldn't generate release notes: %v", err)
+		}
 	}
 
-	releaseBodyForVersion := strings.Join(strings.SplitN(versionLog.String(), "\n\n", 2)[1:], "\n")
+	release := &github.RepositoryRelease{
+		TagName:    github.String(tag),
+		Name:       github.String(tag),
+		Body:       github.String(releaseBodyForVersion),
+		Draft:      github.Bool(isPreRelease && draftPrereleases[owner+"/"+name]),
+		Prerelease: github.Bool(isPreRelease),
+	}
+	if commitish != "" {
+		release.TargetCommitish = github.String(commitish)
+	}
 
-	_, _, err = context.GitHub.Repositories.CreateRelease(
-		context.Context(),
-		owner, name,
-		&github.RepositoryRelease{
-			TagName:    create.Ref,
-			Name:       create.Ref,
-			Body:       github.String(releaseBodyForVersion),
-			Draft:      github.Bool(false),
-			Prerelease: github.Bool(isPreRelease),
-		})
+	// A release whose gem says it's another version is held back.
+	path, fileVersion, err := versionFileMismatch(context, owner, name, head, version)
 	if err != nil {
-		context.NewError("chlog.CreateReleaseOnTagHandler: error creating release: %v", err)
+		return fmt.Errorf("couldn't check the version file: %v", err)
+	}
+	if fileVersion != "" {
+		context.Log("chlog.createRelease: %s says %s, not %s, creating a draft", path, fileVersion, version)
+		release.Draft = github.Bool(true)
+	}
+
+	if _, _, err := context.GitHub.Repositories.CreateRelease(context.Context(), owner, name, release); err != nil {
+		return fmt.Errorf("error creating release: %v", err)
 	}
 
+	if fileVersion != "" {
+		if err := reportVersionFileMismatch(context, owner, name, tag, path, fileVersion); err != nil {
+			return fmt.Errorf("couldn't file an issue about %s: %v", path, err)
+		}
+	}
 	return nil
 }
 
 func extractVersion(tag string) string {
-	if versionTagRegexp.MatchString(tag) {
-		return strings.Replace(tag, "v", "", 1)
+	if matches := versionTagRegexp.FindStringSubmatch(tag); matches != nil {
+		return matches[1]
 	}
 	return ""
 }
+
+// generateReleaseNotesForTag lists the PRs merged between the previous
+// version tag and head, which is the tag itself unless it's yet to be
+// created.
+func generateReleaseNotesForTag(context *ctx.Context, owner, repo, tag, head string) (string, error) {
+	previous, err := previousVersionTag(context, owner, repo, tag)
+	if err != nil {
+		return "", err
+	}
+	if previous == "" {
+		return "", fmt.Errorf("no version tag before %s to compare with", tag)
+	}
+	return GenerateReleaseNotes(context, owner, repo, previous, head)
+}
+
+// previousVersionTag returns the tag of the latest version before the
+// tag's, or an empty string if there isn't one. Releases are compared with
+// the previous release rather than any pre-releases in between.
+func previousVersionTag(context *ctx.Context, owner, repo, tag string) (string, error) {
+	version := extractVersion(tag)
+	isPreRelease := isPrerelease(version)
+	previous, previousVersion := "", ""
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		tags, resp, err := context.GitHub.Repositories.ListTags(context.Context(), owner, repo, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, candidate := range tags {
+			candidateVersion := extractVersion(candidate.GetName())
+			if candidateVersion == "" || compareVersions(candidateVersion, version) >= 0 {
+				continue
+			}
+			if !isPreRelease && isPrerelease(candidateVersion) {
+				continue
+			}
+			if previousVersion == "" || compareVersions(candidateVersion, previousVersion) > 0 {
+				previous, previousVersion = candidate.GetName(), candidateVersion
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return previous, nil
+}
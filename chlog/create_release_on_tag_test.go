@@ -1,7 +1,15 @@
 package chlog
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestVersionTagRegexpMatchString(t *testing.T) {
@@ -33,3 +41,126 @@ func TestExtractVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"3.2.0", "3.2.0", 0},
+		{"3.2.0", "3.10.0", -1},
+		{"4.0.0", "3.10.0", 1},
+		{"3.2.0.pre.beta1", "3.2.0", -1},
+		{"3.2.0", "3.2.0.pre.rc1", 1},
+		{"3.2.0.pre.beta1", "3.2.0.pre.rc1", -1},
+		{"3.2.0.1", "3.2.0", 1},
+	}
+	for _, c := range cases {
+		if actual := compareVersions(c.a, c.b); actual != c.expected {
+			t.Fatalf("compareVersions expected '%v' but got '%v' for `%s` and `%s`", c.expected, actual, c.a, c.b)
+		}
+	}
+}
+
+func TestPreviousVersionTag(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "v3.10.0"}, {"name": "v3.9.0"}, {"name": "v3.9.1.pre.beta1"}, {"name": "v3.8.7"}, {"name": "lgtm"}]`)
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	for tag, expected := range map[string]string{"v3.10.0": "v3.9.0", "v3.9.1.pre.beta2": "v3.9.1.pre.beta1", "v3.9.0": "v3.8.7", "v3.8.7": ""} {
+		previous, err := previousVersionTag(context, "o", "r", tag)
+		if err != nil {
+			t.Fatalf("previousVersionTag returned an error for `%s`: %v", tag, err)
+		}
+		if previous != expected {
+			t.Fatalf("previousVersionTag expected '%v' but got '%v' for `%s`", expected, previous, tag)
+		}
+	}
+}
+
+func TestCreateReleaseOnTagForFragments(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	assert.NoError(t, SetChangelogConfig("o", "fragments", ChangelogConfig{Format: FragmentsFormat}))
+	SetVersionFile("o", "fragments", "")
+
+	files := map[string]string{
+		"12.md": newFragment("Bug Fixes", "Fix it", 12),
+		"9.md":  newFragment("none", "Tweak it", 9),
+	}
+	serveFragments(t, "o/fragments", files)
+	mux.HandleFunc("/repos/o/fragments/git/refs/heads/master", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref": "refs/heads/master", "object": {"sha": "base"}}`)
+	})
+	mux.HandleFunc("/repos/o/fragments/git/commits/base", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "base", "tree": {"sha": "base-tree"}}`)
+	})
+	mux.HandleFunc("/repos/o/fragments/git/trees/master:changelog.d", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "old", "tree": [
+			{"path": "12.md", "mode": "100644", "type": "blob", "sha": "a"},
+			{"path": "9.md", "mode": "100644", "type": "blob", "sha": "c"}
+		]}`)
+	})
+	mux.HandleFunc("/repos/o/fragments/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			BaseTree string             `json:"base_tree"`
+			Entries  []github.TreeEntry `json:"tree"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.BaseTree != "" {
+			fmt.Fprint(w, `{"sha": "release-tree"}`)
+			return
+		}
+		// Merge the release PR by replacing the served files with the
+		// changelog's new tree.
+		for name := range files {
+			delete(files, name)
+		}
+		for _, entry := range body.Entries {
+			files[entry.GetPath()] = entry.GetContent()
+		}
+		fmt.Fprint(w, `{"sha": "changelog-tree"}`)
+	})
+	mux.HandleFunc("/repos/o/fragments/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "release-commit"}`)
+	})
+	mux.HandleFunc("/repos/o/fragments/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/o/fragments/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 13}`)
+	})
+	mux.HandleFunc("/repos/o/fragments/releases/tags/v4.1.0", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	var release *github.RepositoryRelease
+	mux.HandleFunc("/repos/o/fragments/releases", func(w http.ResponseWriter, r *http.Request) {
+		release = new(github.RepositoryRelease)
+		json.NewDecoder(r.Body).Decode(release)
+		fmt.Fprint(w, `{}`)
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	_, err := OpenReleasePR(context, "o", "fragments", "4.1.0", 0, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Contains(t, files, "4.1.0.md")
+
+	assert.NoError(t, CreateReleaseOnTagHandler(context, &github.CreateEvent{
+		Ref:     github.String("v4.1.0"),
+		RefType: github.String("tag"),
+		Repo: &github.Repository{
+			Name:  github.String("fragments"),
+			Owner: &github.User{Login: github.String("o")},
+		},
+	}))
+	if assert.NotNil(t, release) {
+		assert.Equal(t, "v4.1.0", release.GetTagName())
+		assert.Equal(t, "  * Tweak it (#9)\n\n### Bug Fixes\n\n  * Fix it (#12)\n", release.GetBody())
+	}
+}
@@ -0,0 +1,197 @@
+package chlog
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// fragmentsChangelog is a directory of release notes with one fragment file
+// per merged PR, named after its number, e.g. "changelog.d/123.md". A
+// fragment holds the PR's line, under a "### Section" heading if it has one.
+//
+// Fragments are the unreleased changes. Cutting a version compiles them into
+// a file named after the version, e.g. "changelog.d/4.1.0.md", and removes
+// them.
+type fragmentsChangelog struct {
+	ChangelogConfig
+}
+
+func (c fragmentsChangelog) addChange(context *ctx.Context, owner, repo string, number int, section, title string) error {
+	return commitFile(context, owner, repo, c.fragmentPath(number), c.Branch, "",
+		newFragment(section, title, number),
+		fmt.Sprintf("Add release note for #%d [ci skip]", number))
+}
+
+func (c fragmentsChangelog) fragmentPath(number int) string {
+	return path.Join(c.Path, fmt.Sprintf("%d.md", number))
+}
+
+func (c fragmentsChangelog) versionPath(version string) string {
+	return path.Join(c.Path, version+".md")
+}
+
+// releaseNotes joins the fragments for "HEAD", and reads the version's file
+// for any other version.
+func (c fragmentsChangelog) releaseNotes(context *ctx.Context, owner, repo, version string) (string, error) {
+	opts := &github.RepositoryContentGetOptions{Ref: "heads/" + c.Branch}
+	if version != "HEAD" {
+		file, _, resp, err := context.GitHub.Repositories.GetContents(context.Context(), owner, repo, c.versionPath(version), opts)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", fmt.Errorf("%s has no notes for %s", c.Path, version)
+		}
+		if err != nil {
+			return "", err
+		}
+		return file.GetContent()
+	}
+
+	_, entries, resp, err := context.GitHub.Repositories.GetContents(context.Context(), owner, repo, c.Path, opts)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	fragments := map[int]string{}
+	for _, entry := range entries {
+		number, ok := fragmentNumber(entry)
+		if !ok {
+			continue
+		}
+		file, _, _, err := context.GitHub.Repositories.GetContents(context.Context(), owner, repo, entry.GetPath(), opts)
+		if err != nil {
+			return "", err
+		}
+		fragments[number], err = file.GetContent()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return joinFragments(fragments), nil
+}
+
+// cutVersion compiles the fragments into the version's file and removes
+// them, so the next version doesn't repeat them. The directory is replaced
+// by a tree of the version's file and everything else in it.
+func (c fragmentsChangelog) cutVersion(context *ctx.Context, owner, repo, version, date string) (*github.TreeEntry, error) {
+	tree, resp, err := context.GitHub.Git.GetTree(context.Context(), owner, repo, c.Branch+":"+c.Path, false)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kept := []github.TreeEntry{}
+	for _, entry := range tree.Entries {
+		if _, ok := fragmentFileNumber(entry.GetType() == "blob", entry.GetPath()); ok {
+			continue
+		}
+		kept = append(kept, github.TreeEntry{Path: entry.Path, Mode: entry.Mode, Type: entry.Type, SHA: entry.SHA})
+	}
+	if len(kept) == len(tree.Entries) {
+		return nil, nil
+	}
+
+	notes, err := c.releaseNotes(context, owner, repo, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	kept = append(kept, github.TreeEntry{
+		Path:    github.String(path.Base(c.versionPath(version))),
+		Mode:    github.String("100644"),
+		Type:    github.String("blob"),
+		Content: github.String(notes),
+	})
+
+	newTree, _, err := context.GitHub.Git.CreateTree(context.Context(), owner, repo, "", kept)
+	if err != nil {
+		return nil, err
+	}
+	return &github.TreeEntry{
+		Path: github.String(c.Path),
+		Mode: github.String("040000"),
+		Type: github.String("tree"),
+		SHA:  newTree.SHA,
+	}, nil
+}
+
+// fragmentNumber returns the PR number of a fragment file.
+func fragmentNumber(entry *github.RepositoryContent) (int, bool) {
+	return fragmentFileNumber(entry.GetType() == "file", entry.GetName())
+}
+
+// fragmentFileNumber returns the PR number of a fragment, given whether it's
+// a file and its name.
+func fragmentFileNumber(isFile bool, name string) (int, bool) {
+	if !isFile || path.Ext(name) != ".md" {
+		return 0, false
+	}
+	number, err := strconv.Atoi(strings.TrimSuffix(name, ".md"))
+	return number, err == nil
+}
+
+func newFragment(section, title string, number int) string {
+	line := fmt.Sprintf("  * %s (#%d)\n", template.HTMLEscapeString(title), number)
+	if section == "none" || section == "" {
+		return line
+	}
+	return fmt.Sprintf("### %s\n\n%s", section, line)
+}
+
+// joinFragments combines the fragments, keyed by PR number, into release
+// notes. Lines without a section come first, then each section in the order
+// it's first used.
+func joinFragments(fragments map[int]string) string {
+	numbers := []int{}
+	for number := range fragments {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	sections := []string{""}
+	seen := map[string]bool{"": true}
+	lines := map[string][]string{}
+	for _, number := range numbers {
+		section := ""
+		for _, line := range strings.Split(fragments[number], "\n") {
+			if strings.HasPrefix(line, "### ") {
+				section = strings.TrimSpace(strings.TrimPrefix(line, "### "))
+				if !seen[section] {
+					seen[section] = true
+					sections = append(sections, section)
+				}
+				continue
+			}
+			if strings.TrimSpace(line) != "" {
+				lines[section] = append(lines[section], line)
+			}
+		}
+	}
+
+	var notes bytes.Buffer
+	for _, section := range sections {
+		if len(lines[section]) == 0 {
+			continue
+		}
+		if notes.Len() > 0 {
+			notes.WriteString("\n")
+		}
+		if section != "" {
+			fmt.Fprintf(&notes, "### %s\n\n", section)
+		}
+		notes.WriteString(strings.Join(lines[section], "\n") + "\n")
+	}
+	return notes.String()
+}
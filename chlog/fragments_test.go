@@ -0,0 +1,192 @@
+package chlog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFragment(t *testing.T) {
+	assert.Equal(t, "  * Fix &lt;it&gt; (#2)\n", newFragment("none", "Fix <it>", 2))
+	assert.Equal(t, "### Bug Fixes\n\n  * Fix it (#2)\n", newFragment("Bug Fixes", "Fix it", 2))
+}
+
+func TestJoinFragments(t *testing.T) {
+	assert.Equal(t, "", joinFragments(map[int]string{}))
+	assert.Equal(t,
+		"  * Tweak it (#4)\n\n### Bug Fixes\n\n  * Fix it (#2)\n  * Fix it again (#3)\n\n### Site Enhancements\n\n  * Document it (#7)\n",
+		joinFragments(map[int]string{
+			7: newFragment("Site Enhancements", "Document it", 7),
+			3: newFragment("Bug Fixes", "Fix it again", 3),
+			4: newFragment("none", "Tweak it", 4),
+			2: newFragment("Bug Fixes", "Fix it", 2),
+		}))
+}
+
+// serveFragments serves the files, keyed by name, as the repo's
+// "changelog.d" directory on master. The files are read on each request, so
+// files added later are served too.
+func serveFragments(t *testing.T, repo string, files map[string]string) {
+	mux.HandleFunc("/repos/"+repo+"/contents/changelog.d", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "heads/master", r.URL.Query().Get("ref"))
+		entries := []*github.RepositoryContent{}
+		for name := range files {
+			entries = append(entries, &github.RepositoryContent{
+				Type: github.String("file"),
+				Name: github.String(name),
+				Path: github.String("changelog.d/" + name),
+			})
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	mux.HandleFunc("/repos/"+repo+"/contents/changelog.d/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "heads/master", r.URL.Query().Get("ref"))
+		contents, ok := files[strings.TrimPrefix(r.URL.Path, "/repos/"+repo+"/contents/changelog.d/")]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(contents))),
+		})
+	})
+}
+
+func TestFragmentsReleaseNotes(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	serveFragments(t, "o/r", map[string]string{
+		"12.md":     newFragment("Bug Fixes", "Fix it", 12),
+		"README.md": "Add a release note here.\n",
+		"9.md":      newFragment("none", "Tweak it", 9),
+		"4.0.0.md":  "  * Release it (#1)\n",
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	changelog := fragmentsChangelog{ChangelogConfig{Format: FragmentsFormat, Path: "changelog.d", Branch: "master"}}
+	notes, err := changelog.releaseNotes(context, "o", "r", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "  * Tweak it (#9)\n\n### Bug Fixes\n\n  * Fix it (#12)\n", notes)
+
+	notes, err = changelog.releaseNotes(context, "o", "r", "4.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "  * Release it (#1)\n", notes)
+
+	_, err = changelog.releaseNotes(context, "o", "r", "4.1.0")
+	assert.Error(t, err)
+}
+
+func TestFragmentsCutVersion(t *testing.T) {
+	cases := []struct {
+		entries  string
+		expected []github.TreeEntry
+	}{
+		{
+			`[
+				{"path": "12.md", "mode": "100644", "type": "blob", "sha": "a"},
+				{"path": "README.md", "mode": "100644", "type": "blob", "sha": "b"},
+				{"path": "9.md", "mode": "100644", "type": "blob", "sha": "c"}
+			]`,
+			[]github.TreeEntry{
+				{Path: github.String("README.md"), Mode: github.String("100644"), Type: github.String("blob"), SHA: github.String("b")},
+				{Path: github.String("4.1.0.md"), Mode: github.String("100644"), Type: github.String("blob"), Content: github.String("  * Tweak it (#9)\n\n### Bug Fixes\n\n  * Fix it (#12)\n")},
+			},
+		},
+		{
+			`[{"path": "README.md", "mode": "100644", "type": "blob", "sha": "b"}]`,
+			nil,
+		},
+	}
+	for _, c := range cases {
+		var created []github.TreeEntry
+		setup() // server & client!
+		serveFragments(t, "o/r", map[string]string{
+			"12.md":     newFragment("Bug Fixes", "Fix it", 12),
+			"README.md": "Add a release note here.\n",
+			"9.md":      newFragment("none", "Tweak it", 9),
+		})
+		mux.HandleFunc("/repos/o/r/git/trees/master:changelog.d", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"sha": "old", "tree": %s}`, c.entries)
+		})
+		mux.HandleFunc("/repos/o/r/git/trees", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				BaseTree string             `json:"base_tree"`
+				Entries  []github.TreeEntry `json:"tree"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			assert.Equal(t, "", body.BaseTree)
+			created = body.Entries
+			fmt.Fprint(w, `{"sha": "new"}`)
+		})
+
+		context := &ctx.Context{GitHub: client}
+
+		changelog := fragmentsChangelog{ChangelogConfig{Format: FragmentsFormat, Path: "changelog.d", Branch: "master"}}
+		entry, err := changelog.cutVersion(context, "o", "r", "4.1.0", "2019-01-01")
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, created)
+		if c.expected == nil {
+			assert.Nil(t, entry)
+		} else if assert.NotNil(t, entry) {
+			assert.Equal(t, "changelog.d", entry.GetPath())
+			assert.Equal(t, "tree", entry.GetType())
+			assert.Equal(t, "new", entry.GetSHA())
+		}
+		teardown()
+	}
+}
+
+func TestFragmentsCutVersionKeepsItsNotes(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	files := map[string]string{
+		"12.md": newFragment("Bug Fixes", "Fix it", 12),
+		"9.md":  newFragment("none", "Tweak it", 9),
+	}
+	serveFragments(t, "o/r", files)
+	mux.HandleFunc("/repos/o/r/git/trees/master:changelog.d", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "old", "tree": [
+			{"path": "12.md", "mode": "100644", "type": "blob", "sha": "a"},
+			{"path": "9.md", "mode": "100644", "type": "blob", "sha": "c"}
+		]}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Entries []github.TreeEntry `json:"tree"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		// Commit the new tree by replacing the served files with it.
+		for name := range files {
+			delete(files, name)
+		}
+		for _, entry := range body.Entries {
+			files[entry.GetPath()] = entry.GetContent()
+		}
+		fmt.Fprint(w, `{"sha": "new"}`)
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	changelog := fragmentsChangelog{ChangelogConfig{Format: FragmentsFormat, Path: "changelog.d", Branch: "master"}}
+	_, err := changelog.cutVersion(context, "o", "r", "4.1.0", "2019-01-01")
+	assert.NoError(t, err)
+
+	notes, err := changelog.releaseNotes(context, "o", "r", "4.1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "  * Tweak it (#9)\n\n### Bug Fixes\n\n  * Fix it (#12)\n", notes)
+
+	notes, err = changelog.releaseNotes(context, "o", "r", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "", notes)
+}
@@ -0,0 +1,176 @@
+package chlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	keepAChangelogVersionRegexp = regexp.MustCompile(`^## \[?([^\]\s]+)\]?`)
+	keepAChangelogLinkRegexp    = regexp.MustCompile(`^\[[^\]]+\]: `)
+	// keepAChangelogUnreleasedLinkRegexp matches the link comparing the
+	// latest release with the unreleased changes.
+	keepAChangelogUnreleasedLinkRegexp = regexp.MustCompile(`^\[Unreleased\]: (.*/compare/)(\S+)\.\.\.HEAD$`)
+
+	// keepAChangelogTypes are the kinds of change Keep a Changelog groups
+	// each version's changes by.
+	keepAChangelogTypes = []string{"Added", "Changed", "Deprecated", "Removed", "Fixed", "Security"}
+)
+
+// keepAChangelog is the https://keepachangelog.com format. Changes are filed
+// under "### Added", "### Fixed" and so on beneath "## [Unreleased]".
+type keepAChangelog struct{}
+
+// keepAChangelogType maps a changelog section onto a Keep a Changelog type.
+// Repos can name their category sections after the types to choose freely.
+func keepAChangelogType(section string) string {
+	for _, changeType := range keepAChangelogTypes {
+		if strings.EqualFold(section, changeType) {
+			return changeType
+		}
+	}
+	switch section {
+	case "Major Enhancements":
+		return "Added"
+	case "Bug Fixes", "Development Fixes":
+		return "Fixed"
+	default:
+		return "Changed"
+	}
+}
+
+func isUnreleased(version string) bool {
+	return version == "HEAD" || strings.EqualFold(version, "Unreleased")
+}
+
+// versionBlock returns the indices of the version's "## " heading and of
+// the line after its last, or -1 if there's no such version.
+func (keepAChangelog) versionBlock(lines []string, version string) (start, end int) {
+	start = -1
+	for i, line := range lines {
+		matches := keepAChangelogVersionRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if matches[1] == version || (isUnreleased(version) && isUnreleased(matches[1])) {
+			start = i
+		}
+	}
+	return start, len(lines)
+}
+
+func (k keepAChangelog) addChange(contents, section, title string, number int) (string, error) {
+	if strings.TrimSpace(contents) == "" {
+		contents = "# Changelog\n\n## [Unreleased]\n"
+	}
+	lines := strings.Split(strings.TrimRight(contents, "\n"), "\n")
+
+	start, end := k.versionBlock(lines, "HEAD")
+	if start < 0 {
+		// Unreleased changes go above the latest release.
+		latest := len(lines)
+		for i, line := range lines {
+			if keepAChangelogVersionRegexp.MatchString(line) {
+				latest = i
+				break
+			}
+		}
+		if latest < len(lines) {
+			lines = insertLines(lines, latest, "## [Unreleased]", "")
+		} else {
+			lines = append(lines, "", "## [Unreleased]")
+		}
+		start, end = k.versionBlock(lines, "HEAD")
+	}
+
+	entry := fmt.Sprintf("- %s (#%d)", template.HTMLEscapeString(title), number)
+	heading := "### " + keepAChangelogType(section)
+
+	// Add the entry after the last one under the heading, if there is one.
+	for i := start + 1; i < end; i++ {
+		if lines[i] != heading {
+			continue
+		}
+		last := i
+		for j := i + 1; j < end && !strings.HasPrefix(lines[j], "#"); j++ {
+			if strings.TrimSpace(lines[j]) != "" {
+				last = j
+			}
+		}
+		if last == i {
+			return joinLines(insertLines(lines, last+1, "", entry)), nil
+		}
+		return joinLines(insertLines(lines, last+1, entry)), nil
+	}
+
+	// Otherwise, start a new heading at the end of the unreleased changes.
+	last := end
+	for last > start+1 && strings.TrimSpace(lines[last-1]) == "" {
+		last--
+	}
+	if last == end && end < len(lines) {
+		return joinLines(insertLines(lines, last, "", heading, "", entry, "")), nil
+	}
+	return joinLines(insertLines(lines, last, "", heading, "", entry)), nil
+}
+
+func (k keepAChangelog) versionNotes(contents, version string) (string, error) {
+	lines := strings.Split(strings.Replace(contents, "\r\n", "\n", -1), "\n")
+	start, end := k.versionBlock(lines, version)
+	if start < 0 {
+		return "", fmt.Errorf("no '%s' version in changelog", version)
+	}
+
+	notes := []string{}
+	for _, line := range lines[start+1 : end] {
+		if !keepAChangelogLinkRegexp.MatchString(line) {
+			notes = append(notes, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(notes, "\n")), nil
+}
+
+// cutVersion renames "## [Unreleased]" to the version and starts a new,
+// empty unreleased section above it. The "[Unreleased]" compare link, if
+// there is one, is moved along with it.
+func (k keepAChangelog) cutVersion(contents, version, date string) (string, error) {
+	lines := strings.Split(strings.TrimRight(strings.Replace(contents, "\r\n", "\n", -1), "\n"), "\n")
+	if start, _ := k.versionBlock(lines, version); start >= 0 {
+		return "", fmt.Errorf("changelog already has a '%s' version", version)
+	}
+	start, _ := k.versionBlock(lines, "HEAD")
+	if start < 0 {
+		return "", fmt.Errorf("no 'Unreleased' version in changelog")
+	}
+
+	lines[start] = fmt.Sprintf("## [%s] - %s", version, date)
+	lines = insertLines(lines, start, "## [Unreleased]", "")
+
+	for i, line := range lines {
+		matches := keepAChangelogUnreleasedLinkRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		lines[i] = fmt.Sprintf("[Unreleased]: %sv%s...HEAD", matches[1], version)
+		lines = insertLines(lines, i+1, fmt.Sprintf("[%s]: %s%s...v%s", version, matches[1], matches[2], version))
+		break
+	}
+	return joinLines(lines), nil
+}
+
+// insertLines inserts the new lines before index i.
+func insertLines(lines []string, i int, newLines ...string) []string {
+	result := make([]string, 0, len(lines)+len(newLines))
+	result = append(result, lines[:i]...)
+	result = append(result, newLines...)
+	return append(result, lines[i:]...)
+}
+
+func joinLines(lines []string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
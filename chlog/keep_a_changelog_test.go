@@ -0,0 +1,109 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const keepAChangelogFixture = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+## [Unreleased]
+
+### Added
+
+- Add a thing (#3)
+
+## [1.0.0] - 2018-01-01
+
+### Fixed
+
+- Fix a bug (#1)
+
+[Unreleased]: https://github.com/o/r/compare/v1.0.0...HEAD
+[1.0.0]: https://github.com/o/r/releases/tag/v1.0.0
+`
+
+func TestKeepAChangelogType(t *testing.T) {
+	assert.Equal(t, "Added", keepAChangelogType("Major Enhancements"))
+	assert.Equal(t, "Fixed", keepAChangelogType("Bug Fixes"))
+	assert.Equal(t, "Security", keepAChangelogType("security"))
+	assert.Equal(t, "Changed", keepAChangelogType("Minor Enhancements"))
+	assert.Equal(t, "Changed", keepAChangelogType("none"))
+}
+
+func TestKeepAChangelogAddChange(t *testing.T) {
+	cases := []struct {
+		contents, section, expected string
+	}{
+		{"", "Bug Fixes", "# Changelog\n\n## [Unreleased]\n\n### Fixed\n\n- Title (#5)\n"},
+		{
+			keepAChangelogFixture, "Major Enhancements",
+			"# Changelog\n\nAll notable changes to this project will be documented in this file.\n\n" +
+				"## [Unreleased]\n\n### Added\n\n- Add a thing (#3)\n- Title (#5)\n\n## [1.0.0] - 2018-01-01\n",
+		},
+		{
+			keepAChangelogFixture, "Bug Fixes",
+			"# Changelog\n\nAll notable changes to this project will be documented in this file.\n\n" +
+				"## [Unreleased]\n\n### Added\n\n- Add a thing (#3)\n\n### Fixed\n\n- Title (#5)\n\n## [1.0.0] - 2018-01-01\n",
+		},
+		{
+			"# Changelog\n\n## [1.0.0] - 2018-01-01\n\n- Initial release\n", "none",
+			"# Changelog\n\n## [Unreleased]\n\n### Changed\n\n- Title (#5)\n\n## [1.0.0] - 2018-01-01\n",
+		},
+		{
+			"# Changelog\n", "none",
+			"# Changelog\n\n## [Unreleased]\n\n### Changed\n\n- Title (#5)\n",
+		},
+	}
+	for _, c := range cases {
+		actual, err := keepAChangelog{}.addChange(c.contents, c.section, "Title", 5)
+		assert.NoError(t, err)
+		assert.Contains(t, actual, c.expected, "adding to %q", c.contents)
+	}
+}
+
+func TestKeepAChangelogVersionNotes(t *testing.T) {
+	notes, err := keepAChangelog{}.versionNotes(keepAChangelogFixture, "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "### Added\n\n- Add a thing (#3)", notes)
+
+	notes, err = keepAChangelog{}.versionNotes(keepAChangelogFixture, "1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "### Fixed\n\n- Fix a bug (#1)", notes)
+
+	_, err = keepAChangelog{}.versionNotes(keepAChangelogFixture, "2.0.0")
+	assert.Error(t, err)
+}
+
+func TestKeepAChangelogCutVersion(t *testing.T) {
+	cut, err := keepAChangelog{}.cutVersion(keepAChangelogFixture, "1.1.0", "2018-02-01")
+	assert.NoError(t, err)
+	assert.Equal(t, `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+## [Unreleased]
+
+## [1.1.0] - 2018-02-01
+
+### Added
+
+- Add a thing (#3)
+
+## [1.0.0] - 2018-01-01
+
+### Fixed
+
+- Fix a bug (#1)
+
+[Unreleased]: https://github.com/o/r/compare/v1.1.0...HEAD
+[1.1.0]: https://github.com/o/r/compare/v1.0.0...v1.1.0
+[1.0.0]: https://github.com/o/r/releases/tag/v1.0.0
+`, cut)
+
+	_, err = keepAChangelog{}.cutVersion(keepAChangelogFixture, "1.0.0", "2018-02-01")
+	assert.Error(t, err)
+}
@@ -2,7 +2,6 @@ package chlog
 
 import (
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -12,123 +11,116 @@ import (
 	"text/template"
 
 	"github.com/google/go-github/github"
-	"github.com/parkr/auto-reply/auth"
+	"github.com/parkr/auto-reply/commands"
 	"github.com/parkr/auto-reply/ctx"
 	"github.com/parkr/changelog"
 )
 
-// changelogCategory is a changelog category, like "Site Enhancements" and such.
-type changelogCategory struct {
-	Prefix, Slug, Section string
-	Labels                []string
-}
+// mergeCommandName is the merge command's verb.
+const mergeCommandName = "merge"
 
 var (
-	mergeCommentRegexp = regexp.MustCompile("@[a-zA-Z-_]+: (merge|:shipit:|:ship:)( \\+([a-zA-Z-_ ]+))?")
-	mergeOptions       = &github.PullRequestOptions{MergeMethod: "squash"}
-
-	categories = []changelogCategory{
-		{
-			Prefix:  "major",
-			Slug:    "major-enhancements",
-			Section: "Major Enhancements",
-			Labels:  []string{"feature"},
-		},
-		{
-			Prefix:  "minor",
-			Slug:    "minor-enhancements",
-			Section: "Minor Enhancements",
-			Labels:  []string{"enhancement"},
-		},
-		{
-			Prefix:  "bug",
-			Slug:    "bug-fixes",
-			Section: "Bug Fixes",
-			Labels:  []string{"bug", "fix"},
-		},
-		{
-			Prefix:  "fix",
-			Slug:    "fix",
-			Section: "Bug Fixes",
-			Labels:  []string{"bug", "fix"},
-		},
-		{
-			Prefix:  "dev",
-			Slug:    "development-fixes",
-			Section: "Development Fixes",
-			Labels:  []string{"internal", "fix"},
-		},
-		{
-			Prefix:  "doc",
-			Slug:    "documentation",
-			Section: "Documentation",
-			Labels:  []string{"documentation"},
-		},
-		{
-			Prefix:  "port",
-			Slug:    "forward-ports",
-			Section: "Forward Ports",
-			Labels:  []string{"forward-port"},
-		},
-		{
-			Prefix:  "site",
-			Slug:    "site-enhancements",
-			Section: "Site Enhancements",
-			Labels:  []string{"documentation"},
-		},
-	}
+	mergeLabelArgRegexp = regexp.MustCompile("\\+([a-zA-Z-_ ]+)")
+	autoMergeArgsRegexp = regexp.MustCompile("\\Awhen (ready|green)\\b")
+	mergeFlagRegexp     = regexp.MustCompile("(^|\\s)--([a-zA-Z-]+)")
 )
 
-func MergeAndLabel(context *ctx.Context, payload interface{}) error {
-	event, ok := payload.(*github.IssueCommentEvent)
-	if !ok {
-		return context.NewError("MergeAndLabel: not an issue comment event")
+// MergeCommand merges a PR and files it under a changelog category with
+// "@jekyllbot: merge (+category)". With "@jekyllbot: merge when ready", the
+// PR is merged once its statuses and checks are green.
+var MergeCommand = &commands.Command{
+	Name:            mergeCommandName,
+	Aliases:         []string{":shipit:", ":ship:"},
+	Usage:           "merge [when ready] [+category] [--merge|--squash|--rebase]",
+	Description:     "Merges the pull request and adds it to the changelog under the category, e.g. `+bug`. With `when ready`, waits for approval and CI first. The merge method defaults to the repo's.",
+	Permission:      commands.Push,
+	PullRequestOnly: true,
+	Run:             runMergeCommand,
+}
+
+func runMergeCommand(context *ctx.Context, invocation *commands.Invocation) error {
+	if os.Getenv("AUTO_REPLY_DEBUG") == "true" {
+		log.Println("MergeCommand: received invocation:", invocation)
 	}
 
-	// Is this a pull request?
-	if event.Issue == nil || event.Issue.PullRequestLinks == nil {
-		return context.NewError("MergeAndLabel: not a pull request")
+	categories := categoriesFor(invocation.Owner, invocation.Repo)
+	request, err := parseMergeArgs(invocation.Args, categories)
+	if err != nil {
+		return err
+	}
+
+	method, err := mergeConfigFor(invocation.Owner, invocation.Repo).resolve(request.method)
+	if err != nil {
+		return err
 	}
 
-	var changeSectionLabel string
-	isReq, labelFromComment := parseMergeRequestComment(*event.Comment.Body)
+	// Should it be labeled?
+	changeSectionLabel := changeSectionLabelFor(request.label, categories)
 
-	// Is It a merge request comment?
-	if !isReq {
-		return context.NewError("MergeAndLabel: not a merge request comment")
+	if request.autoMerge {
+		return requestAutoMerge(context, invocation.Owner, invocation.Repo, invocation.Number, invocation.Author, changeSectionLabel, method)
 	}
 
-	if os.Getenv("AUTO_REPLY_DEBUG") == "true" {
-		log.Println("MergeAndLabel: received event:", event)
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), invocation.Owner, invocation.Repo, invocation.Number)
+	if err != nil {
+		return err
+	}
+	if err := preflight(context, invocation.Owner, invocation.Repo, pr, preflightConfigFor(invocation.Owner, invocation.Repo)); err != nil {
+		return err
 	}
 
-	var wg sync.WaitGroup
+	// Merges are made one at a time, in the order they were requested.
+	enqueueMerge(context, invocation.Owner, invocation.Repo, &queuedMerge{
+		number:             invocation.Number,
+		changeSectionLabel: changeSectionLabel,
+		method:             method,
+		sha:                pr.GetHead().GetSHA(),
+	})
+	return nil
+}
 
-	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number
-	ref := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+// mergeRequest is what the merge command was asked to do.
+type mergeRequest struct {
+	autoMerge bool
+	// label is the normalized changelog category, if any.
+	label string
+	// method is the merge method chosen with a flag, if any.
+	method string
+}
 
-	// Does the user have merge/label abilities?
-	if !auth.CommenterHasPushAccess(context, *event) {
-		log.Printf("%s isn't authenticated to merge anything on %s", *event.Comment.User.Login, *event.Repo.FullName)
-		return errors.New("commenter isn't allowed to merge")
-	}
+// parseMergeArgs parses the arguments of the merge command, e.g.
+// "when ready +bug --rebase".
+func parseMergeArgs(args string, categories []ChangelogCategory) (mergeRequest, error) {
+	request := mergeRequest{}
 
-	// Should it be labeled?
-	if labelFromComment != "" {
-		changeSectionLabel = sectionForLabel(labelFromComment)
-	} else {
-		changeSectionLabel = "none"
+	for _, flag := range mergeFlagRegexp.FindAllStringSubmatch(args, -1) {
+		if !containsString(mergeMethods, flag[2]) {
+			return request, fmt.Errorf("unknown option --%s", flag[2])
+		}
+		if request.method != "" && request.method != flag[2] {
+			return request, fmt.Errorf("choose only one of --%s", strings.Join(mergeMethods, ", --"))
+		}
+		request.method = flag[2]
 	}
-	fmt.Printf("changeSectionLabel = '%s'\n", changeSectionLabel)
+	args = strings.TrimSpace(mergeFlagRegexp.ReplaceAllString(args, ""))
 
-	// Merge
-	commitMsg := fmt.Sprintf("Merge pull request %v", number)
-	_, _, mergeErr := context.GitHub.PullRequests.Merge(context.Context(), owner, repo, number, commitMsg, mergeOptions)
-	if mergeErr != nil {
-		return context.NewError("MergeAndLabel: error merging %s: %v", ref, mergeErr)
+	request.autoMerge = autoMergeArgsRegexp.MatchString(args)
+
+	var label string
+	if matches := mergeLabelArgRegexp.FindStringSubmatch(args); matches != nil {
+		label = downcaseAndHyphenize(strings.TrimSpace(matches[1]))
 	}
+	request.label = normalizeLabel(label, categories)
+
+	return request, nil
+}
+
+// mergeAndLabel merges the PR, deletes its branch, labels it for the given
+// changelog section and records the merge in the repo's changelog.
+func mergeAndLabel(context *ctx.Context, owner, repo string, number int, changeSectionLabel, method string) error {
+	var wg sync.WaitGroup
+	ref := fmt.Sprintf("%s/%s#%d", owner, repo, number)
 
-	// Delete branch
 	repoInfo, _, getRepoErr := context.GitHub.PullRequests.Get(context.Context(), owner, repo, number)
 	if getRepoErr != nil {
 		return context.NewError("MergeAndLabel: error getting PR info %s: %v", ref, getRepoErr)
@@ -138,6 +130,12 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 		return context.NewError("MergeAndLabel: tried to get PR, but couldn't. repoInfo was nil.")
 	}
 
+	// Merge
+	mergeErr := mergePR(context, owner, repo, repoInfo, method)
+	if mergeErr != nil {
+		return context.NewError("MergeAndLabel: error merging %s: %v", ref, mergeErr)
+	}
+
 	// Delete branch
 	if deletableRef(repoInfo, owner) {
 		wg.Add(1)
@@ -145,7 +143,7 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 			ref := fmt.Sprintf("heads/%s", *repoInfo.Head.Ref)
 			_, deleteBranchErr := context.GitHub.Git.DeleteRef(context.Context(), owner, repo, ref)
 			if deleteBranchErr != nil {
-				fmt.Printf("MergeAndLabel: error deleting branch %v\n", mergeErr)
+				context.Log("MergeAndLabel: error deleting branch of %s: %v", ref, deleteBranchErr)
 			}
 			wg.Done()
 		}()
@@ -155,23 +153,26 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 	go func() {
 		err := addLabelsForSubsection(context, owner, repo, number, changeSectionLabel)
 		if err != nil {
-			fmt.Printf("MergeAndLabel: error applying labels: %v\n", err)
+			context.Log("MergeAndLabel: error applying labels to %s: %v", ref, err)
 		}
 		wg.Done()
 	}()
 
+	// Release PRs are the changelog's own changes.
+	if isReleaseBranch(repoInfo.GetHead().GetRef()) {
+		wg.Wait()
+		return nil
+	}
+
 	wg.Add(1)
 	go func() {
-		// Read History.markdown, add line to appropriate change section
-		historyFileContents, historySHA := getHistoryContents(context, owner, repo)
-
-		// Add merge reference to history
-		newHistoryFileContents := addMergeReference(historyFileContents, changeSectionLabel, *repoInfo.Title, number)
-
-		// Commit change to History.markdown
-		commitErr := commitHistoryFile(context, historySHA, owner, repo, number, newHistoryFileContents)
+		// Add line to appropriate change section of the changelog
+		commitErr := recordChange(context, owner, repo, number, changeSectionLabel, *repoInfo.Title)
 		if commitErr != nil {
-			fmt.Printf("comments: error committing updated history %v\n", mergeErr)
+			context.Log("MergeAndLabel: error recording %s in the changelog: %v", ref, commitErr)
+			if err := reportChangelogFailure(context, owner, repo, number, changeSectionLabel, *repoInfo.Title, commitErr); err != nil {
+				context.Log("MergeAndLabel: error reporting the failed changelog update of %s: %v", ref, err)
+			}
 		}
 		wg.Done()
 	}()
@@ -181,72 +182,12 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 	return nil
 }
 
-func parseMergeRequestComment(commentBody string) (bool, string) {
-	matches := mergeCommentRegexp.FindAllStringSubmatch(commentBody, -1)
-	if matches == nil || matches[0] == nil {
-		return false, ""
-	}
-
-	var label string
-	if len(matches[0]) >= 4 {
-		if labelFromComment := matches[0][3]; labelFromComment != "" {
-			label = downcaseAndHyphenize(labelFromComment)
-		}
-	}
-
-	return true, normalizeLabel(label)
-}
-
 func downcaseAndHyphenize(label string) string {
 	return strings.Replace(strings.ToLower(label), " ", "-", -1)
 }
 
-func normalizeLabel(label string) string {
-	for _, category := range categories {
-		if strings.HasPrefix(label, category.Prefix) {
-			return category.Slug
-		}
-	}
-
-	return label
-}
-
-func sectionForLabel(slug string) string {
-	for _, category := range categories {
-		if slug == category.Slug {
-			return category.Section
-		}
-	}
-
-	return slug
-}
-
-func labelsForSubsection(changeSectionLabel string) []string {
-	for _, category := range categories {
-		if changeSectionLabel == category.Section {
-			return category.Labels
-		}
-	}
-
-	return []string{}
-}
-
-func selectSectionLabel(labels []github.Label) string {
-	for _, label := range labels {
-		if sectionForLabel(*label.Name) != *label.Name {
-			return *label.Name
-		}
-	}
-	return ""
-}
-
-func containsChangeLabel(commentBody string) bool {
-	_, labelFromComment := parseMergeRequestComment(commentBody)
-	return labelFromComment != ""
-}
-
 func addLabelsForSubsection(context *ctx.Context, owner, repo string, number int, changeSectionLabel string) error {
-	labels := labelsForSubsection(changeSectionLabel)
+	labels := labelsForSubsection(changeSectionLabel, categoriesFor(owner, repo))
 
 	if len(labels) < 1 {
 		return fmt.Errorf("no labels for changeSectionLabel='%s'", changeSectionLabel)
@@ -256,21 +197,6 @@ func addLabelsForSubsection(context *ctx.Context, owner, repo string, number int
 	return err
 }
 
-func getHistoryContents(context *ctx.Context, owner, repo string) (content, sha string) {
-	contents, _, _, err := context.GitHub.Repositories.GetContents(
-		context.Context(),
-		owner,
-		repo,
-		"History.markdown",
-		&github.RepositoryContentGetOptions{Ref: "heads/master"},
-	)
-	if err != nil {
-		fmt.Printf("comments: error getting History.markdown %v\n", err)
-		return "", ""
-	}
-	return base64Decode(*contents.Content), *contents.SHA
-}
-
 func base64Decode(encoded string) string {
 	decoded, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
@@ -322,22 +248,3 @@ func deletableRef(pr *github.PullRequest, owner string) bool {
 		*pr.Head.Ref != "master" &&
 		*pr.Head.Ref != "gh-pages"
 }
-
-func commitHistoryFile(context *ctx.Context, historySHA, owner, repo string, number int, newHistoryFileContents string) error {
-	repositoryContentsOptions := &github.RepositoryContentFileOptions{
-		Message: github.String(fmt.Sprintf("Update history to reflect merge of #%d [ci skip]", number)),
-		Content: []byte(newHistoryFileContents),
-		SHA:     github.String(historySHA),
-		Committer: &github.CommitAuthor{
-			Name:  github.String("jekyllbot"),
-			Email: github.String("jekyllbot@jekyllrb.com"),
-		},
-	}
-	updateResponse, _, err := context.GitHub.Repositories.UpdateFile(context.Context(), owner, repo, "History.markdown", repositoryContentsOptions)
-	if err != nil {
-		fmt.Printf("comments: error committing History.markdown: %v\n", err)
-		return err
-	}
-	fmt.Printf("comments: updateResponse: %s\n", updateResponse)
-	return nil
-}
@@ -7,31 +7,27 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestParseMergeRequestComment(t *testing.T) {
-	comments := []struct {
-		comment string
-		isReq   bool
+func TestParseMergeArgsLabels(t *testing.T) {
+	cases := []struct {
+		args    string
 		label   string
 		section string
 		labels  []string
 	}{
-		{"it looked like you could merge it", false, "", "", []string{}},
-		{"@jekyllbot: merge", true, "", "", []string{}},
-		{"@jekyllbot: :shipit:", true, "", "", []string{}},
-		{"@jekyllbot: :ship:", true, "", "", []string{}},
-		{"@jekyllbot: merge +Site", true, "site-enhancements", "Site Enhancements", []string{"documentation"}},
-		{"@jekyllbot: merge +major", true, "major-enhancements", "Major Enhancements", []string{"feature"}},
-		{"@jekyllbot: merge +minor-enhancement", true, "minor-enhancements", "Minor Enhancements", []string{"enhancement"}},
-		{"@jekyllbot: merge +Bug Fix\n", true, "bug-fixes", "Bug Fixes", []string{"bug", "fix"}},
-		{"@jekyllbot: merge +port", true, "forward-ports", "Forward Ports", []string{"forward-port"}},
+		{"", "", "", []string{}},
+		{"+Site", "site-enhancements", "Site Enhancements", []string{"documentation"}},
+		{"+major", "major-enhancements", "Major Enhancements", []string{"feature"}},
+		{"+minor-enhancement", "minor-enhancements", "Minor Enhancements", []string{"enhancement"}},
+		{"+Bug Fix", "bug-fixes", "Bug Fixes", []string{"bug", "fix"}},
+		{"+port", "forward-ports", "Forward Ports", []string{"forward-port"}},
 	}
-	for _, c := range comments {
-		isReq, label := parseMergeRequestComment(c.comment)
-		section := sectionForLabel(c.label)
-		assert.Equal(t, c.isReq, isReq, "'%s' should have isReq=%v", c.comment, c.isReq)
-		assert.Equal(t, c.label, label, "'%s' should have label=%v", c.comment, c.label)
-		assert.Equal(t, c.section, section, "'%s' should have section=%v", c.comment, c.section)
-		assert.Equal(t, c.labels, labelsForSubsection(section), "'%s' should have labels=%v", c.comment, c.labels)
+	for _, c := range cases {
+		request, err := parseMergeArgs(c.args, defaultCategories)
+		section := sectionForLabel(request.label, defaultCategories)
+		assert.NoError(t, err, "'%s' should parse", c.args)
+		assert.Equal(t, c.label, request.label, "'%s' should have label=%v", c.args, c.label)
+		assert.Equal(t, c.section, section, "'%s' should have section=%v", c.args, c.section)
+		assert.Equal(t, c.labels, labelsForSubsection(section, defaultCategories), "'%s' should have labels=%v", c.args, c.labels)
 	}
 }
 
@@ -66,3 +62,32 @@ func TestAddMergeReference(t *testing.T) {
 	historyFile = addMergeReference(string(jekyllHistory), "Development Fixes", "A marvelous change.", 41526)
 	assert.Contains(t, historyFile, "* A marvelous change. (#41526)\n\n### Site Enhancements")
 }
+
+func TestParseMergeArgs(t *testing.T) {
+	args := []struct {
+		args    string
+		request mergeRequest
+		err     bool
+	}{
+		{"", mergeRequest{}, false},
+		{"+Site", mergeRequest{label: "site-enhancements"}, false},
+		{"+Bug Fix", mergeRequest{label: "bug-fixes"}, false},
+		{"when ready", mergeRequest{autoMerge: true}, false},
+		{"when green +major", mergeRequest{autoMerge: true, label: "major-enhancements"}, false},
+		{"whenever +minor", mergeRequest{label: "minor-enhancements"}, false},
+		{"+bug --rebase", mergeRequest{label: "bug-fixes", method: "rebase"}, false},
+		{"--merge +Bug Fix", mergeRequest{label: "bug-fixes", method: "merge"}, false},
+		{"--squash --squash", mergeRequest{method: "squash"}, false},
+		{"--squash --rebase", mergeRequest{}, true},
+		{"+bug --fast-forward", mergeRequest{}, true},
+	}
+	for _, a := range args {
+		request, err := parseMergeArgs(a.args, defaultCategories)
+		if a.err {
+			assert.Error(t, err, "'%s' should be invalid", a.args)
+			continue
+		}
+		assert.NoError(t, err, "'%s' should be valid", a.args)
+		assert.Equal(t, a.request, request, "'%s' should have request=%+v", a.args, a.request)
+	}
+}
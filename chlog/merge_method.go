@@ -0,0 +1,170 @@
+package chlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var (
+	mergeMethods = []string{"merge", "squash", "rebase"}
+
+	// defaultMergeConfig applies to repos without a MergeConfig.
+	defaultMergeConfig = MergeConfig{AllowedMethods: mergeMethods, DefaultMethod: "squash"}
+
+	mergeConfigs = map[string]MergeConfig{}
+
+	htmlCommentRegexp = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// MergeConfig configures how the merge command merges a repo's PRs.
+type MergeConfig struct {
+	// AllowedMethods are the methods which can be chosen with --merge,
+	// --squash or --rebase.
+	AllowedMethods []string
+	// DefaultMethod is used when no method is chosen.
+	DefaultMethod string
+}
+
+// SetMergeConfig configures the merge methods allowed for the repo.
+func SetMergeConfig(owner, repo string, config MergeConfig) error {
+	if len(config.AllowedMethods) == 0 {
+		return fmt.Errorf("chlog.SetMergeConfig: %s/%s must allow at least one merge method", owner, repo)
+	}
+	for _, method := range config.AllowedMethods {
+		if !containsString(mergeMethods, method) {
+			return fmt.Errorf("chlog.SetMergeConfig: unknown merge method %q for %s/%s", method, owner, repo)
+		}
+	}
+	if !containsString(config.AllowedMethods, config.DefaultMethod) {
+		return fmt.Errorf("chlog.SetMergeConfig: default merge method %q isn't allowed for %s/%s", config.DefaultMethod, owner, repo)
+	}
+	mergeConfigs[owner+"/"+repo] = config
+	return nil
+}
+
+func mergeConfigFor(owner, repo string) MergeConfig {
+	if config, ok := mergeConfigs[owner+"/"+repo]; ok {
+		return config
+	}
+	return defaultMergeConfig
+}
+
+// resolve returns the method to merge with, given the one requested, which
+// may be empty.
+func (c MergeConfig) resolve(method string) (string, error) {
+	if method == "" {
+		return c.DefaultMethod, nil
+	}
+	if !containsString(c.AllowedMethods, method) {
+		return "", fmt.Errorf("--%s isn't allowed here; use one of --%s", method, strings.Join(c.AllowedMethods, ", --"))
+	}
+	return method, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// mergePR merges the PR with the given method. Squash commits are titled
+// after the PR and credit the authors of each of its commits.
+func mergePR(context *ctx.Context, owner, repo string, pr *github.PullRequest, method string) error {
+	number := pr.GetNumber()
+	options := &github.PullRequestOptions{MergeMethod: method, SHA: pr.GetHead().GetSHA()}
+
+	var commitMsg string
+	switch method {
+	case "squash":
+		commits, err := listCommits(context, owner, repo, number)
+		if err != nil {
+			return err
+		}
+		options.CommitTitle = squashCommitTitle(pr)
+		commitMsg = squashCommitMessage(pr, commits)
+	case "merge":
+		commitMsg = fmt.Sprintf("Merge pull request %v", number)
+	}
+
+	_, _, err := context.GitHub.PullRequests.Merge(context.Context(), owner, repo, number, commitMsg, options)
+	return err
+}
+
+func listCommits(context *ctx.Context, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	allCommits := []*github.RepositoryCommit{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		commits, resp, err := context.GitHub.PullRequests.ListCommits(context.Context(), owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		allCommits = append(allCommits, commits...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allCommits, nil
+}
+
+func squashCommitTitle(pr *github.PullRequest) string {
+	return fmt.Sprintf("%s (#%d)", strings.TrimSpace(pr.GetTitle()), pr.GetNumber())
+}
+
+// squashCommitMessage is the first paragraph of the PR's body, followed by a
+// Co-authored-by trailer for each commit author other than the PR's author,
+// whom GitHub makes the author of the squashed commit. Commit authors who
+// aren't GitHub users are left out, since they can't be told apart from the
+// PR's author.
+func squashCommitMessage(pr *github.PullRequest, commits []*github.RepositoryCommit) string {
+	message := bodySummary(pr.GetBody())
+
+	// The PR's author may have committed with any of these.
+	seen := map[string]bool{}
+	for _, commit := range commits {
+		if commit.GetAuthor().GetLogin() == pr.GetUser().GetLogin() {
+			seen[strings.ToLower(commit.GetCommit().GetAuthor().GetEmail())] = true
+		}
+	}
+
+	trailers := []string{}
+	for _, commit := range commits {
+		login := commit.GetAuthor().GetLogin()
+		if login == "" || login == pr.GetUser().GetLogin() {
+			continue
+		}
+		author := commit.GetCommit().GetAuthor()
+		email := strings.ToLower(author.GetEmail())
+		if email == "" || seen[email] {
+			continue
+		}
+		seen[email] = true
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", author.GetName(), author.GetEmail()))
+	}
+
+	if len(trailers) > 0 {
+		if message != "" {
+			message += "\n\n"
+		}
+		message += strings.Join(trailers, "\n")
+	}
+	return message
+}
+
+// bodySummary returns the first paragraph of a PR body, ignoring any HTML
+// comments left over from the PR template.
+func bodySummary(body string) string {
+	body = strings.Replace(body, "\r\n", "\n", -1)
+	body = strings.TrimSpace(htmlCommentRegexp.ReplaceAllString(body, ""))
+	if i := strings.Index(body, "\n\n"); i >= 0 {
+		body = body[:i]
+	}
+	return strings.TrimSpace(body)
+}
@@ -0,0 +1,73 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetMergeConfig(t *testing.T) {
+	assert.Error(t, SetMergeConfig("o", "r", MergeConfig{}))
+	assert.Error(t, SetMergeConfig("o", "r", MergeConfig{AllowedMethods: []string{"fast-forward"}, DefaultMethod: "fast-forward"}))
+	assert.Error(t, SetMergeConfig("o", "r", MergeConfig{AllowedMethods: []string{"rebase"}, DefaultMethod: "squash"}))
+	assert.Equal(t, defaultMergeConfig, mergeConfigFor("o", "r"))
+
+	config := MergeConfig{AllowedMethods: []string{"rebase", "merge"}, DefaultMethod: "rebase"}
+	assert.NoError(t, SetMergeConfig("o", "r", config))
+	defer delete(mergeConfigs, "o/r")
+	assert.Equal(t, config, mergeConfigFor("o", "r"))
+}
+
+func TestMergeConfigResolve(t *testing.T) {
+	config := MergeConfig{AllowedMethods: []string{"rebase", "merge"}, DefaultMethod: "rebase"}
+
+	method, err := config.resolve("")
+	assert.NoError(t, err)
+	assert.Equal(t, "rebase", method)
+
+	method, err = config.resolve("merge")
+	assert.NoError(t, err)
+	assert.Equal(t, "merge", method)
+
+	_, err = config.resolve("squash")
+	assert.EqualError(t, err, "--squash isn't allowed here; use one of --rebase, --merge")
+}
+
+func newTestCommit(login, name, email string) *github.RepositoryCommit {
+	return &github.RepositoryCommit{
+		Author: &github.User{Login: github.String(login)},
+		Commit: &github.Commit{Author: &github.CommitAuthor{Name: github.String(name), Email: github.String(email)}},
+	}
+}
+
+func TestSquashCommit(t *testing.T) {
+	pr := &github.PullRequest{
+		Number: github.Int(42),
+		Title:  github.String("Add a feature "),
+		User:   &github.User{Login: github.String("parkr")},
+		Body:   github.String("<!-- Thanks for contributing! -->\r\nThis adds a feature\r\nwhich is great.\r\n\r\nFixes #41."),
+	}
+	commits := []*github.RepositoryCommit{
+		newTestCommit("parkr", "Parker Moore", "parkr@example.com"),
+		newTestCommit("envygeeks", "Jordon Bedwell", "jordon@example.com"),
+		newTestCommit("", "Jordon Bedwell", "Jordon@example.com"),
+		newTestCommit("", "Someone Else", "someone@example.com"),
+		newTestCommit("octocat", "Parker Moore", "Parkr@example.com"),
+		newTestCommit("mattr-", "Matt Rogers", ""),
+	}
+
+	assert.Equal(t, "Add a feature (#42)", squashCommitTitle(pr))
+	assert.Equal(t, "This adds a feature\nwhich is great.\n\n"+
+		"Co-authored-by: Jordon Bedwell <jordon@example.com>",
+		squashCommitMessage(pr, commits))
+
+	pr.Body = nil
+	assert.Equal(t, "", squashCommitMessage(pr, commits[:1]))
+}
+
+func TestBodySummary(t *testing.T) {
+	assert.Equal(t, "", bodySummary(""))
+	assert.Equal(t, "One line.", bodySummary("One line."))
+	assert.Equal(t, "First paragraph.", bodySummary("\n\nFirst paragraph.\n\nSecond paragraph."))
+}
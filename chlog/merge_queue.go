@@ -0,0 +1,434 @@
+package chlog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var (
+	// defaultMergeQueueConfig applies to repos without a MergeQueueConfig.
+	defaultMergeQueueConfig = MergeQueueConfig{CITimeout: 10 * time.Minute}
+
+	mergeQueueConfigs = map[string]MergeQueueConfig{}
+
+	mergeQueues = mergeQueueMap{data: make(map[string]*mergeQueue)}
+
+	// mergeQueuePollInterval is the least time between checks on the CI of
+	// a PR waiting for it.
+	mergeQueuePollInterval = 30 * time.Second
+
+	// errCIPending is returned when CI is still running on a PR waiting for
+	// it.
+	errCIPending = errors.New("CI is still running")
+)
+
+// MergeQueueConfig configures how a repo's merge queue merges PRs. Every
+// repo has a merge queue, so that PRs are merged, and their changelog
+// entries committed, one at a time.
+type MergeQueueConfig struct {
+	// UpdateBranch merges the base branch into PRs which are behind it
+	// before merging them, then waits for CI to pass on the result. Only
+	// branches in the repo itself can be updated.
+	UpdateBranch bool
+	// CITimeout is how long a PR can wait for CI, going to the back of the
+	// queue each time it's still running, before it's given up on. It
+	// defaults to 10 minutes.
+	CITimeout time.Duration
+}
+
+// SetMergeQueueConfig configures the merge queue of the repo.
+func SetMergeQueueConfig(owner, repo string, config MergeQueueConfig) {
+	if config.CITimeout <= 0 {
+		config.CITimeout = defaultMergeQueueConfig.CITimeout
+	}
+	mergeQueueConfigs[owner+"/"+repo] = config
+}
+
+func mergeQueueConfigFor(owner, repo string) MergeQueueConfig {
+	if config, ok := mergeQueueConfigs[owner+"/"+repo]; ok {
+		return config
+	}
+	return defaultMergeQueueConfig
+}
+
+// mergeQueueContext is the context of the status showing a PR's place in
+// the merge queue.
+func mergeQueueContext(owner string) string {
+	return owner + "/merge-queue"
+}
+
+// queuedMerge is a PR waiting in the merge queue.
+type queuedMerge struct {
+	number             int
+	changeSectionLabel string
+	method             string
+	// sha is the PR's head, which the queue status is set on.
+	sha string
+	// autoMerge is set for PRs labeled auto-merge, which must be green to
+	// be merged and are unlabeled once they are.
+	autoMerge bool
+	// awaitingCI is set once the branch has been updated, so CI must pass
+	// on the new head before it's merged, which it must do by ciDeadline.
+	awaitingCI bool
+	ciDeadline time.Time
+	// retryAt is when CI is next checked, once the PR has gone to the back
+	// of the queue because it was still running.
+	retryAt time.Time
+}
+
+// mergeQueue merges a repo's PRs in the order they were queued. The PR at
+// the front is merged by a single worker, which finishes updating the
+// changelog before moving on to the next.
+type mergeQueue struct {
+	owner, repo string
+
+	sync.Mutex // protects 'merges' and 'running'
+	merges     []*queuedMerge
+	running    bool
+}
+
+type mergeQueueMap struct {
+	sync.Mutex // protects 'data'
+	data       map[string]*mergeQueue
+}
+
+func (m *mergeQueueMap) get(owner, repo string) *mergeQueue {
+	m.Lock()
+	defer m.Unlock()
+	key := owner + "/" + repo
+	if m.data[key] == nil {
+		m.data[key] = &mergeQueue{owner: owner, repo: repo}
+	}
+	return m.data[key]
+}
+
+// add puts the merge at the back of the queue, unless the PR is already
+// queued, in which case it keeps its place. It returns the PR's position,
+// starting at 1, and whether a worker needs to be started.
+func (q *mergeQueue) add(merge *queuedMerge) (position int, start bool) {
+	q.Lock()
+	defer q.Unlock()
+	for i, queued := range q.merges {
+		if queued.number == merge.number {
+			return i + 1, false
+		}
+	}
+	q.merges = append(q.merges, merge)
+	start = !q.running
+	q.running = true
+	return len(q.merges), start
+}
+
+// remove takes the PR out of the queue. The PR at the front is being merged
+// and can't be removed.
+func (q *mergeQueue) remove(number int) bool {
+	q.Lock()
+	defer q.Unlock()
+	for i, queued := range q.merges {
+		if queued.number == number && i > 0 {
+			q.merges = append(q.merges[:i], q.merges[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// find returns a copy of the queued merge of the PR.
+func (q *mergeQueue) find(number int) (queuedMerge, bool) {
+	q.Lock()
+	defer q.Unlock()
+	for _, queued := range q.merges {
+		if queued.number == number {
+			return *queued, true
+		}
+	}
+	return queuedMerge{}, false
+}
+
+// setUpdated records the new head of the queued PR after its branch was
+// updated, and how long CI has to pass on it.
+func (q *mergeQueue) setUpdated(merge *queuedMerge, sha string, timeout time.Duration) {
+	q.Lock()
+	merge.sha = sha
+	merge.awaitingCI = true
+	merge.ciDeadline = time.Now().Add(timeout)
+	q.Unlock()
+}
+
+// requeue puts the merge at the front of the queue at the back as well, so
+// it's tried again once the front is popped, but no sooner than the poll
+// interval.
+func (q *mergeQueue) requeue(merge *queuedMerge) {
+	q.Lock()
+	defer q.Unlock()
+	merge.retryAt = time.Now().Add(mergeQueuePollInterval)
+	q.merges = append(q.merges, merge)
+}
+
+// next returns the merge at the front of the queue, having popped the one
+// which was just merged if done is set. When the queue is empty, it returns
+// nil and the worker stops.
+func (q *mergeQueue) next(done bool) *queuedMerge {
+	q.Lock()
+	defer q.Unlock()
+	if done && len(q.merges) > 0 {
+		q.merges = q.merges[1:]
+	}
+	if len(q.merges) == 0 {
+		q.running = false
+		return nil
+	}
+	return q.merges[0]
+}
+
+func (q *mergeQueue) snapshot() []queuedMerge {
+	q.Lock()
+	defer q.Unlock()
+	merges := make([]queuedMerge, len(q.merges))
+	for i, queued := range q.merges {
+		merges[i] = *queued
+	}
+	return merges
+}
+
+// enqueueMerge adds the PR to its repo's merge queue, starting a worker if
+// there isn't one already.
+func enqueueMerge(context *ctx.Context, owner, repo string, merge *queuedMerge) int {
+	queue := mergeQueues.get(owner, repo)
+	position, start := queue.add(merge)
+	context.Log("chlog.enqueueMerge: %s is #%d in the merge queue", prRefString(owner, repo, merge.number), position)
+	if start {
+		go queue.run(context)
+	} else {
+		setQueueStatus(context, owner, repo, merge.sha, "pending", queuePositionDescription(position))
+	}
+	return position
+}
+
+// dequeueMerge takes the PR out of the merge queue, explaining why on its
+// status.
+func dequeueMerge(context *ctx.Context, owner, repo string, number int, reason string) bool {
+	queue := mergeQueues.get(owner, repo)
+	merge, ok := queue.find(number)
+	if !ok || !queue.remove(number) {
+		return false
+	}
+	setQueueStatus(context, owner, repo, merge.sha, "error", "Removed from the merge queue: "+reason)
+	queue.publishPositions(context)
+	return true
+}
+
+func queuePositionDescription(position int) string {
+	if position == 1 {
+		return "Merging now"
+	}
+	return fmt.Sprintf("#%d in the merge queue", position)
+}
+
+// run merges the queued PRs until the queue is empty.
+func (q *mergeQueue) run(context *ctx.Context) {
+	for merge := q.next(false); merge != nil; merge = q.next(true) {
+		// Everything ahead of a requeued PR was requeued too, so there's
+		// nothing else to do until its CI is checked again.
+		if wait := time.Until(merge.retryAt); wait > 0 {
+			time.Sleep(wait)
+		}
+		q.publishPositions(context)
+		ref := prRefString(q.owner, q.repo, merge.number)
+		err := q.merge(context, merge)
+		if err == errCIPending {
+			context.Log("chlog.mergeQueue: CI is still running on %s, coming back to it", ref)
+			q.requeue(merge)
+			continue
+		}
+		if err != nil {
+			context.Log("chlog.mergeQueue: couldn't merge %s: %v", ref, err)
+			setQueueStatus(context, q.owner, q.repo, merge.sha, "error", "Removed from the merge queue: it couldn't be merged")
+			_, _, commentErr := context.GitHub.Issues.CreateComment(context.Context(), q.owner, q.repo, merge.number, &github.IssueComment{
+				Body: github.String(fmt.Sprintf("I took this out of the merge queue because I couldn't merge it: %v", err)),
+			})
+			if commentErr != nil {
+				context.Log("chlog.mergeQueue: couldn't comment on %s: %v", ref, commentErr)
+			}
+			continue
+		}
+		setQueueStatus(context, q.owner, q.repo, merge.sha, "success", "Merged from the merge queue")
+	}
+}
+
+// publishPositions updates the status of each queued PR with its place.
+func (q *mergeQueue) publishPositions(context *ctx.Context) {
+	for i, merge := range q.snapshot() {
+		setQueueStatus(context, q.owner, q.repo, merge.sha, "pending", queuePositionDescription(i+1))
+	}
+}
+
+// merge brings the PR up to date if configured to, checks it's still ready,
+// then merges it and records it in the changelog.
+func (q *mergeQueue) merge(context *ctx.Context, merge *queuedMerge) error {
+	owner, repo := q.owner, q.repo
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), owner, repo, merge.number)
+	if err != nil {
+		return err
+	}
+	if pr.GetState() != "open" {
+		return fmt.Errorf("it's %s", pr.GetState())
+	}
+
+	config := preflightConfigFor(owner, repo)
+	if merge.autoMerge {
+		config.RequireGreenStatuses = true
+	}
+
+	queueConfig := mergeQueueConfigFor(owner, repo)
+	if queueConfig.UpdateBranch {
+		updated, err := updateBranch(context, owner, repo, pr)
+		if err != nil {
+			return fmt.Errorf("couldn't update the branch: %v", err)
+		}
+		if updated != "" {
+			q.setUpdated(merge, updated, queueConfig.CITimeout)
+		}
+	}
+
+	if merge.awaitingCI {
+		if err := checkCI(context, owner, repo, merge); err != nil {
+			return err
+		}
+		config.RequireGreenStatuses = true
+		if pr, _, err = context.GitHub.PullRequests.Get(context.Context(), owner, repo, merge.number); err != nil {
+			return err
+		}
+	}
+
+	if err := preflight(context, owner, repo, pr, config); err != nil {
+		return err
+	}
+
+	changeSectionLabel := merge.changeSectionLabel
+	if changeSectionLabel == "none" {
+		changeSectionLabel = forwardPortSection(pr.Labels, categoriesFor(owner, repo))
+	}
+
+	if err := mergeAndLabel(context, owner, repo, merge.number, changeSectionLabel, merge.method); err != nil {
+		return err
+	}
+
+	if merge.autoMerge {
+		finishAutoMerge(context, owner, repo, merge.number)
+	}
+	return nil
+}
+
+// updateBranch merges the base branch into the PR's branch if it's behind,
+// returning the new head SHA, or an empty string if it's up to date or
+// can't be updated.
+func updateBranch(context *ctx.Context, owner, repo string, pr *github.PullRequest) (string, error) {
+	if pr.GetHead().GetRepo().GetFullName() != pr.GetBase().GetRepo().GetFullName() {
+		context.Log("chlog.updateBranch: can't update %s, its branch is in a fork", prRefString(owner, repo, pr.GetNumber()))
+		return "", nil
+	}
+
+	comparison, _, err := context.GitHub.Repositories.CompareCommits(
+		context.Context(), owner, repo, pr.GetBase().GetRef(), pr.GetHead().GetSHA())
+	if err != nil {
+		return "", err
+	}
+	if comparison.GetBehindBy() == 0 {
+		return "", nil
+	}
+
+	commit, _, err := context.GitHub.Repositories.Merge(context.Context(), owner, repo, &github.RepositoryMergeRequest{
+		Base:          github.String(pr.GetHead().GetRef()),
+		Head:          github.String(pr.GetBase().GetRef()),
+		CommitMessage: github.String(fmt.Sprintf("Merge branch '%s' into %s", pr.GetBase().GetRef(), pr.GetHead().GetRef())),
+	})
+	if err != nil {
+		return "", err
+	}
+	return commit.GetSHA(), nil
+}
+
+// checkCI returns nil once CI has passed on the PR's updated head, or
+// errCIPending while it's still running. It gives up if any of it fails, or
+// if it's still running after the deadline.
+func checkCI(context *ctx.Context, owner, repo string, merge *queuedMerge) error {
+	state, err := ciState(context, owner, repo, merge.sha)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case "success":
+		return nil
+	case "failure":
+		return fmt.Errorf("CI failed after updating the branch")
+	}
+	if time.Now().After(merge.ciDeadline) {
+		return fmt.Errorf("CI didn't finish within %s of updating the branch", mergeQueueConfigFor(owner, repo).CITimeout)
+	}
+	setQueueStatus(context, owner, repo, merge.sha, "pending", "Waiting for CI before merging")
+	return errCIPending
+}
+
+// ciState combines the statuses and check runs of the SHA into "success",
+// "pending" or "failure". A SHA without any is a success, as the repo has no
+// CI. The merge queue and lgtm statuses and the lgtm check run aren't CI, so
+// they're left out.
+func ciState(context *ctx.Context, owner, repo, sha string) (string, error) {
+	combined, _, err := context.GitHub.Repositories.GetCombinedStatus(
+		context.Context(), owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", err
+	}
+	checkRuns, _, err := context.GitHub.Checks.ListCheckRunsForRef(
+		context.Context(), owner, repo, sha, &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}})
+	if err != nil {
+		return "", err
+	}
+
+	state := "success"
+	for _, status := range combined.Statuses {
+		if status.GetContext() == mergeQueueContext(owner) || status.GetContext() == lgtmContext(owner) {
+			continue
+		}
+		switch status.GetState() {
+		case "success":
+		case "pending":
+			state = "pending"
+		default:
+			return "failure", nil
+		}
+	}
+	for _, checkRun := range checkRuns.CheckRuns {
+		if checkRun.GetName() == lgtmContext(owner) {
+			continue
+		}
+		if checkRun.GetStatus() != "completed" {
+			state = "pending"
+			continue
+		}
+		if len(checkRunFailures([]*github.CheckRun{checkRun})) > 0 {
+			return "failure", nil
+		}
+	}
+	return state, nil
+}
+
+func setQueueStatus(context *ctx.Context, owner, repo, sha, state, description string) {
+	if sha == "" {
+		return
+	}
+	_, _, err := context.GitHub.Repositories.CreateStatus(context.Context(), owner, repo, sha, &github.RepoStatus{
+		State:       github.String(state),
+		Context:     github.String(mergeQueueContext(owner)),
+		Description: github.String(description),
+	})
+	if err != nil {
+		context.Log("chlog.setQueueStatus: couldn't set status on %s/%s@%s: %v", owner, repo, sha, err)
+	}
+}
@@ -0,0 +1,165 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeQueueOrder(t *testing.T) {
+	queue := &mergeQueue{owner: "o", repo: "r"}
+
+	position, start := queue.add(&queuedMerge{number: 1})
+	assert.Equal(t, 1, position)
+	assert.True(t, start)
+
+	position, start = queue.add(&queuedMerge{number: 2})
+	assert.Equal(t, 2, position)
+	assert.False(t, start)
+
+	queue.add(&queuedMerge{number: 3})
+
+	// A PR which is already queued keeps its place.
+	position, start = queue.add(&queuedMerge{number: 2, method: "rebase"})
+	assert.Equal(t, 2, position)
+	assert.False(t, start)
+
+	// The PR being merged can't be removed.
+	assert.False(t, queue.remove(1))
+	assert.True(t, queue.remove(2))
+	assert.False(t, queue.remove(2))
+
+	assert.Equal(t, 1, queue.next(false).number)
+	assert.Equal(t, 3, queue.next(true).number)
+	assert.Nil(t, queue.next(true))
+	assert.False(t, queue.running)
+
+	_, start = queue.add(&queuedMerge{number: 4})
+	assert.True(t, start)
+
+	// A PR waiting on CI goes to the back of the queue.
+	queue.add(&queuedMerge{number: 5})
+	front := queue.next(false)
+	queue.requeue(front)
+	assert.Equal(t, 5, queue.next(true).number)
+	assert.Equal(t, 4, queue.next(true).number)
+	assert.True(t, front.retryAt.After(time.Now()))
+}
+
+func TestQueuePositionDescription(t *testing.T) {
+	assert.Equal(t, "Merging now", queuePositionDescription(1))
+	assert.Equal(t, "#3 in the merge queue", queuePositionDescription(3))
+}
+
+func TestSetMergeQueueConfig(t *testing.T) {
+	defer delete(mergeQueueConfigs, "o/r")
+
+	assert.Equal(t, defaultMergeQueueConfig, mergeQueueConfigFor("o", "r"))
+
+	SetMergeQueueConfig("o", "r", MergeQueueConfig{UpdateBranch: true})
+	assert.Equal(t, MergeQueueConfig{UpdateBranch: true, CITimeout: 10 * time.Minute}, mergeQueueConfigFor("o", "r"))
+}
+
+func TestCIState(t *testing.T) {
+	cases := []struct {
+		statuses, checkRuns string
+		state               string
+	}{
+		{`[]`, `[]`, "success"},
+		{`[{"context": "o/merge-queue", "state": "pending"}]`, `[]`, "success"},
+		{`[{"context": "ci", "state": "success"}]`, `[{"name": "o/lgtm", "status": "in_progress"}]`, "success"},
+		{`[{"context": "ci", "state": "success"}, {"context": "o/merge-queue", "state": "pending"}]`, `[]`, "success"},
+		{`[{"context": "ci", "state": "success"}, {"context": "o/lgtm", "state": "pending"}]`, `[]`, "success"},
+		{`[{"context": "ci", "state": "pending"}]`, `[{"name": "lint", "status": "completed", "conclusion": "success"}]`, "pending"},
+		{`[]`, `[{"name": "lint", "status": "in_progress"}]`, "pending"},
+		{`[{"context": "ci", "state": "pending"}]`, `[{"name": "lint", "status": "completed", "conclusion": "failure"}]`, "failure"},
+		{`[{"context": "ci", "state": "error"}]`, `[]`, "failure"},
+	}
+	for _, c := range cases {
+		setup() // server & client!
+		mux.HandleFunc("/repos/o/r/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"statuses": %s}`, c.statuses)
+		})
+		mux.HandleFunc("/repos/o/r/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"check_runs": %s}`, c.checkRuns)
+		})
+
+		state, err := ciState(&ctx.Context{GitHub: client}, "o", "r", "abc")
+		assert.NoError(t, err)
+		assert.Equal(t, c.state, state, "statuses=%s checkRuns=%s", c.statuses, c.checkRuns)
+		teardown()
+	}
+}
+
+func TestCheckCI(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	statuses := `[{"context": "ci", "state": "pending"}]`
+	mux.HandleFunc("/repos/o/r/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"statuses": %s}`, statuses)
+	})
+	mux.HandleFunc("/repos/o/r/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"check_runs": []}`)
+	})
+	mux.HandleFunc("/repos/o/r/statuses/abc", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	merge := &queuedMerge{number: 1, sha: "abc", awaitingCI: true, ciDeadline: time.Now().Add(time.Minute)}
+	assert.Equal(t, errCIPending, checkCI(context, "o", "r", merge))
+
+	merge.ciDeadline = time.Now().Add(-time.Second)
+	err := checkCI(context, "o", "r", merge)
+	assert.Error(t, err)
+	assert.NotEqual(t, errCIPending, err)
+
+	statuses = `[{"context": "ci", "state": "success"}]`
+	assert.NoError(t, checkCI(context, "o", "r", merge))
+
+	statuses = `[{"context": "ci", "state": "failure"}]`
+	assert.Error(t, checkCI(context, "o", "r", merge))
+}
+
+func TestUpdateBranch(t *testing.T) {
+	var merged *github.RepositoryMergeRequest
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/compare/master...old", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"behind_by": 2}`)
+	})
+	mux.HandleFunc("/repos/o/r/merges", func(w http.ResponseWriter, r *http.Request) {
+		merged = new(github.RepositoryMergeRequest)
+		json.NewDecoder(r.Body).Decode(merged)
+		fmt.Fprint(w, `{"sha": "new"}`)
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	repo := &github.Repository{FullName: github.String("o/r")}
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Base:   &github.PullRequestBranch{Ref: github.String("master"), Repo: repo},
+		Head:   &github.PullRequestBranch{Ref: github.String("feature"), SHA: github.String("old"), Repo: repo},
+	}
+	sha, err := updateBranch(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", sha)
+	if assert.NotNil(t, merged) {
+		assert.Equal(t, "feature", merged.GetBase())
+		assert.Equal(t, "master", merged.GetHead())
+	}
+
+	// Branches in forks can't be updated.
+	pr.Head.Repo = &github.Repository{FullName: github.String("someone/r")}
+	sha, err = updateBranch(context, "o", "r", pr)
+	assert.NoError(t, err)
+	assert.Equal(t, "", sha)
+}
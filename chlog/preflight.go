@@ -0,0 +1,176 @@
+package chlog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var preflightConfigs = map[string]PreflightConfig{}
+
+// PreflightConfig configures the checks a PR must pass before the merge
+// command merges it. The zero value runs no checks, which is what repos
+// without a PreflightConfig get.
+type PreflightConfig struct {
+	// RequireGreenStatuses requires every commit status and check run on the
+	// PR's head to have passed.
+	RequireGreenStatuses bool
+	// RequireLGTM requires the "<owner>/lgtm" status to be successful.
+	RequireLGTM bool
+	// RequireMergeable requires the PR to be open, not a draft, and free of
+	// merge conflicts.
+	RequireMergeable bool
+	// BlockingLabels are labels which prevent the PR from being merged.
+	BlockingLabels []string
+	// BaseBranches, if set, are the only branches PRs can be merged into.
+	BaseBranches []string
+}
+
+// SetPreflightConfig configures the checks run before merging the repo's PRs.
+func SetPreflightConfig(owner, repo string, config PreflightConfig) {
+	preflightConfigs[owner+"/"+repo] = config
+}
+
+func preflightConfigFor(owner, repo string) PreflightConfig {
+	return preflightConfigs[owner+"/"+repo]
+}
+
+// preflightError lists the checks which failed.
+type preflightError struct {
+	failures []string
+}
+
+func (e preflightError) Error() string {
+	var message bytes.Buffer
+	if len(e.failures) == 1 {
+		message.WriteString("1 pre-merge check failed:\n")
+	} else {
+		fmt.Fprintf(&message, "%d pre-merge checks failed:\n", len(e.failures))
+	}
+	for _, failure := range e.failures {
+		fmt.Fprintf(&message, "\n- %s", failure)
+	}
+	return message.String()
+}
+
+// preflight runs the configured checks against the PR, returning a
+// preflightError if any of them fail.
+func preflight(context *ctx.Context, owner, repo string, pr *github.PullRequest, config PreflightConfig) error {
+	failures := []string{}
+
+	if config.RequireMergeable {
+		failures = append(failures, mergeabilityFailures(pr)...)
+	}
+
+	if len(config.BaseBranches) > 0 && !containsString(config.BaseBranches, pr.GetBase().GetRef()) {
+		failures = append(failures, fmt.Sprintf("It targets `%s`, but only `%s` can be merged into.",
+			pr.GetBase().GetRef(), strings.Join(config.BaseBranches, "`, `")))
+	}
+
+	for _, label := range pr.Labels {
+		for _, blockingLabel := range config.BlockingLabels {
+			if strings.EqualFold(label.GetName(), blockingLabel) {
+				failures = append(failures, fmt.Sprintf("It's labeled `%s`.", label.GetName()))
+			}
+		}
+	}
+
+	if config.RequireGreenStatuses || config.RequireLGTM {
+		sha := pr.GetHead().GetSHA()
+		combined, _, err := context.GitHub.Repositories.GetCombinedStatus(
+			context.Context(), owner, repo, sha, &github.ListOptions{PerPage: 100})
+		if err != nil {
+			return err
+		}
+		if config.RequireGreenStatuses {
+			failures = append(failures, statusFailures(owner, combined)...)
+		}
+		if config.RequireLGTM {
+			failures = append(failures, lgtmFailures(owner, combined)...)
+		}
+
+		if config.RequireGreenStatuses {
+			checkRuns, _, err := context.GitHub.Checks.ListCheckRunsForRef(
+				context.Context(), owner, repo, sha, &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}})
+			if err != nil {
+				return err
+			}
+			failures = append(failures, checkRunFailures(checkRuns.CheckRuns)...)
+		}
+	}
+
+	if len(failures) > 0 {
+		return preflightError{failures: failures}
+	}
+	return nil
+}
+
+func mergeabilityFailures(pr *github.PullRequest) []string {
+	failures := []string{}
+	if pr.GetState() != "open" {
+		failures = append(failures, fmt.Sprintf("It's %s.", pr.GetState()))
+	}
+	if pr.GetMergeableState() == "draft" {
+		failures = append(failures, "It's a draft.")
+	}
+	if pr.Mergeable != nil && !*pr.Mergeable {
+		failures = append(failures, "It has merge conflicts.")
+	}
+	return failures
+}
+
+// statusFailures lists the commit statuses which haven't succeeded, other
+// than the merge queue's own. A commit without any statuses has nothing to
+// fail.
+func statusFailures(owner string, combined *github.CombinedStatus) []string {
+	failures := []string{}
+	for _, status := range combined.Statuses {
+		if status.GetContext() == mergeQueueContext(owner) {
+			continue
+		}
+		if status.GetState() != "success" {
+			failures = append(failures, fmt.Sprintf("The `%s` status is %s.", status.GetContext(), status.GetState()))
+		}
+	}
+	return failures
+}
+
+// lgtmContext is the context of the status set by the lgtm package.
+func lgtmContext(owner string) string {
+	return owner + "/lgtm"
+}
+
+// lgtmFailures requires the lgtm status set by the lgtm package to have
+// succeeded.
+func lgtmFailures(owner string, combined *github.CombinedStatus) []string {
+	for _, status := range combined.Statuses {
+		if status.GetContext() != lgtmContext(owner) {
+			continue
+		}
+		if status.GetState() == "success" {
+			return nil
+		}
+		return []string{fmt.Sprintf("It isn't approved yet: %s", status.GetDescription())}
+	}
+	return []string{fmt.Sprintf("It has no `%s` status yet. It's set when the PR is pushed to or a maintainer comments LGTM.", lgtmContext(owner))}
+}
+
+// checkRunFailures lists the check runs which haven't completed successfully.
+func checkRunFailures(checkRuns []*github.CheckRun) []string {
+	failures := []string{}
+	for _, checkRun := range checkRuns {
+		if checkRun.GetStatus() != "completed" {
+			failures = append(failures, fmt.Sprintf("The `%s` check is %s.", checkRun.GetName(), strings.Replace(checkRun.GetStatus(), "_", " ", -1)))
+			continue
+		}
+		switch checkRun.GetConclusion() {
+		case "success", "neutral", "skipped":
+		default:
+			failures = append(failures, fmt.Sprintf("The `%s` check concluded %s.", checkRun.GetName(), strings.Replace(checkRun.GetConclusion(), "_", " ", -1)))
+		}
+	}
+	return failures
+}
@@ -0,0 +1,83 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreflightErrorMessage(t *testing.T) {
+	assert.EqualError(t, preflightError{failures: []string{"It's a draft."}},
+		"1 pre-merge check failed:\n\n- It's a draft.")
+	assert.EqualError(t, preflightError{failures: []string{"It's a draft.", "It has merge conflicts."}},
+		"2 pre-merge checks failed:\n\n- It's a draft.\n- It has merge conflicts.")
+}
+
+func TestPreflightWithoutStatuses(t *testing.T) {
+	config := PreflightConfig{
+		RequireMergeable: true,
+		BlockingLabels:   []string{"needs-work"},
+		BaseBranches:     []string{"master"},
+	}
+	pr := &github.PullRequest{
+		State:          github.String("open"),
+		Mergeable:      github.Bool(false),
+		MergeableState: github.String("draft"),
+		Base:           &github.PullRequestBranch{Ref: github.String("3.8-stable")},
+		Labels:         []*github.Label{{Name: github.String("Needs-Work")}, {Name: github.String("bug")}},
+	}
+
+	err := preflight(nil, "o", "r", pr, config)
+	assert.Equal(t, preflightError{failures: []string{
+		"It's a draft.",
+		"It has merge conflicts.",
+		"It targets `3.8-stable`, but only `master` can be merged into.",
+		"It's labeled `Needs-Work`.",
+	}}, err)
+
+	pr = &github.PullRequest{
+		State: github.String("open"),
+		Base:  &github.PullRequestBranch{Ref: github.String("master")},
+	}
+	assert.NoError(t, preflight(nil, "o", "r", pr, config))
+}
+
+func TestStatusFailures(t *testing.T) {
+	combined := &github.CombinedStatus{Statuses: []github.RepoStatus{
+		{Context: github.String("o/lgtm"), State: github.String("pending"), Description: github.String("Awaiting approval from at least 2 maintainers.")},
+		{Context: github.String("ci"), State: github.String("success")},
+		{Context: github.String("coverage"), State: github.String("failure")},
+		{Context: github.String("o/merge-queue"), State: github.String("pending")},
+	}}
+
+	assert.Equal(t, []string{"The `o/lgtm` status is pending.", "The `coverage` status is failure."}, statusFailures("o", combined))
+	assert.Equal(t, []string{}, statusFailures("o", &github.CombinedStatus{}))
+	assert.Equal(t, []string{"It isn't approved yet: Awaiting approval from at least 2 maintainers."}, lgtmFailures("o", combined))
+	assert.Equal(t, []string{"It has no `x/lgtm` status yet. It's set when the PR is pushed to or a maintainer comments LGTM."}, lgtmFailures("x", combined))
+
+	combined.Statuses[0].State = github.String("success")
+	assert.Nil(t, lgtmFailures("o", combined))
+}
+
+func TestCheckRunFailures(t *testing.T) {
+	checkRuns := []*github.CheckRun{
+		{Name: github.String("build"), Status: github.String("completed"), Conclusion: github.String("success")},
+		{Name: github.String("lint"), Status: github.String("completed"), Conclusion: github.String("neutral")},
+		{Name: github.String("test"), Status: github.String("in_progress")},
+		{Name: github.String("deploy"), Status: github.String("completed"), Conclusion: github.String("timed_out")},
+	}
+	assert.Equal(t, []string{"The `test` check is in progress.", "The `deploy` check concluded timed out."}, checkRunFailures(checkRuns))
+}
+
+func TestPreflightConfigFor(t *testing.T) {
+	defer delete(preflightConfigs, "o/configured")
+
+	// Repos run no checks until they're configured to.
+	assert.Equal(t, PreflightConfig{}, preflightConfigFor("o", "r"))
+	assert.NoError(t, preflight(nil, "o", "r", &github.PullRequest{State: github.String("closed")}, preflightConfigFor("o", "r")))
+
+	config := PreflightConfig{RequireMergeable: true}
+	SetPreflightConfig("o", "configured", config)
+	assert.Equal(t, config, preflightConfigFor("o", "configured"))
+}
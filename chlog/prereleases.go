@@ -0,0 +1,71 @@
+package chlog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// finalReleaseMarker starts the link to the final release appended to
+// pre-release bodies.
+const finalReleaseMarker = "<!-- final release -->"
+
+// draftPrereleases are the repos whose pre-releases are created as drafts.
+var draftPrereleases = map[string]bool{}
+
+// SetDraftPrereleases sets whether the repo's pre-releases are created as
+// drafts, to be published by hand, rather than published right away.
+func SetDraftPrereleases(owner, repo string, draft bool) {
+	draftPrereleases[owner+"/"+repo] = draft
+}
+
+// LinkPrereleasesOnRelease links each pre-release of a published release,
+// e.g. v4.0.0.beta1 and v4.0.0-rc.1 for v4.0.0, to it.
+func LinkPrereleasesOnRelease(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.ReleaseEvent)
+	if !ok {
+		return context.NewError("chlog.LinkPrereleasesOnRelease: not a release event")
+	}
+
+	release := event.GetRelease()
+	if event.GetAction() != "published" || release.GetPrerelease() || release.GetDraft() {
+		return nil
+	}
+	version := extractVersion(release.GetTagName())
+	if version == "" || isPrerelease(version) {
+		return nil
+	}
+
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	releases, err := listReleases(context, owner, repo)
+	if err != nil {
+		return context.NewError("chlog.LinkPrereleasesOnRelease: couldn't list releases on %s/%s: %v", owner, repo, err)
+	}
+
+	link := fmt.Sprintf("%s\nThe final release is [%s](%s).", finalReleaseMarker, release.GetTagName(), release.GetHTMLURL())
+	for _, prerelease := range releases {
+		if !isPrereleaseOf(extractVersion(prerelease.GetTagName()), version) || strings.Contains(prerelease.GetBody(), finalReleaseMarker) {
+			continue
+		}
+		_, _, err := context.GitHub.Repositories.EditRelease(context.Context(), owner, repo, prerelease.GetID(), &github.RepositoryRelease{
+			Body: github.String(strings.TrimRight(prerelease.GetBody(), "\n") + "\n\n" + link),
+		})
+		if err != nil {
+			context.Log("chlog.LinkPrereleasesOnRelease: couldn't link %s to %s on %s/%s: %v",
+				prerelease.GetTagName(), release.GetTagName(), owner, repo, err)
+		}
+	}
+	return nil
+}
+
+// isPrereleaseOf returns true if the version is a pre-release leading up to
+// the release, e.g. "4.0.0.beta1" for "4.0.0".
+func isPrereleaseOf(version, release string) bool {
+	v, err := parseGemVersion(version)
+	if err != nil || !v.prerelease() {
+		return false
+	}
+	return compareVersions(v.release(), release) == 0
+}
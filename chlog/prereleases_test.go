@@ -0,0 +1,61 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPrereleaseOf(t *testing.T) {
+	assert.True(t, isPrereleaseOf("4.0.0.beta1", "4.0.0"))
+	assert.True(t, isPrereleaseOf("4.0.0-rc.1", "4.0.0"))
+	assert.False(t, isPrereleaseOf("4.0.0", "4.0.0"))
+	assert.False(t, isPrereleaseOf("4.0.1.beta1", "4.0.0"))
+	assert.False(t, isPrereleaseOf("", "4.0.0"))
+}
+
+func TestLinkPrereleasesOnRelease(t *testing.T) {
+	edits := map[int64]string{}
+
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"id": 4, "tag_name": "v4.0.0", "body": "Final"},
+			{"id": 3, "tag_name": "v4.0.0-rc.1", "body": "RC", "prerelease": true},
+			{"id": 2, "tag_name": "v4.0.0.beta1", "body": "Beta\n\n%s\nThe final release is v4.0.0.", "prerelease": true},
+			{"id": 1, "tag_name": "v3.9.0.beta1", "body": "Old beta", "prerelease": true}
+		]`, finalReleaseMarker)
+	})
+	for _, id := range []int64{1, 2, 3, 4} {
+		id := id
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/releases/%d", id), func(w http.ResponseWriter, r *http.Request) {
+			v := new(github.RepositoryRelease)
+			json.NewDecoder(r.Body).Decode(v)
+			edits[id] = v.GetBody()
+			fmt.Fprint(w, `{}`)
+		})
+	}
+
+	context := &ctx.Context{GitHub: client}
+
+	err := LinkPrereleasesOnRelease(context, &github.ReleaseEvent{
+		Action: github.String("published"),
+		Repo:   &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+		Release: &github.RepositoryRelease{
+			TagName: github.String("v4.0.0"),
+			HTMLURL: github.String("https://github.com/o/r/releases/tag/v4.0.0"),
+		},
+	})
+	assert.NoError(t, err)
+
+	// Only the rc is edited: the beta is already linked.
+	assert.Equal(t, map[int64]string{
+		3: "RC\n\n" + finalReleaseMarker + "\nThe final release is [v4.0.0](https://github.com/o/r/releases/tag/v4.0.0).",
+	}, edits)
+}
@@ -0,0 +1,220 @@
+package chlog
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/commands"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var (
+	releaseBranchRegexp = regexp.MustCompile(`\Arelease-(` + gemVersionPattern + `)\z`)
+	rubyVersionRegexp   = regexp.MustCompile(`VERSION\s*=\s*["']([^"']*)["']`)
+
+	versionFiles = map[string]string{}
+)
+
+// ReleaseCommand opens a PR which releases a version with
+// "@jekyllbot: release 4.1.0", usually on the "Time for a new release"
+// issue. Once the PR is merged, ReleaseOnMerge tags and releases it.
+var ReleaseCommand = &commands.Command{
+	Name:        "release",
+	Usage:       "release <version>",
+	Description: "Opens a pull request which moves the unreleased changes in the changelog under the version and bumps the gem's version. Once it's merged, the version is tagged and released.",
+	Permission:  commands.Push,
+	Run:         runReleaseCommand,
+}
+
+// SetVersionFile sets the path of the Ruby file defining the repo's VERSION
+// constant, which the release command bumps and tags are checked against. It
+// defaults to the gemspec convention of "lib/<repo>/version.rb". An empty
+// path means the repo has no version file.
+func SetVersionFile(owner, repo, path string) {
+	versionFiles[owner+"/"+repo] = path
+}
+
+func versionFileFor(owner, repo string) string {
+	if path, ok := versionFiles[owner+"/"+repo]; ok {
+		return path
+	}
+	return fmt.Sprintf("lib/%s/version.rb", repo)
+}
+
+func runReleaseCommand(context *ctx.Context, invocation *commands.Invocation) error {
+	if invocation.IsPullRequest() {
+		return fmt.Errorf("releases are cut from an issue, like the \"Time for a new release\" one")
+	}
+
+	fields := strings.Fields(invocation.Args)
+	if len(fields) != 1 || !isGemVersion(strings.TrimPrefix(fields[0], "v")) {
+		return fmt.Errorf("tell me which version to release, e.g. `@%s: release 4.1.0`", invocation.Bot)
+	}
+	version := strings.TrimPrefix(fields[0], "v")
+
+	pr, err := OpenReleasePR(context, invocation.Owner, invocation.Repo, version, invocation.Number, time.Now())
+	if err != nil {
+		return err
+	}
+	return invocation.Reply(context, fmt.Sprintf(
+		"I opened #%d to release %s. Once it's merged, I'll tag `v%s` and create the release.",
+		pr.GetNumber(), version, version))
+}
+
+// OpenReleasePR opens a PR against the changelog's branch which moves the
+// unreleased changes under the version, dated today, and bumps the version
+// file. Pre-releases leave the changelog alone, as their notes are read from
+// the unreleased changes. The issue, if any, is closed by the PR.
+func OpenReleasePR(context *ctx.Context, owner, repo, version string, issue int, today time.Time) (*github.PullRequest, error) {
+	base := changelogConfigFor(owner, repo).Branch
+	baseRef, _, err := context.GitHub.Git.GetRef(context.Context(), owner, repo, "heads/"+base)
+	if err != nil {
+		return nil, err
+	}
+	baseSHA := baseRef.GetObject().GetSHA()
+	baseCommit, _, err := context.GitHub.Git.GetCommit(context.Context(), owner, repo, baseSHA)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []github.TreeEntry{}
+	if !isPrerelease(version) {
+		entry, err := changelogFor(owner, repo).cutVersion(context, owner, repo, version, today.Format("2006-01-02"))
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	if path := versionFileFor(owner, repo); path != "" {
+		entry, err := bumpVersionFile(context, owner, repo, path, base, version)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("there's nothing to change to release %s", version)
+	}
+
+	tree, _, err := context.GitHub.Git.CreateTree(context.Context(), owner, repo, baseCommit.GetTree().GetSHA(), entries)
+	if err != nil {
+		return nil, err
+	}
+	commit, _, err := context.GitHub.Git.CreateCommit(context.Context(), owner, repo, &github.Commit{
+		Message: github.String("Release " + version),
+		Tree:    &github.Tree{SHA: tree.SHA},
+		Parents: []github.Commit{{SHA: github.String(baseSHA)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	branch := "release-" + version
+	_, resp, err := context.GitHub.Git.CreateRef(context.Context(), owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	})
+	if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil, fmt.Errorf("the `%s` branch already exists", branch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body := fmt.Sprintf("This releases %s. Once it's merged, I'll tag `v%s` and create the release.", version, version)
+	if issue != 0 {
+		body += fmt.Sprintf("\n\nCloses #%d.", issue)
+	}
+	pr, _, err := context.GitHub.PullRequests.Create(context.Context(), owner, repo, &github.NewPullRequest{
+		Title: github.String("Release " + version),
+		Head:  github.String(branch),
+		Base:  github.String(base),
+		Body:  github.String(body),
+	})
+	return pr, err
+}
+
+// bumpVersionFile returns the version file with its VERSION set to the
+// version, as a tree entry to commit.
+func bumpVersionFile(context *ctx.Context, owner, repo, path, branch, version string) (*github.TreeEntry, error) {
+	file, _, resp, err := context.GitHub.Repositories.GetContents(
+		context.Context(), owner, repo, path, &github.RepositoryContentGetOptions{Ref: "heads/" + branch})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("there's no %s to bump", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	contents, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+
+	newContents, err := setRubyVersion(contents, version)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &github.TreeEntry{
+		Path:    github.String(path),
+		Mode:    github.String("100644"),
+		Type:    github.String("blob"),
+		Content: github.String(newContents),
+	}, nil
+}
+
+// setRubyVersion replaces the value of the first VERSION constant.
+func setRubyVersion(contents, version string) (string, error) {
+	loc := rubyVersionRegexp.FindStringSubmatchIndex(contents)
+	if loc == nil {
+		return "", fmt.Errorf("couldn't find a VERSION constant")
+	}
+	return contents[:loc[2]] + version + contents[loc[3]:], nil
+}
+
+// rubyVersion returns the value of the first VERSION constant.
+func rubyVersion(contents string) (string, bool) {
+	matches := rubyVersionRegexp.FindStringSubmatch(contents)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// isReleaseBranch returns true if the branch is one opened by the release
+// command.
+func isReleaseBranch(branch string) bool {
+	return releaseBranchRegexp.MatchString(branch)
+}
+
+// ReleaseOnMerge tags and releases the version once its release PR, opened
+// by the release command, is merged.
+func ReleaseOnMerge(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PullRequestEvent)
+	if !ok {
+		return context.NewError("chlog.ReleaseOnMerge: not a pull request event")
+	}
+
+	pr := event.GetPullRequest()
+	if event.GetAction() != "closed" || !pr.GetMerged() {
+		return nil
+	}
+
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	matches := releaseBranchRegexp.FindStringSubmatch(pr.GetHead().GetRef())
+	if matches == nil || pr.GetHead().GetRepo().GetFullName() != event.GetRepo().GetFullName() {
+		return nil
+	}
+
+	tag := "v" + matches[1]
+	if err := createRelease(context, owner, repo, tag, pr.GetMergeCommitSHA()); err != nil {
+		return context.NewError("chlog.ReleaseOnMerge: couldn't release %s on %s/%s: %v", tag, owner, repo, err)
+	}
+	context.Log("chlog.ReleaseOnMerge: released %s on %s/%s", tag, owner, repo)
+	return nil
+}
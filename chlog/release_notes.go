@@ -0,0 +1,247 @@
+package chlog
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var (
+	// prReferenceRegexp finds the PR in the subject of a merge commit, e.g.
+	// "Merge pull request #123 from parkr/branch", or of a squashed one, e.g.
+	// "Fix the thing (#123)".
+	prReferenceRegexp = regexp.MustCompile(`\AMerge pull request #(\d+)|\(#(\d+)\)\z`)
+
+	// otherChangesSection holds PRs without a category label.
+	otherChangesSection = "Other Changes"
+)
+
+// releaseNotesPR is a merged PR to list in the release notes.
+type releaseNotesPR struct {
+	number int
+	title  string
+	author string
+	body   string
+	labels []string
+	// firstTime is set if this was the author's first contribution.
+	firstTime bool
+}
+
+// GenerateReleaseNotes lists the PRs merged between the two refs, grouped
+// into the repo's changelog sections by their labels, followed by the people
+// who contributed them.
+func GenerateReleaseNotes(context *ctx.Context, owner, repo, base, head string) (string, error) {
+	prs, err := mergedPRsBetween(context, owner, repo, base, head)
+	if err != nil {
+		return "", err
+	}
+	if err := markFirstTimers(context, owner, repo, base, prs); err != nil {
+		return "", err
+	}
+	return renderReleaseNotes(prs, categoriesFor(owner, repo)), nil
+}
+
+// mergedPRsBetween finds the PRs merged between the refs from the subjects of
+// the commits between them.
+func mergedPRsBetween(context *ctx.Context, owner, repo, base, head string) ([]releaseNotesPR, error) {
+	comparison, _, err := context.GitHub.Repositories.CompareCommits(context.Context(), owner, repo, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	// The comparison lists at most 250 commits, so larger ranges are listed
+	// from the head back to the merge base's date.
+	commits := comparison.Commits
+	if len(commits) < comparison.GetTotalCommits() {
+		mergeBase := comparison.GetMergeBaseCommit()
+		commits, err = commitsSince(context, owner, repo, head, mergeBase.GetSHA(), mergeBase.GetCommit().GetCommitter().GetDate())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	prs := []releaseNotesPR{}
+	seen := map[int]bool{}
+	for _, commit := range commits {
+		number, ok := prNumberFromCommitMessage(commit.GetCommit().GetMessage())
+		if !ok || seen[number] {
+			continue
+		}
+		seen[number] = true
+
+		pr, _, err := context.GitHub.PullRequests.Get(context.Context(), owner, repo, number)
+		if err != nil {
+			return nil, err
+		}
+		if !pr.GetMerged() {
+			continue
+		}
+
+		labels := []string{}
+		for _, label := range pr.Labels {
+			labels = append(labels, label.GetName())
+		}
+		prs = append(prs, releaseNotesPR{
+			number: number,
+			title:  pr.GetTitle(),
+			author: pr.GetUser().GetLogin(),
+			body:   pr.GetBody(),
+			labels: labels,
+		})
+	}
+	return prs, nil
+}
+
+// commitsSince lists the commits reachable from head which were committed
+// since the date, other than the base commit itself.
+func commitsSince(context *ctx.Context, owner, repo, head, baseSHA string, since time.Time) ([]github.RepositoryCommit, error) {
+	commits := []github.RepositoryCommit{}
+	opts := &github.CommitsListOptions{SHA: head, Since: since, ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := context.GitHub.Repositories.ListCommits(context.Context(), owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range page {
+			if commit.GetSHA() == baseSHA {
+				continue
+			}
+			commits = append(commits, *commit)
+		}
+		if resp.NextPage == 0 {
+			return commits, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// markFirstTimers marks the first PR of each author who had no PR merged
+// before the base.
+func markFirstTimers(context *ctx.Context, owner, repo, base string, prs []releaseNotesPR) error {
+	commit, _, err := context.GitHub.Repositories.GetCommit(context.Context(), owner, repo, base)
+	if err != nil {
+		return err
+	}
+	since := commit.GetCommit().GetCommitter().GetDate()
+
+	checked := map[string]bool{}
+	for i, pr := range prs {
+		if pr.author == "" || checked[pr.author] {
+			continue
+		}
+		checked[pr.author] = true
+		contributedBefore, err := mergedPRsBefore(context, owner, repo, pr.author, since)
+		if err != nil {
+			return err
+		}
+		prs[i].firstTime = !contributedBefore
+	}
+	return nil
+}
+
+// mergedPRsBefore returns true if the author had a PR merged into the repo
+// before the date.
+func mergedPRsBefore(context *ctx.Context, owner, repo, author string, before time.Time) (bool, error) {
+	query := fmt.Sprintf("repo:%s/%s is:pr is:merged author:%s merged:<%s",
+		owner, repo, author, before.UTC().Format(time.RFC3339))
+	result, _, err := context.GitHub.Search.Issues(context.Context(), query,
+		&github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+	if err != nil {
+		return false, err
+	}
+	return result.GetTotal() > 0, nil
+}
+
+// prNumberFromCommitMessage returns the PR which the commit merged.
+func prNumberFromCommitMessage(message string) (int, bool) {
+	subject := strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+	matches := prReferenceRegexp.FindStringSubmatch(subject)
+	if matches == nil {
+		return 0, false
+	}
+	number, err := strconv.Atoi(matches[1] + matches[2])
+	return number, err == nil
+}
+
+// sectionForPRLabels returns the section of the category matching the
+// labels, if any.
+func sectionForPRLabels(labels []string, categories []ChangelogCategory) string {
+	if category, ok := categoryForLabels(labels, categories); ok {
+		return category.Section
+	}
+	return otherChangesSection
+}
+
+// renderReleaseNotes renders the PRs as markdown, with a section per category
+// in the order they're configured and a list of contributors at the end.
+func renderReleaseNotes(prs []releaseNotesPR, categories []ChangelogCategory) string {
+	if len(prs) == 0 {
+		return ""
+	}
+
+	sections := []string{}
+	for _, category := range categories {
+		if !containsString(sections, category.Section) {
+			sections = append(sections, category.Section)
+		}
+	}
+	sections = append(sections, otherChangesSection)
+
+	bySection := map[string][]releaseNotesPR{}
+	for _, pr := range prs {
+		section := sectionForPRLabels(pr.labels, categories)
+		bySection[section] = append(bySection[section], pr)
+	}
+
+	var notes bytes.Buffer
+	for _, section := range sections {
+		if len(bySection[section]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&notes, "### %s\n\n", section)
+		for _, pr := range bySection[section] {
+			fmt.Fprintf(&notes, "  * %s (#%d)\n", template.HTMLEscapeString(strings.TrimSpace(pr.title)), pr.number)
+		}
+		notes.WriteString("\n")
+	}
+
+	authors := []string{}
+	firstTimers := []string{}
+	for _, pr := range prs {
+		if pr.author == "" {
+			continue
+		}
+		if !containsString(authors, "@"+pr.author) {
+			authors = append(authors, "@"+pr.author)
+		}
+		if pr.firstTime {
+			firstTimers = append(firstTimers, fmt.Sprintf("  * @%s made their first contribution in #%d\n", pr.author, pr.number))
+		}
+	}
+	sort.Strings(authors)
+
+	if len(authors) > 0 {
+		fmt.Fprintf(&notes, "### Contributors\n\nThanks to %s!\n", toSentence(authors))
+	}
+	if len(firstTimers) > 0 {
+		notes.WriteString("\n### New Contributors\n\n")
+		notes.WriteString(strings.Join(firstTimers, ""))
+	}
+	return notes.String()
+}
+
+// toSentence joins the words like "a, b and c".
+func toSentence(words []string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
@@ -0,0 +1,140 @@
+package chlog
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRNumberFromCommitMessage(t *testing.T) {
+	cases := []struct {
+		message string
+		number  int
+		ok      bool
+	}{
+		{"Merge pull request #123 from parkr/branch\n\nMerge pull request 123", 123, true},
+		{"Fix the thing (#45)\n\nCo-authored-by: Someone <someone@example.com>", 45, true},
+		{"Update history to reflect merge of #45 [ci skip]", 0, false},
+		{"Fix #45 and refactor", 0, false},
+	}
+	for _, c := range cases {
+		number, ok := prNumberFromCommitMessage(c.message)
+		assert.Equal(t, c.ok, ok, "%q", c.message)
+		assert.Equal(t, c.number, number, "%q", c.message)
+	}
+}
+
+func TestSectionForPRLabels(t *testing.T) {
+	assert.Equal(t, "Bug Fixes", sectionForPRLabels([]string{"pending-rebase", "bug"}, defaultCategories))
+	assert.Equal(t, "Minor Enhancements", sectionForPRLabels([]string{"minor-enhancements"}, defaultCategories))
+	assert.Equal(t, "Other Changes", sectionForPRLabels([]string{"question"}, defaultCategories))
+	assert.Equal(t, "Other Changes", sectionForPRLabels(nil, defaultCategories))
+}
+
+func TestRenderReleaseNotes(t *testing.T) {
+	assert.Equal(t, "", renderReleaseNotes(nil, defaultCategories))
+
+	notes := renderReleaseNotes([]releaseNotesPR{
+		{number: 3, title: "Fix <it>", author: "parkr", labels: []string{"bug"}},
+		{number: 5, title: "Tweak it", author: "octocat"},
+		{number: 7, title: "Add a feature ", author: "newbie", labels: []string{"feature"}, firstTime: true},
+		{number: 8, title: "Fix it again", author: "parkr", labels: []string{"fix"}},
+	}, defaultCategories)
+	assert.Equal(t, "### Major Enhancements\n\n"+
+		"  * Add a feature (#7)\n\n"+
+		"### Bug Fixes\n\n"+
+		"  * Fix &lt;it&gt; (#3)\n"+
+		"  * Fix it again (#8)\n\n"+
+		"### Other Changes\n\n"+
+		"  * Tweak it (#5)\n\n"+
+		"### Contributors\n\n"+
+		"Thanks to @newbie, @octocat and @parkr!\n\n"+
+		"### New Contributors\n\n"+
+		"  * @newbie made their first contribution in #7\n", notes)
+}
+
+func TestToSentence(t *testing.T) {
+	assert.Equal(t, "", toSentence(nil))
+	assert.Equal(t, "a", toSentence([]string{"a"}))
+	assert.Equal(t, "a and b", toSentence([]string{"a", "b"}))
+	assert.Equal(t, "a, b and c", toSentence([]string{"a", "b", "c"}))
+}
+
+func TestGenerateReleaseNotes(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_commits": 4, "commits": [
+			{"commit": {"message": "Fix it (#2)"}},
+			{"commit": {"message": "Update history to reflect merge of #2 [ci skip]"}},
+			{"commit": {"message": "Merge pull request #3 from o/docs"}},
+			{"commit": {"message": "Revert \"Merge pull request #3 from o/docs\""}}
+		]}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 2, "title": "Fix it", "merged": true, "user": {"login": "parkr"}, "labels": [{"name": "bug"}], "author_association": "FIRST_TIME_CONTRIBUTOR"}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 3, "title": "Document it", "merged": true, "user": {"login": "octocat"}, "author_association": "CONTRIBUTOR"}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/v1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "v1", "commit": {"committer": {"date": "2019-01-01T00:00:00Z"}}}`)
+	})
+	searches := []string{}
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		searches = append(searches, query)
+		if strings.Contains(query, "author:parkr ") {
+			fmt.Fprint(w, `{"total_count": 12}`)
+			return
+		}
+		fmt.Fprint(w, `{"total_count": 0}`)
+	})
+
+	notes, err := GenerateReleaseNotes(&ctx.Context{GitHub: client}, "o", "r", "v1.0.0", "v1.1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "### Bug Fixes\n\n  * Fix it (#2)\n\n### Other Changes\n\n  * Document it (#3)\n\n"+
+		"### Contributors\n\nThanks to @octocat and @parkr!\n\n"+
+		"### New Contributors\n\n  * @octocat made their first contribution in #3\n", notes)
+	assert.Equal(t, []string{
+		"repo:o/r is:pr is:merged author:parkr merged:<2019-01-01T00:00:00Z",
+		"repo:o/r is:pr is:merged author:octocat merged:<2019-01-01T00:00:00Z",
+	}, searches)
+}
+
+func TestMergedPRsBetweenListsLargeRanges(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/compare/v1.0.0...v2.0.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_commits": 300, "merge_base_commit": {"sha": "v1", "commit": {"committer": {"date": "2019-01-01T00:00:00Z"}}}, "commits": [
+			{"commit": {"message": "Fix it (#2)"}}
+		]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "v2.0.0", r.URL.Query().Get("sha"))
+		assert.Equal(t, "2019-01-01T00:00:00Z", r.URL.Query().Get("since"))
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"sha": "b", "commit": {"message": "Merge pull request #3 from o/docs"}}, {"sha": "v1", "commit": {"message": "Fix that (#1)"}}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s/repos/o/r/commits?page=2>; rel="next"`, r.Host, baseURLPath))
+		fmt.Fprint(w, `[{"sha": "a", "commit": {"message": "Fix it (#2)"}}]`)
+	})
+	for _, number := range []int{1, 2, 3} {
+		number := number
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/pulls/%d", number), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"number": %d, "merged": true}`, number)
+		})
+	}
+
+	prs, err := mergedPRsBetween(&ctx.Context{GitHub: client}, "o", "r", "v1.0.0", "v2.0.0")
+	assert.NoError(t, err)
+	if assert.Len(t, prs, 2) {
+		assert.Equal(t, 2, prs[0].number)
+		assert.Equal(t, 3, prs[1].number)
+	}
+}
@@ -0,0 +1,240 @@
+package chlog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRubyVersion(t *testing.T) {
+	bumped, err := setRubyVersion("module Jekyll\n  VERSION = \"4.0.1\".freeze\nend\n", "4.1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "module Jekyll\n  VERSION = \"4.1.0\".freeze\nend\n", bumped)
+
+	bumped, err = setRubyVersion("module Jekyll\n  VERSION = '4.0.1'\nend\n", "4.1.0.pre.beta1")
+	assert.NoError(t, err)
+	assert.Equal(t, "module Jekyll\n  VERSION = '4.1.0.pre.beta1'\nend\n", bumped)
+
+	_, err = setRubyVersion("module Jekyll\nend\n", "4.1.0")
+	assert.Error(t, err)
+}
+
+func TestIsReleaseBranch(t *testing.T) {
+	assert.True(t, isReleaseBranch("release-4.1.0"))
+	assert.True(t, isReleaseBranch("release-4.1.0.pre.rc1"))
+	assert.False(t, isReleaseBranch("release-notes"))
+	assert.False(t, isReleaseBranch("fix-release-4.1.0"))
+}
+
+// releaseRequests records what releasing from o/r does.
+type releaseRequests struct {
+	history, versionFile string
+
+	entries []github.TreeEntry
+	refs    []string
+	newPR   *github.NewPullRequest
+	release *github.RepositoryRelease
+	issue   *github.IssueRequest
+}
+
+func serveContents(w http.ResponseWriter, contents string) {
+	json.NewEncoder(w).Encode(&github.RepositoryContent{
+		Encoding: github.String("base64"),
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(contents))),
+		SHA:      github.String("blob"),
+	})
+}
+
+func newTestReleaseServer(t *testing.T) (*ctx.Context, *releaseRequests, func()) {
+	requests := &releaseRequests{
+		history:     "## HEAD\n\n  * Fix a bug (#1)\n\n## 4.0.1 / 2019-01-01\n\n  * Fix another bug (#0)\n",
+		versionFile: "module R\n  VERSION = \"4.0.1\"\nend\n",
+	}
+
+	setup() // server & client!
+	mux.HandleFunc("/repos/o/r/git/refs/heads/master", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref": "refs/heads/master", "object": {"sha": "base"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/commits/base", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "base", "tree": {"sha": "base-tree"}}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		serveContents(w, requests.history)
+	})
+	mux.HandleFunc("/repos/o/r/contents/lib/r/version.rb", func(w http.ResponseWriter, r *http.Request) {
+		serveContents(w, requests.versionFile)
+	})
+	mux.HandleFunc("/repos/o/r/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		v := struct {
+			BaseTree string             `json:"base_tree"`
+			Entries  []github.TreeEntry `json:"tree"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&v)
+		assert.Equal(t, "base-tree", v.BaseTree)
+		requests.entries = v.Entries
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha": "release-tree"}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		v := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&v)
+		assert.Equal(t, "release-tree", v["tree"])
+		assert.Equal(t, []interface{}{"base"}, v["parents"])
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha": "release-commit"}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		v := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&v)
+		requests.refs = append(requests.refs, fmt.Sprintf("%s@%s", v["ref"], v["sha"]))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		requests.newPR = new(github.NewPullRequest)
+		json.NewDecoder(r.Body).Decode(requests.newPR)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"number": 12}`)
+	})
+	mux.HandleFunc("/repos/o/r/releases/tags/", func(w http.ResponseWriter, r *http.Request) {
+		if requests.release == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(requests.release)
+	})
+	mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+		requests.issue = new(github.IssueRequest)
+		json.NewDecoder(r.Body).Decode(requests.issue)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		requests.release = new(github.RepositoryRelease)
+		json.NewDecoder(r.Body).Decode(requests.release)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+
+	return &ctx.Context{GitHub: client}, requests, teardown
+}
+
+func TestOpenReleasePR(t *testing.T) {
+	context, requests, teardown := newTestReleaseServer(t)
+	defer teardown()
+
+	pr, err := OpenReleasePR(context, "o", "r", "4.1.0", 11, time.Date(2019, 2, 3, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, 12, pr.GetNumber())
+
+	if assert.Len(t, requests.entries, 2) {
+		assert.Equal(t, "History.markdown", requests.entries[0].GetPath())
+		assert.Equal(t, "## 4.1.0 / 2019-02-03\n\n  * Fix a bug (#1)\n\n## 4.0.1 / 2019-01-01\n\n  * Fix another bug (#0)\n", requests.entries[0].GetContent())
+		assert.Equal(t, "lib/r/version.rb", requests.entries[1].GetPath())
+		assert.Equal(t, "module R\n  VERSION = \"4.1.0\"\nend\n", requests.entries[1].GetContent())
+	}
+	assert.Equal(t, []string{"refs/heads/release-4.1.0@release-commit"}, requests.refs)
+	if assert.NotNil(t, requests.newPR) {
+		assert.Equal(t, "Release 4.1.0", requests.newPR.GetTitle())
+		assert.Equal(t, "release-4.1.0", requests.newPR.GetHead())
+		assert.Equal(t, "master", requests.newPR.GetBase())
+		assert.Contains(t, requests.newPR.GetBody(), "Closes #11.")
+	}
+}
+
+func TestOpenReleasePRForPreRelease(t *testing.T) {
+	context, requests, teardown := newTestReleaseServer(t)
+	defer teardown()
+
+	_, err := OpenReleasePR(context, "o", "r", "4.1.0.pre.beta1", 0, time.Now())
+	assert.NoError(t, err)
+
+	// The unreleased changes stay under HEAD until the release.
+	if assert.Len(t, requests.entries, 1) {
+		assert.Equal(t, "lib/r/version.rb", requests.entries[0].GetPath())
+	}
+	assert.NotContains(t, requests.newPR.GetBody(), "Closes")
+}
+
+func TestReleaseOnMerge(t *testing.T) {
+	context, requests, teardown := newTestReleaseServer(t)
+	defer teardown()
+
+	repo := &github.Repository{
+		Name:     github.String("r"),
+		FullName: github.String("o/r"),
+		Owner:    &github.User{Login: github.String("o")},
+	}
+	event := &github.PullRequestEvent{
+		Action: github.String("closed"),
+		Repo:   repo,
+		PullRequest: &github.PullRequest{
+			Merged:         github.Bool(true),
+			MergeCommitSHA: github.String("merged"),
+			Head:           &github.PullRequestBranch{Ref: github.String("release-4.1.0"), Repo: repo},
+		},
+	}
+
+	// The release PR has been merged, so the changelog has the version.
+	requests.history = "## 4.1.0 / 2019-02-03\n\n  * Fix a bug (#1)\n"
+	requests.versionFile = "module R\n  VERSION = \"4.1.0\"\nend\n"
+	assert.NoError(t, ReleaseOnMerge(context, event))
+	if assert.NotNil(t, requests.release) {
+		assert.Equal(t, "v4.1.0", requests.release.GetTagName())
+		assert.Equal(t, "merged", requests.release.GetTargetCommitish())
+		assert.Equal(t, "  * Fix a bug (#1)", requests.release.GetBody())
+		assert.False(t, requests.release.GetPrerelease())
+		assert.False(t, requests.release.GetDraft())
+	}
+	assert.Nil(t, requests.issue)
+
+	// The tag's create event finds the release already made.
+	requests.release.Body = github.String("already released")
+	assert.NoError(t, CreateReleaseOnTagHandler(context, &github.CreateEvent{
+		Ref:     github.String("v4.1.0"),
+		RefType: github.String("tag"),
+		Repo:    repo,
+	}))
+	assert.Equal(t, "already released", requests.release.GetBody())
+}
+
+func TestCreateReleaseWithStaleVersionFile(t *testing.T) {
+	context, requests, teardown := newTestReleaseServer(t)
+	defer teardown()
+
+	requests.history = "## 4.1.0 / 2019-02-03\n\n  * Fix a bug (#1)\n"
+	assert.NoError(t, createRelease(context, "o", "r", "v4.1.0", ""))
+
+	if assert.NotNil(t, requests.release) {
+		assert.True(t, requests.release.GetDraft())
+	}
+	if assert.NotNil(t, requests.issue) {
+		assert.Equal(t, "v4.1.0 was tagged, but lib/r/version.rb says 4.0.1", requests.issue.GetTitle())
+	}
+}
+
+func TestCreatePrerelease(t *testing.T) {
+	context, requests, teardown := newTestReleaseServer(t)
+	defer teardown()
+
+	// RubyGems reads "4.1.0-rc.1" as "4.1.0.pre.rc.1".
+	requests.versionFile = "module R\n  VERSION = \"4.1.0.pre.rc.1\"\nend\n"
+	SetDraftPrereleases("o", "r", true)
+	defer SetDraftPrereleases("o", "r", false)
+	assert.NoError(t, createRelease(context, "o", "r", "v4.1.0-rc.1", ""))
+
+	if assert.NotNil(t, requests.release) {
+		// There's no 4.1.0-rc.1 section, so the unreleased changes are used.
+		assert.Equal(t, "  * Fix a bug (#1)", requests.release.GetBody())
+		assert.True(t, requests.release.GetPrerelease())
+		assert.True(t, requests.release.GetDraft())
+	}
+	assert.Nil(t, requests.issue)
+}
@@ -0,0 +1,158 @@
+package chlog
+
+import (
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// releaseSyncDryRuns are the repos whose release bodies are only diffed, not
+// updated, when their changelog is edited. Repos not listed are dry runs.
+var releaseSyncDryRuns = map[string]bool{}
+
+// SetReleaseSyncDryRun sets whether SyncReleaseBodiesOnPush only logs the
+// changes it would make to the repo's releases. It does until this is set
+// to false.
+func SetReleaseSyncDryRun(owner, repo string, dryRun bool) {
+	releaseSyncDryRuns[owner+"/"+repo] = dryRun
+}
+
+func isReleaseSyncDryRun(owner, repo string) bool {
+	dryRun, ok := releaseSyncDryRuns[owner+"/"+repo]
+	return dryRun || !ok
+}
+
+// SyncReleaseBodiesOnPush updates the bodies of published releases when the
+// changes listed for them are edited in the changelog. Only versions whose
+// section the push changed are synced. Each release's diff is logged before
+// it's updated. Anything added to a release after its notes, like the
+// milestone summary, is kept.
+func SyncReleaseBodiesOnPush(context *ctx.Context, payload interface{}) error {
+	push, ok := payload.(*github.PushEvent)
+	if !ok {
+		return context.NewError("chlog.SyncReleaseBodiesOnPush: not a push event")
+	}
+
+	owner, repo := push.GetRepo().GetOwner().GetName(), push.GetRepo().GetName()
+
+	// Fragments are removed once they're released, so there's nothing to
+	// sync from.
+	changelog, ok := changelogFor(owner, repo).(singleFileChangelog)
+	if !ok || push.GetRef() != "refs/heads/"+changelog.Branch || !pushModifies(push, changelog.Path) {
+		return nil
+	}
+
+	before, _, err := readFileAt(context, owner, repo, changelog.Path, push.GetBefore())
+	if err != nil {
+		return context.NewError("chlog.SyncReleaseBodiesOnPush: couldn't read %s at %s on %s/%s: %v", changelog.Path, push.GetBefore(), owner, repo, err)
+	}
+	after, _, err := readFileAt(context, owner, repo, changelog.Path, push.GetAfter())
+	if err != nil {
+		return context.NewError("chlog.SyncReleaseBodiesOnPush: couldn't read %s at %s on %s/%s: %v", changelog.Path, push.GetAfter(), owner, repo, err)
+	}
+
+	releases, err := listReleases(context, owner, repo)
+	if err != nil {
+		return context.NewError("chlog.SyncReleaseBodiesOnPush: couldn't list releases on %s/%s: %v", owner, repo, err)
+	}
+
+	for _, release := range releases {
+		body, changed := syncedReleaseBody(changelog.format, before, after, release)
+		if !changed {
+			continue
+		}
+
+		diff := releaseBodyDiff(release, changelog.Path, body)
+		if isReleaseSyncDryRun(owner, repo) {
+			context.Log("chlog.SyncReleaseBodiesOnPush: would update %s on %s/%s:\n%s", release.GetTagName(), owner, repo, diff)
+			continue
+		}
+		context.Log("chlog.SyncReleaseBodiesOnPush: updating %s on %s/%s:\n%s", release.GetTagName(), owner, repo, diff)
+		_, _, err := context.GitHub.Repositories.EditRelease(context.Context(), owner, repo, release.GetID(), &github.RepositoryRelease{
+			Body: github.String(body),
+		})
+		if err != nil {
+			context.Log("chlog.SyncReleaseBodiesOnPush: couldn't update %s on %s/%s: %v", release.GetTagName(), owner, repo, err)
+		}
+	}
+	return nil
+}
+
+// pushModifies returns true if any of the pushed commits add or modify the
+// file.
+func pushModifies(push *github.PushEvent, path string) bool {
+	for _, commit := range push.Commits {
+		if containsString(commit.Added, path) || containsString(commit.Modified, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func listReleases(context *ctx.Context, owner, repo string) ([]*github.RepositoryRelease, error) {
+	allReleases := []*github.RepositoryRelease{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		releases, resp, err := context.GitHub.Repositories.ListReleases(context.Context(), owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		allReleases = append(allReleases, releases...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allReleases, nil
+}
+
+// syncedReleaseBody returns the release's body with its notes replaced by
+// the changelog's for its version, and whether that changed it. Only
+// versions whose section differs between the changelog before and after the
+// push are synced, so releases edited by hand or with generated notes are
+// otherwise left alone. Sections which are new are left alone too, since
+// their release's notes weren't read from them, as are drafts and
+// pre-releases, whose notes were read from the unreleased changes.
+func syncedReleaseBody(format fileFormat, before, after string, release *github.RepositoryRelease) (string, bool) {
+	version := extractVersion(release.GetTagName())
+	if version == "" || release.GetDraft() || release.GetPrerelease() {
+		return "", false
+	}
+	notes, err := format.versionNotes(after, version)
+	if err != nil || strings.TrimSpace(notes) == "" {
+		return "", false
+	}
+	previousNotes, err := format.versionNotes(before, version)
+	if err != nil || strings.TrimSpace(previousNotes) == "" || strings.TrimSpace(previousNotes) == strings.TrimSpace(notes) {
+		return "", false
+	}
+
+	body, rest := release.GetBody(), ""
+	if i := strings.Index(body, milestoneSummaryMarker); i >= 0 {
+		body, rest = body[:i], body[i:]
+	}
+	if strings.TrimSpace(body) == strings.TrimSpace(notes) {
+		return "", false
+	}
+	if rest != "" {
+		return strings.TrimRight(notes, "\n") + "\n\n" + rest, true
+	}
+	return notes, true
+}
+
+// releaseBodyDiff shows how the release's body changes.
+func releaseBodyDiff(release *github.RepositoryRelease, path, body string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(release.GetBody()),
+		B:        difflib.SplitLines(body),
+		FromFile: release.GetTagName() + " release",
+		ToFile:   path,
+		Context:  2,
+	})
+	if err != nil {
+		return err.Error()
+	}
+	return diff
+}
@@ -0,0 +1,111 @@
+package chlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+const syncHistoryFixture = "## HEAD\n\n  * Fix a third bug (#3)\n\n" +
+	"## 1.1.0 / 2018-02-01\n\n  * Fix another bug, properly (#2)\n\n" +
+	"## 1.0.0 / 2018-01-01\n\n  * Fix a bug (#1)\n"
+
+// syncHistoryBeforeFixture is the changelog before the 1.1.0 section was
+// edited. 1.0.0's section is the same, though its release differs from it.
+const syncHistoryBeforeFixture = "## HEAD\n\n  * Fix a third bug (#3)\n\n" +
+	"## 1.1.0 / 2018-02-01\n\n  * Fix another bug (#2)\n\n" +
+	"## 1.0.0 / 2018-01-01\n\n  * Fix a bug (#1)\n"
+
+func TestSyncedReleaseBody(t *testing.T) {
+	release := func(tag, body string) *github.RepositoryRelease {
+		return &github.RepositoryRelease{TagName: github.String(tag), Body: github.String(body)}
+	}
+
+	body, changed := syncedReleaseBody(historyMarkdown{}, syncHistoryBeforeFixture, syncHistoryFixture, release("v1.1.0", "  * Fix another bug (#2)\n"))
+	assert.True(t, changed)
+	assert.Equal(t, "  * Fix another bug, properly (#2)", body)
+
+	_, changed = syncedReleaseBody(historyMarkdown{}, syncHistoryBeforeFixture, syncHistoryFixture, release("v1.0.0", "  * Fix a bug (#1)"))
+	assert.False(t, changed)
+
+	// Releases whose section the push didn't change are left alone.
+	_, changed = syncedReleaseBody(historyMarkdown{}, syncHistoryBeforeFixture, syncHistoryFixture, release("v1.0.0", "Edited by hand"))
+	assert.False(t, changed)
+
+	// So are releases whose section is new.
+	_, changed = syncedReleaseBody(historyMarkdown{}, "## HEAD\n\n  * Fix a third bug (#3)\n", syncHistoryFixture, release("v1.1.0", "Generated notes"))
+	assert.False(t, changed)
+
+	// Releases without a version in the changelog are left alone.
+	_, changed = syncedReleaseBody(historyMarkdown{}, syncHistoryBeforeFixture, syncHistoryFixture, release("v0.9.0", "Generated notes"))
+	assert.False(t, changed)
+
+	// The milestone summary is kept.
+	summary := milestoneSummaryMarker + "\n### Milestone\n\n2 issues and pull requests were closed in the v1.1.0 milestone.\n"
+	body, changed = syncedReleaseBody(historyMarkdown{}, syncHistoryBeforeFixture, syncHistoryFixture, release("v1.1.0", "  * Fix another bug (#2)\n\n"+summary))
+	assert.True(t, changed)
+	assert.Equal(t, "  * Fix another bug, properly (#2)\n\n"+summary, body)
+}
+
+func TestSyncReleaseBodiesOnPush(t *testing.T) {
+	edits := map[int64]string{}
+
+	setup() // server & client!
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") == "before" {
+			serveContents(w, syncHistoryBeforeFixture)
+			return
+		}
+		serveContents(w, syncHistoryFixture)
+	})
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"id": 2, "tag_name": "v1.1.0", "body": "  * Fix another bug (#2)"},
+			{"id": 1, "tag_name": "v1.0.0", "body": "Edited by hand"}
+		]`)
+	})
+	mux.HandleFunc("/repos/o/r/releases/2", func(w http.ResponseWriter, r *http.Request) {
+		v := new(github.RepositoryRelease)
+		json.NewDecoder(r.Body).Decode(v)
+		edits[2] = v.GetBody()
+		fmt.Fprint(w, `{}`)
+	})
+
+	context := &ctx.Context{GitHub: client}
+
+	push := func(ref string, modified ...string) *github.PushEvent {
+		return &github.PushEvent{
+			Ref:    github.String(ref),
+			Before: github.String("before"),
+			After:  github.String("after"),
+			Repo: &github.PushEventRepository{
+				Name:  github.String("r"),
+				Owner: &github.PushEventRepoOwner{Name: github.String("o")},
+			},
+			Commits: []github.PushEventCommit{{Modified: modified}},
+		}
+	}
+
+	assert.NoError(t, SyncReleaseBodiesOnPush(context, push("refs/heads/master", "README.md")))
+	assert.NoError(t, SyncReleaseBodiesOnPush(context, push("refs/heads/fix-history", "History.markdown")))
+	assert.Empty(t, edits)
+
+	// Releases are only diffed until dry runs are turned off.
+	defer delete(releaseSyncDryRuns, "o/r")
+	assert.NoError(t, SyncReleaseBodiesOnPush(context, push("refs/heads/master", "History.markdown")))
+	assert.Empty(t, edits)
+
+	SetReleaseSyncDryRun("o", "r", true)
+	assert.NoError(t, SyncReleaseBodiesOnPush(context, push("refs/heads/master", "History.markdown")))
+	assert.Empty(t, edits)
+
+	SetReleaseSyncDryRun("o", "r", false)
+	assert.NoError(t, SyncReleaseBodiesOnPush(context, push("refs/heads/master", "History.markdown")))
+	assert.Equal(t, map[int64]string{2: "  * Fix another bug, properly (#2)"}, edits)
+}
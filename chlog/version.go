@@ -0,0 +1,134 @@
+package chlog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// gemVersionPattern matches the versions RubyGems accepts, e.g. "4.0.0",
+// "4.0.0.pre.alpha1", "4.0.0.beta2" and the semver "4.0.0-rc.1".
+const gemVersionPattern = `[0-9]+(?:\.[0-9a-zA-Z]+)*(?:-[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?`
+
+var (
+	gemVersionRegexp = regexp.MustCompile(`\A` + gemVersionPattern + `\z`)
+	// gemVersionSegmentRegexp splits a version into its numbers and words,
+	// so "beta2" is "beta" then 2.
+	gemVersionSegmentRegexp = regexp.MustCompile(`[0-9]+|[a-zA-Z]+`)
+)
+
+// gemVersion is a version as RubyGems reads it: a list of numeric and word
+// segments, where any word makes it a pre-release. Semver pre-releases are
+// read as RubyGems does, so "4.0.0-rc.1" is "4.0.0.pre.rc.1".
+type gemVersion struct {
+	original string
+	// segments are ints and strings.
+	segments []interface{}
+}
+
+// parseGemVersion parses a version like "4.0.0" or "4.0.0.pre.beta1".
+func parseGemVersion(version string) (gemVersion, error) {
+	if !gemVersionRegexp.MatchString(version) {
+		return gemVersion{}, fmt.Errorf("%q isn't a version", version)
+	}
+	v := gemVersion{original: version}
+	for _, segment := range gemVersionSegmentRegexp.FindAllString(strings.Replace(version, "-", ".pre.", -1), -1) {
+		if number, err := strconv.Atoi(segment); err == nil {
+			v.segments = append(v.segments, number)
+		} else {
+			v.segments = append(v.segments, segment)
+		}
+	}
+	return v, nil
+}
+
+// isGemVersion returns true if RubyGems would accept the version.
+func isGemVersion(version string) bool {
+	_, err := parseGemVersion(version)
+	return err == nil
+}
+
+func (v gemVersion) String() string {
+	return v.original
+}
+
+// prerelease returns true if the version has any word segments.
+func (v gemVersion) prerelease() bool {
+	for _, segment := range v.segments {
+		if _, ok := segment.(string); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// release returns the numbers before any pre-release words, e.g. "4.0.0"
+// for "4.0.0.pre.beta1".
+func (v gemVersion) release() string {
+	numbers := []string{}
+	for _, segment := range v.segments {
+		number, ok := segment.(int)
+		if !ok {
+			break
+		}
+		numbers = append(numbers, strconv.Itoa(number))
+	}
+	return strings.Join(numbers, ".")
+}
+
+// compare returns -1, 0 or 1 as the version is before, the same as or after
+// the other. Missing segments count as 0, and words come before numbers, so
+// pre-releases come before their release.
+func (v gemVersion) compare(other gemVersion) int {
+	for i := 0; i < len(v.segments) || i < len(other.segments); i++ {
+		var a, b interface{} = 0, 0
+		if i < len(v.segments) {
+			a = v.segments[i]
+		}
+		if i < len(other.segments) {
+			b = other.segments[i]
+		}
+		if result := compareSegments(a, b); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+func compareSegments(a, b interface{}) int {
+	aString, aIsString := a.(string)
+	bString, bIsString := b.(string)
+	switch {
+	case aIsString && bIsString:
+		return strings.Compare(aString, bString)
+	case aIsString:
+		return -1
+	case bIsString:
+		return 1
+	}
+	aNumber, bNumber := a.(int), b.(int)
+	switch {
+	case aNumber < bNumber:
+		return -1
+	case aNumber > bNumber:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// isPrerelease returns true if the version is a pre-release, e.g.
+// "4.0.0.beta2" or "4.0.0-rc.1".
+func isPrerelease(version string) bool {
+	v, err := parseGemVersion(version)
+	return err == nil && v.prerelease()
+}
+
+// compareVersions compares versions like "3.2.0" and "3.2.0.pre.beta1",
+// returning -1, 0 or 1. Pre-releases come before the release.
+func compareVersions(a, b string) int {
+	aVersion, _ := parseGemVersion(a)
+	bVersion, _ := parseGemVersion(b)
+	return aVersion.compare(bVersion)
+}
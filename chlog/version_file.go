@@ -0,0 +1,59 @@
+package chlog
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// versionFileMismatch reads the repo's version file at the ref and returns
+// its path and the version it defines if that isn't the version. Both are
+// empty if it matches, e.g. "4.0.0.pre.rc.1" matches "4.0.0-rc.1", or if
+// there's no version file to check.
+func versionFileMismatch(context *ctx.Context, owner, repo, ref, version string) (path, fileVersion string, err error) {
+	path = versionFileFor(owner, repo)
+	if path == "" {
+		return "", "", nil
+	}
+
+	file, _, resp, err := context.GitHub.Repositories.GetContents(
+		context.Context(), owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		context.Log("chlog.versionFileMismatch: no %s at %s on %s/%s to check", path, ref, owner, repo)
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	contents, err := file.GetContent()
+	if err != nil {
+		return "", "", err
+	}
+
+	fileVersion, ok := rubyVersion(contents)
+	if !ok {
+		return path, "(no VERSION constant)", nil
+	}
+	if compareVersions(fileVersion, version) == 0 {
+		return "", "", nil
+	}
+	return path, fileVersion, nil
+}
+
+// reportVersionFileMismatch files an issue about the release of the tag
+// being held back as a draft because the version file disagrees with it.
+func reportVersionFileMismatch(context *ctx.Context, owner, repo, tag, path, fileVersion string) error {
+	version := extractVersion(tag)
+	_, _, err := context.GitHub.Issues.Create(context.Context(), owner, repo, &github.IssueRequest{
+		Title: github.String(fmt.Sprintf("%s was tagged, but %s says %s", tag, path, fileVersion)),
+		Body: github.String(fmt.Sprintf(
+			"`%s` was tagged, but `%s` at the tag defines `VERSION` as `%s`, not `%s`, "+
+				"so I created its release as a draft rather than announce the wrong version.\n\n"+
+				"Please set `VERSION` to `%s`, move the `%s` tag to that commit and publish the draft release, "+
+				"or delete the tag and the draft if it was pushed by mistake.",
+			tag, path, fileVersion, version, version, tag)),
+	})
+	return err
+}
@@ -0,0 +1,56 @@
+package chlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGemVersion(t *testing.T) {
+	cases := []struct {
+		version, release string
+		prerelease       bool
+	}{
+		{"4.0.0", "4.0.0", false},
+		{"4.0.0.pre.alpha1", "4.0.0", true},
+		{"4.0.0-rc.1", "4.0.0", true},
+		{"4.0.0.beta2", "4.0.0", true},
+		{"4.0", "4.0", false},
+	}
+	for _, c := range cases {
+		v, err := parseGemVersion(c.version)
+		if assert.NoError(t, err, c.version) {
+			assert.Equal(t, c.release, v.release(), c.version)
+			assert.Equal(t, c.prerelease, v.prerelease(), c.version)
+		}
+	}
+
+	for _, invalid := range []string{"", "lgtm", "v4.0.0", "4.0.0 beta", "4..0"} {
+		_, err := parseGemVersion(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestGemVersionCompare(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"4.0.0.pre.alpha1", "4.0.0.pre.beta1", -1},
+		{"4.0.0.pre.rc.1", "4.0.0-rc.1", 0},
+		{"4.0.0-rc.1", "4.0.0-rc.2", -1},
+		{"4.0.0.beta2", "4.0.0", -1},
+		{"4.0.0.beta2", "3.10.0", 1},
+		{"4.0", "4.0.0", 0},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, compareVersions(c.a, c.b), "%s <=> %s", c.a, c.b)
+	}
+}
+
+func TestExtractPrereleaseVersions(t *testing.T) {
+	assert.Equal(t, "4.0.0.pre.alpha1", extractVersion("v4.0.0.pre.alpha1"))
+	assert.Equal(t, "4.0.0-rc.1", extractVersion("v4.0.0-rc.1"))
+	assert.Equal(t, "4.0.0.beta2", extractVersion("v4.0.0.beta2"))
+	assert.Equal(t, "", extractVersion("vfoo"))
+}
@@ -30,6 +30,8 @@ func main() {
 		"app": "jekyllbot",
 	}))
 
+	http.Handle("/lgtm/", http.StripPrefix("/lgtm", jekyll.NewLgtmStatusPageHandler(context)))
+
 	log.Printf("Listening on :%s", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
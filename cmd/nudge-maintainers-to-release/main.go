@@ -5,9 +5,9 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"html/template"
 	"log"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/google/go-github/github"
@@ -23,26 +23,46 @@ import (
 var (
 	defaultRepos = jekyll.DefaultRepos
 
-	threeMonthsAgoUnix = time.Now().AddDate(0, -3, 0).Unix()
-
 	issueTitle  = "Time for a new release"
 	issueLabels = []string{"release"}
 
 	issueBodyTemplate = template.Must(template.New("issueBodyTemplate").Parse(`
 Hello, maintainers! :wave:
 
-By my calculations, it's time for a new release of {{.Repo.Name}}. {{if gt .CommitsOnMasterSinceLatestRelease 100}}There have been {{.CommitsOnMasterSinceLatestRelease}} commits{{else}}It's been over 3 months{{end}} since the last release, {{.LatestRelease.TagName}}.
+By my calculations, it's time for a new release of {{.Repo.Name}}. {{if gt .CommitsSinceRelease .Policy.MaxCommits}}There have been {{.CommitsSinceRelease}} commits on ` + "`{{.DefaultBranch}}`" + `{{else}}It's been over {{.Policy.MaxAgeDays}} days{{end}} since the last release, {{.LatestRelease.TagName}}. Here's how ready it looks:
+
+### Unreleased changes
+
+{{if .UnreleasedChanges}}{{.UnreleasedChanges}}{{else}}There's nothing in the changelog yet. Please make sure to update it before releasing.{{end}}
+
+### Open pull requests
+{{if .Milestone}}
+{{if .MilestonePRs}}These are still open in the {{.Milestone.Title}} milestone:
+{{range .MilestonePRs}}
+- [ ] #{{.Number}}{{end}}{{else}}Everything in the {{.Milestone.Title}} milestone is closed.{{end}}
+{{else}}
+There's no milestone for the next version.
+{{end}}
+### CI
 
-What else is left to be done before a new release can be made? Please make sure to update History.markdown too if it's not already updated.
+{{if .CIState}}The latest commit on ` + "`{{.DefaultBranch}}`" + ` is **{{.CIState}}**.{{else}}Nothing has reported a status or check on ` + "`{{.DefaultBranch}}`" + ` yet.{{end}}
+
+### Outdated dependencies
+{{if .OutdatedDependencies}}
+{{range .OutdatedDependencies}}
+- {{.Name}} is constrained to ` + "`{{.Constraint}}`" + `, but the latest version is {{.LatestVersion}}{{end}}
+{{else}}
+All dependencies are up to date.
+{{end}}
+What else is left to be done before a new release can be made? When it's ready, comment ` + "`@jekyllbot: release <version>`" + ` here and I'll open a pull request to release it.
 
 Thanks! :revolving_hearts: :sparkles:
 `))
 )
 
 type templateInfo struct {
-	Repo                              jekyll.Repository
-	CommitsOnMasterSinceLatestRelease int
-	LatestRelease                     *github.RepositoryRelease
+	*releases.ReadinessReport
+	Policy releases.CadencePolicy
 }
 
 func main() {
@@ -50,13 +70,19 @@ func main() {
 	flag.BoolVar(&perform, "f", false, "Whether to actually file issues.")
 	var inputRepos string
 	flag.StringVar(&inputRepos, "repos", "", "Specify a list of comma-separated repo name/owner pairs, e.g. 'jekyll/jekyll-import'.")
+	cadence := releases.DefaultCadencePolicy
+	flag.IntVar(&cadence.MaxCommits, "max-commits", cadence.MaxCommits, "How many commits can land before a release is due, for repos without their own policy.")
+	flag.IntVar(&cadence.MinCommits, "min-commits", cadence.MinCommits, "How many commits need to land before a release is due because of its age, for repos without their own policy.")
+	maxAgeDays := flag.Int("max-age-days", cadence.MaxAgeDays(), "How many days after the latest release a release is due, for repos without their own policy.")
 	flag.Parse()
+	cadence.MaxAge = time.Duration(*maxAgeDays) * 24 * time.Hour
 
 	// Get latest 10 releases.
 	// Sort releases by semver version, taking highest one.
 	//
-	// Has there been 100 commits since this release? If so, make an issue.
-	// Has at least 1 commit been made since this release & is this release at least 2 month old? If so, make an issue.
+	// Is a release due under the repo's cadence policy, judging by the commits
+	// on its default branch since this release and this release's age? If so,
+	// make an issue with a report of how ready the next release is.
 
 	var repos []jekyll.Repository
 	if inputRepos == "" {
@@ -78,6 +104,7 @@ func main() {
 		if context.GitHub == nil {
 			return errors.New("cannot proceed without github client")
 		}
+		jekyll.ConfigureChlog()
 
 		if inputRepos != "" {
 			repos = []jekyll.Repository{}
@@ -90,6 +117,12 @@ func main() {
 			}
 		}
 
+		// The flags only change the default, so repos with their own policy
+		// keep it.
+		if err := releases.SetDefaultCadencePolicy(cadence); err != nil {
+			return err
+		}
+
 		wg, _ := errgroup.WithContext(context.Context())
 		for _, repo := range repos {
 			repo := repo
@@ -104,45 +137,53 @@ func main() {
 					return nil
 				}
 
-				commitsSinceLatestRelease, err := releases.CommitsSinceRelease(context, repo, latestRelease)
+				branch, err := releases.DefaultBranch(context, repo)
+				if err != nil {
+					log.Printf("%s error fetching default branch: %+v", repo, err)
+					return err
+				}
+
+				commitsSinceLatestRelease, err := releases.CommitsSinceRelease(context, repo, latestRelease, branch)
 				if err != nil {
 					log.Printf("%s error fetching commits since latest release: %+v", repo, err)
 					return err
 				}
 
-				if commitsSinceLatestRelease > 100 || (commitsSinceLatestRelease >= 3 && latestRelease.GetCreatedAt().Unix() <= threeMonthsAgoUnix) {
-					if perform {
-						err := fileIssue(context, templateInfo{
-							Repo:                              repo,
-							LatestRelease:                     latestRelease,
-							CommitsOnMasterSinceLatestRelease: commitsSinceLatestRelease,
-						})
-						if err != nil {
-							log.Printf("%s: nudged maintainers (release=%s commits=%d released_on=%s)",
-								repo,
-								latestRelease.GetTagName(),
-								commitsSinceLatestRelease,
-								latestRelease.GetCreatedAt(),
-							)
-						}
-						return err
-					} else {
-						log.Printf("%s is in need of a nudge (release=%s commits=%d released_on=%s)",
-							repo,
-							latestRelease.GetTagName(),
-							commitsSinceLatestRelease,
-							latestRelease.GetCreatedAt(),
-						)
-					}
-				} else {
+				policy := releases.CadencePolicyFor(repo.Owner(), repo.Name())
+				if !policy.Due(commitsSinceLatestRelease, latestRelease.GetCreatedAt().Time, time.Now()) {
 					log.Printf("%s is NOT in need of a nudge: (release=%s commits=%d released_on=%s)",
 						repo,
 						latestRelease.GetTagName(),
 						commitsSinceLatestRelease,
 						latestRelease.GetCreatedAt(),
 					)
+					return nil
 				}
 
+				if !perform {
+					log.Printf("%s is in need of a nudge (release=%s commits=%d released_on=%s)",
+						repo,
+						latestRelease.GetTagName(),
+						commitsSinceLatestRelease,
+						latestRelease.GetCreatedAt(),
+					)
+					return nil
+				}
+
+				report, err := releases.Readiness(context, repo, latestRelease, branch, commitsSinceLatestRelease)
+				if err != nil {
+					log.Printf("%s error gathering the readiness report: %+v", repo, err)
+					return err
+				}
+				if err := fileIssue(context, templateInfo{ReadinessReport: report, Policy: policy}); err != nil {
+					return err
+				}
+				log.Printf("%s: nudged maintainers (release=%s commits=%d released_on=%s)",
+					repo,
+					latestRelease.GetTagName(),
+					commitsSinceLatestRelease,
+					latestRelease.GetCreatedAt(),
+				)
 				return nil
 			})
 		}
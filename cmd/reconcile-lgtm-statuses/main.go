@@ -0,0 +1,81 @@
+// reconcile-lgtm-statuses is a CLI which recomputes the lgtm status of every open PR in the repos configured for lgtm.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/parkr/auto-reply/jekyll"
+	"github.com/parkr/auto-reply/sentry"
+)
+
+func main() {
+	var perform bool
+	flag.BoolVar(&perform, "f", false, "Whether to rewrite the statuses (if true) or show a dry-run diff (if false).")
+	var inputRepos string
+	flag.StringVar(&inputRepos, "repos", "", "Specify a list of comma-separated repo name/owner pairs, e.g. 'jekyll/jekyll-import'. Defaults to all repos configured for lgtm.")
+	flag.Parse()
+
+	log.SetPrefix("reconcile-lgtm-statuses: ")
+
+	context := ctx.NewDefaultContext()
+	handler := jekyll.LgtmHandler()
+
+	sentryClient, err := sentry.NewClient(map[string]string{
+		"app":     "reconcile-lgtm-statuses",
+		"perform": fmt.Sprintf("%t", perform),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sentryClient.Recover(func() error {
+		repos := []string{}
+		for _, repo := range handler.Repos() {
+			repos = append(repos, repo.Owner+"/"+repo.Name)
+		}
+		if inputRepos != "" {
+			repos = strings.Split(inputRepos, ",")
+		}
+
+		changed, failed := 0, 0
+		for _, repo := range repos {
+			pieces := strings.SplitN(strings.TrimSpace(repo), "/", 2)
+			if len(pieces) != 2 {
+				return fmt.Errorf("invalid repo %q, must be owner/name", repo)
+			}
+
+			reconciliations, err := handler.ReconcileRepo(context, pieces[0], pieces[1], perform)
+			if err != nil {
+				context.Log("%s: failed!", repo)
+				return err
+			}
+
+			for _, reconciliation := range reconciliations {
+				if reconciliation.Err != nil {
+					failed++
+					log.Printf("couldn't reconcile status:\n%s", reconciliation.Diff())
+					continue
+				}
+				if !reconciliation.Changed() {
+					continue
+				}
+				changed++
+				if perform {
+					log.Printf("rewrote status:\n%s", reconciliation.Diff())
+				} else {
+					log.Printf("would rewrite status:\n%s", reconciliation.Diff())
+				}
+			}
+		}
+
+		log.Printf("%d statuses out of date", changed)
+		if failed > 0 {
+			return fmt.Errorf("%d statuses couldn't be reconciled", failed)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,52 @@
+// release-notes is a CLI which prints release notes for the PRs merged between two refs of a repo.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/parkr/auto-reply/chlog"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/parkr/auto-reply/jekyll"
+	"github.com/parkr/auto-reply/sentry"
+)
+
+func main() {
+	var repo string
+	flag.StringVar(&repo, "repo", "", "The repo to generate release notes for, e.g. 'jekyll/jekyll'.")
+	var base string
+	flag.StringVar(&base, "base", "", "The ref of the previous release, e.g. 'v3.8.0'.")
+	var head string
+	flag.StringVar(&head, "head", "master", "The ref of the new release.")
+	flag.Parse()
+
+	log.SetPrefix("release-notes: ")
+
+	pieces := strings.SplitN(repo, "/", 2)
+	if len(pieces) != 2 || base == "" {
+		flag.Usage()
+		log.Fatalln("-repo must be owner/name and -base is required")
+	}
+
+	context := ctx.NewDefaultContext()
+	jekyll.ConfigureChlog()
+
+	sentryClient, err := sentry.NewClient(map[string]string{
+		"app":  "release-notes",
+		"repo": repo,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sentryClient.Recover(func() error {
+		notes, err := chlog.GenerateReleaseNotes(context, pieces[0], pieces[1], base, head)
+		if err != nil {
+			return err
+		}
+		fmt.Print(notes)
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+// commands runs chat-ops commands of the form "@jekyllbot: <verb> [args]"
+// left in issue and pull request comments.
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/auth"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// commandRegexp matches "@<bot>: <verb> [args]" at the start of a line, up to
+// the end of the line. Quoted lines, e.g. in replies, start with ">" so
+// they don't match.
+var commandRegexp = regexp.MustCompile(`(?m)^[ \t]*@([a-zA-Z0-9_-]+): ([^\s]+)([^\n]*)`)
+
+// Permission is the level of access required to run a command.
+type Permission int
+
+const (
+	// Anyone can run the command.
+	Anyone Permission = iota
+	// Triage requires membership of a team with triage or higher access to
+	// the repo.
+	Triage
+	// Push requires membership of a team with push access to the repo.
+	Push
+	// OrgOwner requires being an owner of the repo's org.
+	OrgOwner
+)
+
+func (p Permission) String() string {
+	switch p {
+	case Triage:
+		return "triage"
+	case Push:
+		return "push"
+	case OrgOwner:
+		return "org owner"
+	default:
+		return "anyone"
+	}
+}
+
+// allows returns true if the user has this permission on the repo.
+func (p Permission) allows(context *ctx.Context, owner, repo, login string) bool {
+	switch p {
+	case Anyone:
+		return true
+	case Triage:
+		return auth.UserHasTriageAccess(context, owner, repo, login)
+	case Push:
+		return auth.UserHasPushAccess(context, owner, repo, login)
+	case OrgOwner:
+		return auth.UserIsOrgOwner(context, owner, login)
+	default:
+		return false
+	}
+}
+
+// Command is something which can be run from a comment.
+type Command struct {
+	// Name is the verb which runs the command, e.g. "merge".
+	Name string
+	// Aliases are other verbs which run the command, e.g. ":shipit:".
+	Aliases []string
+	// Usage shows the arguments, e.g. "merge [+category]".
+	Usage string
+	// Description is shown in the help output.
+	Description string
+	// Permission is the access the commenter needs to run the command.
+	Permission Permission
+	// PullRequestOnly rejects the command when used on an issue.
+	PullRequestOnly bool
+
+	// Run performs the command. A returned error is reported back to the
+	// commenter.
+	Run func(context *ctx.Context, invocation *Invocation) error
+}
+
+func (c *Command) matches(verb string) bool {
+	if strings.EqualFold(c.Name, verb) {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if strings.EqualFold(alias, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// Invocation is a single use of a command in a comment.
+type Invocation struct {
+	Event *github.IssueCommentEvent
+
+	Owner, Repo string
+	Number      int
+	// Author is the login of the commenter.
+	Author string
+
+	// Bot is the login the command was addressed to, e.g. "jekyllbot".
+	Bot string
+	// Verb is the name or alias used to run the command.
+	Verb string
+	// Args is everything after the verb on the same line, trimmed.
+	Args string
+}
+
+func (i *Invocation) String() string {
+	return fmt.Sprintf("%s/%s#%d: @%s: %s %s", i.Owner, i.Repo, i.Number, i.Bot, i.Verb, i.Args)
+}
+
+// IsPullRequest returns true if the comment was left on a pull request.
+func (i *Invocation) IsPullRequest() bool {
+	return i.Event.Issue.PullRequestLinks != nil
+}
+
+// Reply leaves a comment on the issue or pull request.
+func (i *Invocation) Reply(context *ctx.Context, body string) error {
+	_, _, err := context.GitHub.Issues.CreateComment(
+		context.Context(), i.Owner, i.Repo, i.Number, &github.IssueComment{Body: github.String(body)})
+	return err
+}
+
+// React adds a reaction, e.g. "+1", to the comment.
+func (i *Invocation) React(context *ctx.Context, reaction string) error {
+	_, _, err := context.GitHub.Reactions.CreateIssueCommentReaction(
+		context.Context(), i.Owner, i.Repo, i.Event.Comment.GetID(), reaction)
+	return err
+}
+
+// parseCommand finds the first command in the comment body.
+func parseCommand(body string) (bot, verb, args string, ok bool) {
+	matches := commandRegexp.FindStringSubmatch(body)
+	if matches == nil {
+		return "", "", "", false
+	}
+	return matches[1], matches[2], strings.TrimSpace(matches[3]), true
+}
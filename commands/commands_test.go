@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	comments := []struct {
+		comment         string
+		ok              bool
+		bot, verb, args string
+	}{
+		{"it looked like you could merge it", false, "", "", ""},
+		{"@jekyllbot: merge", true, "jekyllbot", "merge", ""},
+		{"@jekyllbot: :shipit:", true, "jekyllbot", ":shipit:", ""},
+		{"@jekyllbot: merge +Bug Fix\nThanks!", true, "jekyllbot", "merge", "+Bug Fix"},
+		{"Great work!\n\n@jekyllbot: merge when ready +site  ", true, "jekyllbot", "merge", "when ready +site"},
+		{"@parkr: what do you think?", true, "parkr", "what", "do you think?"},
+		{"> @jekyllbot: merge\n\nSorry, it isn't ready yet.", false, "", "", ""},
+		{"Let's ask @jekyllbot: merge", false, "", "", ""},
+	}
+	for _, c := range comments {
+		bot, verb, args, ok := parseCommand(c.comment)
+		assert.Equal(t, c.ok, ok, "'%s' should have ok=%v", c.comment, c.ok)
+		assert.Equal(t, c.bot, bot, "'%s' should have bot=%v", c.comment, c.bot)
+		assert.Equal(t, c.verb, verb, "'%s' should have verb=%v", c.comment, c.verb)
+		assert.Equal(t, c.args, args, "'%s' should have args=%v", c.comment, c.args)
+	}
+}
+
+func TestPermissionString(t *testing.T) {
+	assert.Equal(t, "anyone", Anyone.String())
+	assert.Equal(t, "triage", Triage.String())
+	assert.Equal(t, "push", Push.String())
+	assert.Equal(t, "org owner", OrgOwner.String())
+}
+
+func TestTriagePermissionAllows(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/triagers/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 11}, {"id": 12}]`)
+	})
+	// Team 11 can only read the repo, and team 12 can triage it.
+	mux.HandleFunc("/teams/11/members/reader", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/teams/12/members/triager", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/teams/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/teams/11/repos/triagers/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permissions": {"pull": true}}`)
+	})
+	mux.HandleFunc("/teams/12/repos/triagers/r", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permissions": {"pull": true, "triage": true}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	context := &ctx.Context{GitHub: client}
+
+	assert.False(t, Triage.allows(context, "triagers", "r", "reader"))
+	assert.True(t, Triage.allows(context, "triagers", "r", "triager"))
+	assert.False(t, Push.allows(context, "triagers", "r", "triager"))
+}
+
+func TestCommandMatches(t *testing.T) {
+	command := &Command{Name: "merge", Aliases: []string{":shipit:"}}
+	assert.True(t, command.matches("merge"))
+	assert.True(t, command.matches("Merge"))
+	assert.True(t, command.matches(":shipit:"))
+	assert.False(t, command.matches("close"))
+}
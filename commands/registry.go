@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// Registry holds the commands a bot responds to.
+type Registry struct {
+	// bot is the login commands must be addressed to. If empty, commands
+	// addressed to anyone are run.
+	bot      string
+	commands []*Command
+}
+
+// NewRegistry returns a registry of commands addressed to the bot, which
+// already includes the help command.
+func NewRegistry(bot string) *Registry {
+	registry := &Registry{bot: bot}
+	registry.commands = append(registry.commands, &Command{
+		Name:        "help",
+		Usage:       "help",
+		Description: "Lists the commands I understand.",
+		Permission:  Anyone,
+		Run:         registry.runHelp,
+	})
+	return registry
+}
+
+// Register adds the command. Its name and aliases must not already be taken.
+func (r *Registry) Register(command *Command) error {
+	if command.Name == "" || command.Run == nil {
+		return fmt.Errorf("commands.Register: command must have a Name and Run")
+	}
+	for _, verb := range append([]string{command.Name}, command.Aliases...) {
+		if existing := r.Lookup(verb); existing != nil {
+			return fmt.Errorf("commands.Register: %q is already taken by %q", verb, existing.Name)
+		}
+	}
+	r.commands = append(r.commands, command)
+	return nil
+}
+
+// Lookup returns the command with the given name or alias, or nil.
+func (r *Registry) Lookup(verb string) *Command {
+	for _, command := range r.commands {
+		if command.matches(verb) {
+			return command
+		}
+	}
+	return nil
+}
+
+// Parse returns the registered command in the comment body and its
+// arguments, or nil if there's no command addressed to the bot.
+func (r *Registry) Parse(body string) (*Command, string) {
+	bot, verb, args, ok := parseCommand(body)
+	if !ok || !r.isAddressedToBot(bot) {
+		return nil, ""
+	}
+	return r.Lookup(verb), args
+}
+
+func (r *Registry) isAddressedToBot(bot string) bool {
+	return r.bot == "" || strings.EqualFold(r.bot, bot)
+}
+
+// IssueCommentHandler runs the command in a new issue or pull request
+// comment. The comment is reacted to with "+1" when the command succeeds and
+// "-1" when the commenter isn't allowed to run it. Errors are reported back
+// in a comment.
+func (r *Registry) IssueCommentHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.IssueCommentEvent)
+	if !ok {
+		return context.NewError("commands.IssueCommentHandler: not an issue comment event")
+	}
+
+	if event.GetAction() != "created" {
+		return context.NewError("commands.IssueCommentHandler: not a new comment")
+	}
+
+	bot, verb, args, ok := parseCommand(event.GetComment().GetBody())
+	if !ok || !r.isAddressedToBot(bot) {
+		return context.NewError("commands.IssueCommentHandler: not a command")
+	}
+
+	invocation := &Invocation{
+		Event:  event,
+		Owner:  event.GetRepo().GetOwner().GetLogin(),
+		Repo:   event.GetRepo().GetName(),
+		Number: event.GetIssue().GetNumber(),
+		Author: event.GetComment().GetUser().GetLogin(),
+		Bot:    bot,
+		Verb:   verb,
+		Args:   args,
+	}
+
+	command := r.Lookup(verb)
+	if command == nil {
+		if r.bot == "" {
+			// The comment may well be addressed to a human.
+			return context.NewError("commands.IssueCommentHandler: unknown command in %s", invocation)
+		}
+		return r.reject(context, invocation, "confused",
+			fmt.Sprintf("I don't know how to `%s`. Comment `@%s: help` to see what I can do.", verb, bot))
+	}
+
+	if command.PullRequestOnly && !invocation.IsPullRequest() {
+		return r.reject(context, invocation, "-1",
+			fmt.Sprintf("`%s` only works on pull requests.", command.Name))
+	}
+
+	if !command.Permission.allows(context, invocation.Owner, invocation.Repo, invocation.Author) {
+		if err := invocation.React(context, "-1"); err != nil {
+			context.Log("commands.IssueCommentHandler: couldn't react to %s: %v", invocation, err)
+		}
+		return context.NewError("commands.IssueCommentHandler: @%s needs %s access to run %s",
+			invocation.Author, command.Permission, invocation)
+	}
+
+	if err := command.Run(context, invocation); err != nil {
+		return r.reject(context, invocation, "confused",
+			fmt.Sprintf("@%s: I couldn't `%s`: %v", invocation.Author, command.Name, err))
+	}
+
+	if err := invocation.React(context, "+1"); err != nil {
+		context.Log("commands.IssueCommentHandler: couldn't react to %s: %v", invocation, err)
+	}
+	return nil
+}
+
+// reject reacts to the comment and explains why the command wasn't run.
+func (r *Registry) reject(context *ctx.Context, invocation *Invocation, reaction, message string) error {
+	if err := invocation.React(context, reaction); err != nil {
+		context.Log("commands.IssueCommentHandler: couldn't react to %s: %v", invocation, err)
+	}
+	if err := invocation.Reply(context, message); err != nil {
+		context.Log("commands.IssueCommentHandler: couldn't reply to %s: %v", invocation, err)
+	}
+	return context.NewError("commands.IssueCommentHandler: %s: %s", invocation, message)
+}
+
+// helpText lists each command with its usage, aliases and required access.
+func (r *Registry) helpText(bot string) string {
+	var help bytes.Buffer
+	help.WriteString("Here's what I can do:\n\n")
+	help.WriteString("| Command | Description | Who can run it |\n")
+	help.WriteString("| --- | --- | --- |\n")
+	for _, command := range r.commands {
+		usage := command.Usage
+		if usage == "" {
+			usage = command.Name
+		}
+		description := command.Description
+		if len(command.Aliases) > 0 {
+			description += fmt.Sprintf(" Also `%s`.", strings.Join(command.Aliases, "`, `"))
+		}
+		if command.PullRequestOnly {
+			description += " Pull requests only."
+		}
+		fmt.Fprintf(&help, "| `@%s: %s` | %s | %s |\n", bot, usage, strings.TrimSpace(description), command.Permission)
+	}
+	return help.String()
+}
+
+func (r *Registry) runHelp(context *ctx.Context, invocation *Invocation) error {
+	return invocation.Reply(context, r.helpText(invocation.Bot))
+}
@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestContext returns a context whose GitHub client talks to a test
+// server which records the reactions and comments it receives.
+func newTestContext() (*ctx.Context, *[]string, *[]string, func()) {
+	reactions, comments := []string{}, []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/issues/comments/1/reactions", func(w http.ResponseWriter, r *http.Request) {
+		v := new(github.Reaction)
+		json.NewDecoder(r.Body).Decode(v)
+		reactions = append(reactions, v.GetContent())
+		json.NewEncoder(w).Encode(v)
+	})
+	mux.HandleFunc("/repos/o/r/issues/2/comments", func(w http.ResponseWriter, r *http.Request) {
+		v := new(github.IssueComment)
+		json.NewDecoder(r.Body).Decode(v)
+		comments = append(comments, v.GetBody())
+		json.NewEncoder(w).Encode(v)
+	})
+	server := httptest.NewServer(mux)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return &ctx.Context{GitHub: client}, &reactions, &comments, server.Close
+}
+
+func newTestEvent(body string, pullRequest bool) *github.IssueCommentEvent {
+	event := &github.IssueCommentEvent{
+		Action: github.String("created"),
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("o")},
+			Name:  github.String("r"),
+		},
+		Issue: &github.Issue{Number: github.Int(2)},
+		Comment: &github.IssueComment{
+			ID:   github.Int64(1),
+			Body: github.String(body),
+			User: &github.User{Login: github.String("parkr")},
+		},
+	}
+	if pullRequest {
+		event.Issue.PullRequestLinks = &github.PullRequestLinks{}
+	}
+	return event
+}
+
+func TestRegister(t *testing.T) {
+	registry := NewRegistry("jekyllbot")
+	run := func(context *ctx.Context, invocation *Invocation) error { return nil }
+
+	assert.Error(t, registry.Register(&Command{Name: "nothing"}))
+	assert.NoError(t, registry.Register(&Command{Name: "merge", Aliases: []string{":shipit:"}, Run: run}))
+	assert.Error(t, registry.Register(&Command{Name: "ship", Aliases: []string{":ShipIt:"}, Run: run}))
+	assert.Error(t, registry.Register(&Command{Name: "help", Run: run}))
+	assert.Equal(t, "merge", registry.Lookup(":shipit:").Name)
+	assert.Nil(t, registry.Lookup("ship"))
+}
+
+func TestParse(t *testing.T) {
+	registry := NewRegistry("jekyllbot")
+	run := func(context *ctx.Context, invocation *Invocation) error { return nil }
+	assert.NoError(t, registry.Register(&Command{Name: "merge", Aliases: []string{":shipit:"}, Run: run}))
+
+	command, args := registry.Parse("Thanks!\n@jekyllbot: :shipit: when ready +bug\nCheers")
+	if assert.NotNil(t, command) {
+		assert.Equal(t, "merge", command.Name)
+	}
+	assert.Equal(t, "when ready +bug", args)
+
+	command, _ = registry.Parse("@someone-else: merge")
+	assert.Nil(t, command)
+	command, _ = registry.Parse("@jekyllbot: frobnicate")
+	assert.Nil(t, command)
+	command, _ = registry.Parse("no command here")
+	assert.Nil(t, command)
+}
+
+func TestHelpText(t *testing.T) {
+	registry := NewRegistry("jekyllbot")
+	registry.Register(&Command{
+		Name:            "merge",
+		Aliases:         []string{":shipit:"},
+		Usage:           "merge [+category]",
+		Description:     "Merges the pull request.",
+		Permission:      Push,
+		PullRequestOnly: true,
+		Run:             func(context *ctx.Context, invocation *Invocation) error { return nil },
+	})
+	assert.Equal(t, "Here's what I can do:\n\n"+
+		"| Command | Description | Who can run it |\n"+
+		"| --- | --- | --- |\n"+
+		"| `@jekyllbot: help` | Lists the commands I understand. | anyone |\n"+
+		"| `@jekyllbot: merge [+category]` | Merges the pull request. Also `:shipit:`. Pull requests only. | push |\n",
+		registry.helpText("jekyllbot"))
+}
+
+func TestIssueCommentHandler(t *testing.T) {
+	context, reactions, comments, teardown := newTestContext()
+	defer teardown()
+
+	var ran *Invocation
+	registry := NewRegistry("jekyllbot")
+	registry.Register(&Command{
+		Name:            "ping",
+		Permission:      Anyone,
+		PullRequestOnly: true,
+		Run: func(context *ctx.Context, invocation *Invocation) error {
+			ran = invocation
+			return nil
+		},
+	})
+	registry.Register(&Command{
+		Name:       "fail",
+		Permission: Anyone,
+		Run: func(context *ctx.Context, invocation *Invocation) error {
+			return errors.New("it broke")
+		},
+	})
+
+	assert.NoError(t, registry.IssueCommentHandler(context, newTestEvent("@jekyllbot: ping all the things", true)))
+	assert.Equal(t, "all the things", ran.Args)
+	assert.Equal(t, "parkr", ran.Author)
+	assert.Equal(t, []string{"+1"}, *reactions)
+
+	// Commands addressed to someone else are ignored.
+	assert.Error(t, registry.IssueCommentHandler(context, newTestEvent("@parkr: ping", true)))
+	assert.Equal(t, []string{"+1"}, *reactions)
+
+	assert.Error(t, registry.IssueCommentHandler(context, newTestEvent("@jekyllbot: ping", false)))
+	assert.Error(t, registry.IssueCommentHandler(context, newTestEvent("@jekyllbot: dance", true)))
+	assert.Error(t, registry.IssueCommentHandler(context, newTestEvent("@jekyllbot: fail", false)))
+	assert.Equal(t, []string{"+1", "-1", "confused", "confused"}, *reactions)
+	assert.Equal(t, []string{
+		"`ping` only works on pull requests.",
+		"I don't know how to `dance`. Comment `@jekyllbot: help` to see what I can do.",
+		"@parkr: I couldn't `fail`: it broke",
+	}, *comments)
+}
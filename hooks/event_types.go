@@ -3,6 +3,8 @@ package hooks
 type EventType string
 
 var (
+	CheckRunEvent                 EventType = "check_run"
+	CheckSuiteEvent               EventType = "check_suite"
 	CommitCommentEvent            EventType = "commit_comment"
 	CreateEvent                   EventType = "create"
 	DeleteEvent                   EventType = "delete"
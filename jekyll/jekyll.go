@@ -3,10 +3,16 @@ package jekyll
 
 import (
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
 
 	"github.com/parkr/auto-reply/affinity"
 	"github.com/parkr/auto-reply/autopull"
+	"github.com/parkr/auto-reply/backport"
 	"github.com/parkr/auto-reply/chlog"
+	"github.com/parkr/auto-reply/commands"
 	"github.com/parkr/auto-reply/ctx"
 	"github.com/parkr/auto-reply/hooks"
 	"github.com/parkr/auto-reply/labeler"
@@ -18,20 +24,33 @@ import (
 	"github.com/parkr/auto-reply/jekyll/issuecomment"
 )
 
+var (
+	lgtmHandler     *lgtm.Handler
+	lgtmHandlerOnce sync.Once
+)
+
 var jekyllOrgEventHandlers = hooks.EventHandlerMap{
-	hooks.CreateEvent: {chlog.CreateReleaseOnTagHandler},
-	hooks.IssuesEvent: {deprecate.DeprecateOldRepos},
+	hooks.CheckSuiteEvent: {chlog.AutoMergeOnCheckSuite},
+	hooks.CreateEvent:     {chlog.CreateReleaseOnTagHandler},
+	hooks.IssuesEvent:     {deprecate.DeprecateOldRepos},
 	hooks.IssueCommentEvent: {
 		issuecomment.PendingFeedbackUnlabeler,
 		issuecomment.StaleUnlabeler,
-		chlog.MergeAndLabel,
 	},
 	hooks.PullRequestEvent: {
 		labeler.IssueHasPullRequestLabeler,
 		labeler.PendingRebaseNeedsWorkPRUnlabeler,
+		chlog.AutoMergeOnPullRequest,
+		backport.ForwardPortOnMerge,
+		chlog.ReleaseOnMerge,
+	},
+	hooks.PullRequestReviewEvent: {chlog.CancelAutoMergeOnReview},
+	hooks.ReleaseEvent: {
+		chlog.CloseMilestoneOnRelease,
+		chlog.CommentOnReleasedIssues,
+		chlog.LinkPrereleasesOnRelease,
 	},
-	hooks.ReleaseEvent: {chlog.CloseMilestoneOnRelease},
-	hooks.StatusEvent:  {statStatus, travis.FailingFmtBuildHandler},
+	hooks.StatusEvent: {statStatus, travis.FailingFmtBuildHandler, chlog.AutoMergeOnStatus},
 }
 
 func statStatus(context *ctx.Context, payload interface{}) error {
@@ -57,6 +76,22 @@ func statStatus(context *ctx.Context, payload interface{}) error {
 	return nil
 }
 
+// jekyllCommands returns the commands which can be run by commenting
+// "@jekyllbot: <command>".
+func jekyllCommands() *commands.Registry {
+	registry := commands.NewRegistry("jekyllbot")
+	if err := registry.Register(chlog.MergeCommand); err != nil {
+		log.Fatalf("couldn't register merge command: %v", err)
+	}
+	if err := registry.Register(backport.Command); err != nil {
+		log.Fatalf("couldn't register backport command: %v", err)
+	}
+	if err := registry.Register(chlog.ReleaseCommand); err != nil {
+		log.Fatalf("couldn't register release command: %v", err)
+	}
+	return registry
+}
+
 func jekyllAffinityHandler(context *ctx.Context) *affinity.Handler {
 	handler := &affinity.Handler{}
 
@@ -76,6 +111,27 @@ func jekyllAffinityHandler(context *ctx.Context) *affinity.Handler {
 	return handler
 }
 
+// jekyllLgtmHandler returns the lgtm handler shared by the webhook handler
+// and the status pages.
+func jekyllLgtmHandler() *lgtm.Handler {
+	lgtmHandlerOnce.Do(func() {
+		lgtmHandler = newLgtmHandler()
+	})
+	return lgtmHandler
+}
+
+// LgtmHandler returns the lgtm handler configured for the Jekyll org, e.g.
+// for reconciling statuses outside of the webhook handler.
+func LgtmHandler() *lgtm.Handler {
+	return jekyllLgtmHandler()
+}
+
+// NewLgtmStatusPageHandler serves the approval breakdown which each lgtm
+// status links to. Mount it at LGTM_STATUS_PAGE_URL.
+func NewLgtmStatusPageHandler(context *ctx.Context) http.Handler {
+	return jekyllLgtmHandler().StatusPageHandler(context)
+}
+
 func newLgtmHandler() *lgtm.Handler {
 	handler := &lgtm.Handler{}
 
@@ -102,9 +158,43 @@ func newLgtmHandler() *lgtm.Handler {
 	handler.AddRepo("jekyll", "minima", 1)
 	handler.AddRepo("jekyll", "directory", 1)
 
+	if err := handler.SetCarryOverPolicy("jekyll", "jekyll", lgtm.CarryOverPolicy{
+		KeepOnRebase: true,
+		AllowedPaths: []string{"docs/"},
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if err := handler.SetRequireCodeOwners("jekyll", "jekyll", true); err != nil {
+		log.Fatal(err)
+	}
+
+	if url := os.Getenv("LGTM_STATUS_PAGE_URL"); url != "" {
+		handler.SetStatusPageURL(url)
+	}
+
+	if os.Getenv("LGTM_CHECK_RUNS") == "true" {
+		handler.SetCheckRuns(true)
+	}
+
+	if path := os.Getenv("LGTM_STORE_PATH"); path != "" {
+		store, err := lgtm.NewFileStore(path)
+		if err != nil {
+			log.Printf("couldn't open lgtm store at %s: %v", path, err)
+		} else {
+			handler.SetStore(store)
+		}
+	}
+
 	return handler
 }
 
+// lgtmStatusesEnabled returns true if LGTM_STATUSES=true, which sets the lgtm
+// status on the PRs of every repo in newLgtmHandler as they're opened, pushed
+// to and approved.
+func lgtmStatusesEnabled() bool {
+	return os.Getenv("LGTM_STATUSES") == "true"
+}
+
 func NewJekyllOrgHandler(context *ctx.Context) *hooks.GlobalHandler {
 	affinityHandler := jekyllAffinityHandler(context)
 	jekyllOrgEventHandlers.AddHandler(hooks.IssuesEvent, affinityHandler.AssignIssueToAffinityTeamCaptain)
@@ -112,15 +202,59 @@ func NewJekyllOrgHandler(context *ctx.Context) *hooks.GlobalHandler {
 	jekyllOrgEventHandlers.AddHandler(hooks.PullRequestEvent, affinityHandler.AssignPRToAffinityTeamCaptain)
 	jekyllOrgEventHandlers.AddHandler(hooks.PullRequestEvent, affinityHandler.RequestReviewFromAffinityTeamCaptains)
 
-	lgtmHandler := newLgtmHandler()
-	jekyllOrgEventHandlers.AddHandler(hooks.PullRequestReviewEvent, lgtmHandler.PullRequestReviewHandler)
+	if lgtmStatusesEnabled() {
+		jekyllOrgEventHandlers.AddHandler(hooks.IssueCommentEvent, jekyllLgtmHandler().IssueCommentHandler)
+		jekyllOrgEventHandlers.AddHandler(hooks.PullRequestEvent, jekyllLgtmHandler().PullRequestHandler)
+	}
+	jekyllOrgEventHandlers.AddHandler(hooks.PullRequestReviewEvent, jekyllLgtmHandler().PullRequestReviewHandler)
+
+	ConfigureChlog()
+	jekyllOrgEventHandlers.AddHandler(hooks.IssueCommentEvent, jekyllCommands().IssueCommentHandler)
 
 	autopullHandler := autopull.Handler{}
 	autopullHandler.AcceptAllRepos(true)
 	jekyllOrgEventHandlers.AddHandler(hooks.PushEvent, autopullHandler.CreatePullRequestFromPush)
+	jekyllOrgEventHandlers.AddHandler(hooks.PushEvent, chlog.SyncReleaseBodiesOnPush)
 
 	return &hooks.GlobalHandler{
 		Context:       context,
 		EventHandlers: jekyllOrgEventHandlers,
 	}
 }
+
+// ConfigureChlog sets up the org's per-repo changelog and merge settings. It
+// must be called before chlog is used.
+func ConfigureChlog() {
+	// Other repos are merged without any checks. jekyll's merges also need
+	// the lgtm status, which is set by the lgtm handlers registered in
+	// NewJekyllOrgHandler when LGTM_STATUSES=true.
+	chlog.SetPreflightConfig("jekyll", "jekyll", chlog.PreflightConfig{
+		RequireGreenStatuses: true,
+		RequireLGTM:          lgtmStatusesEnabled(),
+		RequireMergeable:     true,
+		BlockingLabels:       []string{"needs-work", "pending-rebase"},
+	})
+	if err := chlog.SetCategories("jekyll", "minima", minimaCategories()); err != nil {
+		log.Fatal(err)
+	}
+	// minima's version is in its gemspec, which is bumped by hand.
+	chlog.SetVersionFile("jekyll", "minima", "")
+	chlog.SetVersionFile("jekyll", "github-metadata", "lib/jekyll-github-metadata/version.rb")
+}
+
+// minimaCategories are the default changelog categories, with theme
+// enhancements in place of site enhancements.
+func minimaCategories() []chlog.ChangelogCategory {
+	categories := []chlog.ChangelogCategory{}
+	for _, category := range chlog.DefaultCategories() {
+		if category.Prefix != "site" {
+			categories = append(categories, category)
+		}
+	}
+	return append(categories, chlog.ChangelogCategory{
+		Prefix:  "theme",
+		Slug:    "theme-enhancements",
+		Section: "Theme Enhancements",
+		Labels:  []string{"enhancement"},
+	})
+}
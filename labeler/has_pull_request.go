@@ -22,7 +22,7 @@ func IssueHasPullRequestLabeler(context *ctx.Context, payload interface{}) error
 
 	owner, repo, description := *event.Repo.Owner.Login, *event.Repo.Name, *event.PullRequest.Body
 
-	issueNums := linkedIssues(description)
+	issueNums := LinkedIssues(description)
 	if issueNums == nil {
 		return nil
 	}
@@ -38,7 +38,9 @@ func IssueHasPullRequestLabeler(context *ctx.Context, payload interface{}) error
 	return err
 }
 
-func linkedIssues(description string) []int {
+// LinkedIssues returns the issues which the description closes with a
+// keyword, e.g. "Fixes #123".
+func LinkedIssues(description string) []int {
 	issueSubmatches := fixesIssueMatcher.FindAllStringSubmatch(description, -1)
 	if len(issueSubmatches) == 0 || len(issueSubmatches[0]) < 2 {
 		return nil
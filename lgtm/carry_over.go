@@ -0,0 +1,178 @@
+package lgtm
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// hunkHeaderRegexp matches the line numbers in a unified diff hunk header,
+// which shift whenever the base branch changes.
+var hunkHeaderRegexp = regexp.MustCompile(`(?m)^@@ -\d+(,\d+)? \+\d+(,\d+)? @@`)
+
+// compareFilesLimit is the most files the compare API lists. Comparisons
+// with that many may be missing some.
+const compareFilesLimit = 300
+
+// CarryOverPolicy decides whether approvals survive new commits being pushed
+// to a PR. The zero value resets approvals on every push.
+type CarryOverPolicy struct {
+	// KeepOnRebase keeps approvals when the PR's changes are identical to
+	// those which were approved, i.e. only the base changed.
+	KeepOnRebase bool
+
+	// AllowedPaths keeps approvals when the new commits only touch matching
+	// paths. A pattern ending in "/" matches everything in that directory;
+	// anything else is matched with path.Match against the full path, or
+	// against the file name if the pattern contains no "/".
+	AllowedPaths []string
+}
+
+func (p CarryOverPolicy) isResetAlways() bool {
+	return !p.KeepOnRebase && len(p.AllowedPaths) == 0
+}
+
+func (p CarryOverPolicy) isAllowedPath(filename string) bool {
+	for _, pattern := range p.AllowedPaths {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(filename, pattern) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, filename); matched {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := path.Match(pattern, path.Base(filename)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// carryOver decides which of the previous LGTMers still apply to the PR's
+// new head, returning them along with a note for the status description.
+// Approvals are always kept when the bot merged the base branch in, e.g. to
+// bring the PR up to date in the merge queue.
+func carryOver(context *ctx.Context, ref prRef, pr *github.PullRequest, previous *statusInfo) ([]string, string) {
+	policy := ref.Repo.CarryOver
+	if len(previous.lgtmers) == 0 {
+		return []string{}, ""
+	}
+	if previous.sha == "" {
+		return []string{}, "Reset by new commits."
+	}
+
+	lgtmers := make([]string, len(previous.lgtmers))
+	copy(lgtmers, previous.lgtmers)
+
+	if isBotBaseMerge(context, ref, pr, previous.sha) {
+		return lgtmers, "Kept after merging in the base branch."
+	}
+
+	if policy.isResetAlways() {
+		return []string{}, "Reset by new commits."
+	}
+
+	if policy.KeepOnRebase && isRebaseOnly(context, ref, pr, previous.sha) {
+		return lgtmers, "Kept after rebase."
+	}
+
+	if len(policy.AllowedPaths) > 0 && touchesOnlyAllowedPaths(context, ref, policy, previous.sha, pr.GetHead().GetSHA()) {
+		return lgtmers, "Kept: only allow-listed paths changed."
+	}
+
+	return []string{}, "Reset by new commits."
+}
+
+// isBotBaseMerge returns true if the PR's new head is a merge commit made by
+// the bot on top of the previous head. The bot only merges the base branch
+// in, and only when it merges cleanly, so the PR's changes are the same.
+func isBotBaseMerge(context *ctx.Context, ref prRef, pr *github.PullRequest, previousSHA string) bool {
+	commit, _, err := context.GitHub.Repositories.GetCommit(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, pr.GetHead().GetSHA())
+	if err != nil {
+		context.Log("lgtm.isBotBaseMerge: couldn't get %s on %s: %v", pr.GetHead().GetSHA(), ref, err)
+		return false
+	}
+	if len(commit.Parents) != 2 || commit.Parents[0].GetSHA() != previousSHA {
+		return false
+	}
+	return commit.GetAuthor().GetLogin() != "" && context.GitHubAuthedAs(commit.GetAuthor().GetLogin())
+}
+
+// isRebaseOnly returns true if the PR's diff against its base is the same at
+// both the previous and the new head.
+func isRebaseOnly(context *ctx.Context, ref prRef, pr *github.PullRequest, previousSHA string) bool {
+	base := pr.GetBase().GetRef()
+	previousDiff, _, err := context.GitHub.Repositories.CompareCommits(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, base, previousSHA)
+	if err != nil {
+		context.Log("lgtm.isRebaseOnly: couldn't compare %s...%s on %s: %v", base, previousSHA, ref, err)
+		return false
+	}
+	newDiff, _, err := context.GitHub.Repositories.CompareCommits(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, base, pr.GetHead().GetSHA())
+	if err != nil {
+		context.Log("lgtm.isRebaseOnly: couldn't compare %s...%s on %s: %v", base, pr.GetHead().GetSHA(), ref, err)
+		return false
+	}
+	return sameChanges(previousDiff.Files, newDiff.Files)
+}
+
+// sameChanges compares two sets of file changes, ignoring where in each file
+// the hunks are located. Changes which can't be fully compared aren't the
+// same: GitHub leaves out the patches of binary and large files, and the
+// files after the first compareFilesLimit.
+func sameChanges(a, b []github.CommitFile) bool {
+	if len(a) != len(b) || len(a) >= compareFilesLimit {
+		return false
+	}
+	for _, file := range append(append([]github.CommitFile{}, a...), b...) {
+		if file.GetPatch() == "" {
+			return false
+		}
+	}
+	patches := map[string]string{}
+	for _, file := range a {
+		patches[file.GetFilename()] = file.GetStatus() + "\n" + hunkHeaderRegexp.ReplaceAllString(file.GetPatch(), "@@")
+	}
+	for _, file := range b {
+		patch, ok := patches[file.GetFilename()]
+		if !ok || patch != file.GetStatus()+"\n"+hunkHeaderRegexp.ReplaceAllString(file.GetPatch(), "@@") {
+			return false
+		}
+	}
+	return true
+}
+
+// touchesOnlyAllowedPaths returns true if every file changed between the two
+// SHAs is allowed by the policy.
+func touchesOnlyAllowedPaths(context *ctx.Context, ref prRef, policy CarryOverPolicy, previousSHA, newSHA string) bool {
+	comparison, _, err := context.GitHub.Repositories.CompareCommits(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, previousSHA, newSHA)
+	if err != nil {
+		context.Log("lgtm.touchesOnlyAllowedPaths: couldn't compare %s...%s on %s: %v", previousSHA, newSHA, ref, err)
+		return false
+	}
+	if comparison.GetStatus() != "ahead" {
+		// The history was rewritten, so the comparison includes changes
+		// which weren't part of the new commits.
+		return false
+	}
+	if len(comparison.Files) >= compareFilesLimit {
+		// Files which aren't allowed may have been left out.
+		return false
+	}
+	for _, file := range comparison.Files {
+		if !policy.isAllowedPath(file.GetFilename()) {
+			return false
+		}
+	}
+	return true
+}
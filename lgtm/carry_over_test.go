@@ -0,0 +1,157 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCarryOverPolicyIsAllowedPath(t *testing.T) {
+	policy := CarryOverPolicy{AllowedPaths: []string{"docs/", "*.md", "script/fmt"}}
+	cases := map[string]bool{
+		"docs/_docs/usage.md":   true,
+		"History.markdown":      false,
+		"README.md":             true,
+		"lib/jekyll/README.md":  true,
+		"script/fmt":            true,
+		"script/test":           false,
+		"lib/jekyll.rb":         false,
+		"documentation/foo.txt": false,
+	}
+	for filename, expected := range cases {
+		assert.Equal(t, expected, policy.isAllowedPath(filename), "filename: %s", filename)
+	}
+}
+
+func TestSameChanges(t *testing.T) {
+	file := func(name, patch string) github.CommitFile {
+		return github.CommitFile{Filename: github.String(name), Status: github.String("modified"), Patch: github.String(patch)}
+	}
+	approved := []github.CommitFile{file("lib/jekyll.rb", "@@ -10,6 +10,7 @@ module Jekyll\n+  require 'foo'")}
+
+	assert.True(t, sameChanges(approved, []github.CommitFile{
+		file("lib/jekyll.rb", "@@ -12,6 +12,7 @@ module Jekyll\n+  require 'foo'"),
+	}))
+	assert.False(t, sameChanges(approved, []github.CommitFile{
+		file("lib/jekyll.rb", "@@ -10,6 +10,7 @@ module Jekyll\n+  require 'bar'"),
+	}))
+	assert.False(t, sameChanges(approved, []github.CommitFile{
+		file("lib/jekyll.rb", "@@ -10,6 +10,7 @@ module Jekyll\n+  require 'foo'"),
+		file("README.md", "@@ -1 +1 @@\n+hi"),
+	}))
+
+	// Binary files have no patch, so they can't be compared.
+	binary := []github.CommitFile{file("logo.png", "")}
+	assert.False(t, sameChanges(binary, binary))
+
+	// Neither can truncated comparisons.
+	many := []github.CommitFile{}
+	for i := 0; i < compareFilesLimit; i++ {
+		many = append(many, file(fmt.Sprintf("%d.rb", i), "@@ -1 +1 @@\n+hi"))
+	}
+	assert.False(t, sameChanges(many, many))
+}
+
+func TestCarryOver(t *testing.T) {
+	previousSHA := "cafebabe"
+	pr := &github.PullRequest{
+		Base: &github.PullRequestBranch{Ref: github.String("master")},
+		Head: &github.PullRequestBranch{SHA: github.String(prSHA)},
+	}
+	previous := &statusInfo{lgtmers: []string{"@parkr"}, quorum: 1, sha: previousSHA}
+	patch := func(line string) string {
+		return fmt.Sprintf(`[{"filename":"lib/jekyll.rb","status":"modified","patch":"@@ -1 +1 @@\n%s"}]`, line)
+	}
+
+	cases := []struct {
+		policy          CarryOverPolicy
+		previous        *statusInfo
+		approvedPatch   string
+		newPatch        string
+		pushedFiles     string
+		pushStatus      string
+		expectedLgtmers []string
+		expectedNote    string
+	}{
+		{CarryOverPolicy{}, &statusInfo{lgtmers: []string{}}, "", "", "", "", []string{}, ""},
+		{CarryOverPolicy{}, previous, "", "", "", "", []string{}, "Reset by new commits."},
+		{CarryOverPolicy{KeepOnRebase: true}, previous, patch("+a"), patch("+a"), "", "", []string{"@parkr"}, "Kept after rebase."},
+		{CarryOverPolicy{KeepOnRebase: true}, previous, patch("+a"), patch("+b"), "", "", []string{}, "Reset by new commits."},
+		{CarryOverPolicy{AllowedPaths: []string{"docs/"}}, previous, "", "", `[{"filename":"docs/index.md"}]`, "ahead", []string{"@parkr"}, "Kept: only allow-listed paths changed."},
+		{CarryOverPolicy{AllowedPaths: []string{"docs/"}}, previous, "", "", `[{"filename":"docs/index.md"},{"filename":"lib/jekyll.rb"}]`, "ahead", []string{}, "Reset by new commits."},
+		{CarryOverPolicy{AllowedPaths: []string{"docs/"}}, previous, "", "", `[{"filename":"docs/index.md"}]`, "diverged", []string{}, "Reset by new commits."},
+	}
+	for i, test := range cases {
+		setup() // server & client!
+		context := &ctx.Context{GitHub: client}
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/compare/master...%s", previousSHA), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"files":%s}`, test.approvedPatch)
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/compare/master...%s", prSHA), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"files":%s}`, test.newPatch)
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/compare/%s...%s", previousSHA, prSHA), func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": test.pushStatus,
+				"files":  json.RawMessage(test.pushedFiles),
+			})
+		})
+
+		testRef := ref
+		testRef.Repo.CarryOver = test.policy
+		lgtmers, note := carryOver(context, testRef, pr, test.previous)
+		assert.Equal(t, test.expectedLgtmers, lgtmers, "case %d", i)
+		assert.Equal(t, test.expectedNote, note, "case %d", i)
+		teardown()
+	}
+}
+
+func TestCarryOverKeepsBotBaseMerges(t *testing.T) {
+	previous := &statusInfo{lgtmers: []string{"@parkr"}, quorum: 1, sha: "cafebabe"}
+	pr := &github.PullRequest{
+		Base: &github.PullRequestBranch{Ref: github.String("master")},
+		Head: &github.PullRequestBranch{SHA: github.String(prSHA)},
+	}
+	cases := []struct {
+		author, firstParent string
+		expectedLgtmers     []string
+		expectedNote        string
+	}{
+		{"jekyllbot", "cafebabe", []string{"@parkr"}, "Kept after merging in the base branch."},
+		{"parkr", "cafebabe", []string{}, "Reset by new commits."},
+		{"jekyllbot", "deadbeef", []string{}, "Reset by new commits."},
+	}
+	for i, test := range cases {
+		setup() // server & client!
+		context := &ctx.Context{GitHub: client}
+		mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"login": "jekyllbot"}`)
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/o/r/commits/%s", prSHA), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"author": {"login": %q}, "parents": [{"sha": %q}, {"sha": "base"}]}`, test.author, test.firstParent)
+		})
+
+		lgtmers, note := carryOver(context, ref, pr, previous)
+		assert.Equal(t, test.expectedLgtmers, lgtmers, "case %d", i)
+		assert.Equal(t, test.expectedNote, note, "case %d", i)
+		teardown()
+	}
+}
+
+func TestSetCarryOverPolicy(t *testing.T) {
+	handler := &Handler{}
+	handler.AddRepo("o", "r", 2)
+	policy := CarryOverPolicy{KeepOnRebase: true}
+
+	assert.Error(t, handler.SetCarryOverPolicy("o", "nope", policy))
+	assert.NoError(t, handler.SetCarryOverPolicy("o", "r", policy))
+	assert.Equal(t, policy, handler.newPRRef("o", "r", 1).Repo.CarryOver)
+
+	handler.AddRepo("o", "r", 3)
+	assert.Equal(t, 3, handler.newPRRef("o", "r", 1).Repo.Quorum)
+}
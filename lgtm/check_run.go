@@ -0,0 +1,162 @@
+package lgtm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// publishCheckRun creates or updates the LGTM check run for the SHA. The
+// check run has the same name as the status context. A completed check run
+// isn't moved back to in progress, e.g. when an approval is retracted; a new
+// one is created instead, which takes its place.
+func publishCheckRun(context *ctx.Context, ref prRef, sha string, status *statusInfo) error {
+	name := lgtmContext(ref.Repo.Owner)
+	output := status.newCheckRunOutput()
+
+	var checkStatus, conclusion *string
+	var completedAt *github.Timestamp
+	if status.newState() == "success" {
+		checkStatus = github.String("completed")
+		conclusion = github.String("success")
+		completedAt = &github.Timestamp{Time: time.Now()}
+	} else {
+		checkStatus = github.String("in_progress")
+	}
+
+	var detailsURL *string
+	if ref.targetURL != "" {
+		detailsURL = github.String(ref.targetURL)
+	}
+
+	existing, _, err := context.GitHub.Checks.ListCheckRunsForRef(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, sha,
+		&github.ListCheckRunsOptions{CheckName: github.String(name)})
+	if err != nil {
+		return err
+	}
+
+	var latest *github.CheckRun
+	if existing != nil && len(existing.CheckRuns) > 0 {
+		latest = existing.CheckRuns[0]
+	}
+	if latest != nil && (latest.GetStatus() != "completed" || conclusion != nil) {
+		_, _, err = context.GitHub.Checks.UpdateCheckRun(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, latest.GetID(),
+			github.UpdateCheckRunOptions{
+				Name:        name,
+				DetailsURL:  detailsURL,
+				Status:      checkStatus,
+				Conclusion:  conclusion,
+				CompletedAt: completedAt,
+				Output:      output,
+			})
+		return err
+	}
+
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number)
+	if err != nil {
+		return err
+	}
+	_, _, err = context.GitHub.Checks.CreateCheckRun(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name,
+		github.CreateCheckRunOptions{
+			Name:        name,
+			HeadBranch:  pr.GetHead().GetRef(),
+			HeadSHA:     sha,
+			DetailsURL:  detailsURL,
+			Status:      checkStatus,
+			Conclusion:  conclusion,
+			CompletedAt: completedAt,
+			Output:      output,
+		})
+	return err
+}
+
+func (s statusInfo) newCheckRunOutput() *github.CheckRunOutput {
+	return &github.CheckRunOutput{
+		Title:   github.String(s.newApprovalDescription()),
+		Summary: github.String(s.newCheckRunSummary()),
+	}
+}
+
+// newCheckRunSummary describes the approvals in Markdown. Unlike the status
+// description, it isn't limited in length, so it links to each approval and
+// lists everything which is still required.
+func (s statusInfo) newCheckRunSummary() string {
+	var summary bytes.Buffer
+
+	summary.WriteString("### Approvals\n\n")
+	if len(s.lgtmers) == 0 {
+		summary.WriteString("No approvals yet.\n")
+	}
+	for _, lgtmer := range s.lgtmers {
+		if url := s.approvalURL(lgtmer); url != "" {
+			fmt.Fprintf(&summary, "- [%s](%s)\n", lgtmer, url)
+		} else {
+			fmt.Fprintf(&summary, "- %s\n", lgtmer)
+		}
+	}
+
+	remaining := s.remainingRequirements()
+	summary.WriteString("\n### Remaining requirements\n\n")
+	if len(remaining) == 0 {
+		summary.WriteString("None. This pull request is approved.\n")
+	}
+	for _, requirement := range remaining {
+		fmt.Fprintf(&summary, "- %s\n", requirement)
+	}
+
+	if len(s.ruleResults) > 0 {
+		summary.WriteString("\n### Rules\n\n")
+		summary.WriteString("| Rule | Approved by | Satisfied? |\n")
+		summary.WriteString("| --- | --- | --- |\n")
+		for _, result := range s.ruleResults {
+			satisfied := "yes"
+			if !result.Satisfied() {
+				satisfied = fmt.Sprintf("no, needs %d more", result.Remaining())
+			}
+			fmt.Fprintf(&summary, "| %s | %s | %s |\n",
+				result.Rule, strings.Join(result.Approvers, ", "), satisfied)
+		}
+	}
+
+	if s.note != "" {
+		fmt.Fprintf(&summary, "\n%s\n", s.note)
+	}
+
+	return summary.String()
+}
+
+// remainingRequirements lists what's needed before the PR is approved.
+func (s statusInfo) remainingRequirements() []string {
+	requirements := []string{}
+	if remaining := s.quorum - len(s.lgtmers); remaining > 0 {
+		requirements = append(requirements, fmt.Sprintf("%s from any maintainer", moreLGTMs(remaining)))
+	}
+	for _, owners := range s.missingOwners {
+		requirements = append(requirements, fmt.Sprintf("An LGTM from code owner %s", owners))
+	}
+	for _, result := range s.unsatisfiedRules() {
+		requirements = append(requirements, fmt.Sprintf("%s from %s", moreLGTMs(result.Remaining()), whoForRule(result.Rule)))
+	}
+	return requirements
+}
+
+func whoForRule(rule Rule) string {
+	if rule.Team == "" {
+		return "any maintainer"
+	}
+	return rule.Team
+}
+
+func moreLGTMs(count int) string {
+	if count == 1 {
+		return "1 more LGTM"
+	}
+	return fmt.Sprintf("%d more LGTMs", count)
+}
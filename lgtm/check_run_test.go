@@ -0,0 +1,151 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCheckRunSummary(t *testing.T) {
+	info := statusInfo{quorum: 3, note: "Kept after rebase."}
+	info.addLGTMer("parkr", "https://github.com/o/r/pull/273#issuecomment-1")
+	info.addLGTMer("mattr-", "")
+	info.missingOwners = []string{"@o/docs"}
+	info.ruleResults = []ruleResult{
+		{Rule: Rule{Team: "@o/core", Count: 1}, Approvers: []string{"@parkr"}},
+		{Rule: Rule{Team: "@o/security", Count: 2}, Approvers: []string{}},
+	}
+
+	assert.Equal(t, `### Approvals
+
+- [@parkr](https://github.com/o/r/pull/273#issuecomment-1)
+- @mattr-
+
+### Remaining requirements
+
+- 1 more LGTM from any maintainer
+- An LGTM from code owner @o/docs
+- 2 more LGTMs from @o/security
+
+### Rules
+
+| Rule | Approved by | Satisfied? |
+| --- | --- | --- |
+| 1 from @o/core | @parkr | yes |
+| 2 from @o/security |  | no, needs 2 more |
+
+Kept after rebase.
+`, info.newCheckRunSummary())
+}
+
+func TestNewCheckRunSummaryApproved(t *testing.T) {
+	info := statusInfo{quorum: 1}
+	info.addLGTMer("@parkr", "https://github.com/o/r/pull/273#pullrequestreview-2")
+	assert.Equal(t, `### Approvals
+
+- [@parkr](https://github.com/o/r/pull/273#pullrequestreview-2)
+
+### Remaining requirements
+
+None. This pull request is approved.
+`, info.newCheckRunSummary())
+
+	info.removeLGTMer("parkr")
+	assert.Equal(t, "", info.approvalURL("@parkr"))
+}
+
+func TestPublishCheckRun(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	info := &statusInfo{quorum: 1, sha: prSHA}
+	info.addLGTMer("parkr", "")
+
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/commits/%s/check-runs", prSHA), func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		assert.Equal(t, "o/lgtm", r.URL.Query().Get("check_name"))
+		fmt.Fprint(w, `{"total_count":0,"check_runs":[]}`)
+	})
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"number":273,"head":{"ref":"fix-it","sha":%q}}`, prSHA)
+	})
+	created := false
+	mux.HandleFunc("/repos/o/r/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		created = true
+		testMethod(t, r, "POST")
+		v := new(github.CreateCheckRunOptions)
+		json.NewDecoder(r.Body).Decode(v)
+		assert.Equal(t, "o/lgtm", v.Name)
+		assert.Equal(t, "fix-it", v.HeadBranch)
+		assert.Equal(t, prSHA, v.HeadSHA)
+		assert.Equal(t, "completed", v.GetStatus())
+		assert.Equal(t, "success", v.GetConclusion())
+		assert.Equal(t, "Approved by @parkr.", v.GetOutput().GetTitle())
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	assert.NoError(t, publishCheckRun(context, ref, prSHA, info))
+	assert.True(t, created, "the check run should be created")
+}
+
+func TestPublishCheckRunUpdatesExisting(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	info := &statusInfo{quorum: 2, sha: prSHA, lgtmers: []string{}}
+
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/commits/%s/check-runs", prSHA), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count":1,"check_runs":[{"id":42,"name":"o/lgtm"}]}`)
+	})
+	updated := false
+	mux.HandleFunc("/repos/o/r/check-runs/42", func(w http.ResponseWriter, r *http.Request) {
+		updated = true
+		testMethod(t, r, "PATCH")
+		v := new(github.UpdateCheckRunOptions)
+		json.NewDecoder(r.Body).Decode(v)
+		assert.Equal(t, "in_progress", v.GetStatus())
+		assert.Nil(t, v.Conclusion)
+		fmt.Fprint(w, `{"id":42}`)
+	})
+
+	assert.NoError(t, publishCheckRun(context, ref, prSHA, info))
+	assert.True(t, updated, "the check run should be updated")
+}
+
+func TestPublishCheckRunReplacesCompleted(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	// The only approval was retracted.
+	info := &statusInfo{quorum: 1, sha: prSHA, lgtmers: []string{}}
+
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/commits/%s/check-runs", prSHA), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count":1,"check_runs":[{"id":42,"name":"o/lgtm","status":"completed","conclusion":"success"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/check-runs/42", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the completed check run shouldn't be updated")
+	})
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/pulls/%d", ref.Number), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"head":{"ref":"feature"}}`)
+	})
+	created := false
+	mux.HandleFunc("/repos/o/r/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		created = true
+		testMethod(t, r, "POST")
+		v := new(github.CreateCheckRunOptions)
+		json.NewDecoder(r.Body).Decode(v)
+		assert.Equal(t, "in_progress", v.GetStatus())
+		fmt.Fprint(w, `{"id":43}`)
+	})
+
+	assert.NoError(t, publishCheckRun(context, ref, prSHA, info))
+	assert.True(t, created, "a new check run should be created")
+}
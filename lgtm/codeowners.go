@@ -0,0 +1,260 @@
+package lgtm
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/auth"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// codeOwnersPaths are the places GitHub looks for a CODEOWNERS file, in order.
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeOwnersCache holds the parsed CODEOWNERS of each base SHA, which never
+// change, so they're only fetched once per push to the base branch.
+var codeOwnersCache = codeOwnersMap{data: make(map[string][]codeOwnersRule)}
+
+type codeOwnersMap struct {
+	sync.Mutex // protects 'data'
+	data       map[string][]codeOwnersRule
+}
+
+// codeOwnersRule is a single line of a CODEOWNERS file.
+type codeOwnersRule struct {
+	pattern string
+	matcher *regexp.Regexp
+	owners  []string
+}
+
+// parseCodeOwners parses the contents of a CODEOWNERS file. Email owners are
+// ignored as they can't be matched against LGTMers.
+func parseCodeOwners(contents string) []codeOwnersRule {
+	rules := []codeOwnersRule{}
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		owners := []string{}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "@") {
+				owners = append(owners, owner)
+			}
+		}
+
+		matcher, err := codeOwnersPatternRegexp(fields[0])
+		if err != nil {
+			continue
+		}
+		rules = append(rules, codeOwnersRule{pattern: fields[0], matcher: matcher, owners: owners})
+	}
+	return rules
+}
+
+// codeOwnersPatternRegexp converts a gitignore-style CODEOWNERS pattern into
+// a regular expression which matches file paths. A pattern matches anything
+// in the directory it names, unless it ends in "*": "docs/*" only matches
+// the files directly in docs.
+func codeOwnersPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	var expr strings.Builder
+	if anchored {
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	switch {
+	case dirOnly:
+		expr.WriteString("/.*$")
+	case strings.HasSuffix(pattern, "*"):
+		expr.WriteString("$")
+	default:
+		expr.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(expr.String())
+}
+
+// ownersFor returns the owners of the file. As with GitHub, the last
+// matching rule takes precedence.
+func ownersFor(rules []codeOwnersRule, filename string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matcher.MatchString(filename) {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// requiredOwnerSets returns, for each distinct set of owners matching the
+// changed files, the owners of which at least one must approve.
+func requiredOwnerSets(rules []codeOwnersRule, filenames []string) [][]string {
+	seen := map[string]bool{}
+	sets := [][]string{}
+	for _, filename := range filenames {
+		owners := ownersFor(rules, filename)
+		if len(owners) == 0 {
+			continue
+		}
+		key := strings.Join(owners, " ")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		sets = append(sets, owners)
+	}
+	return sets
+}
+
+// isCodeOwner returns true if the LGTMer is the owner, or a member of the
+// owning team.
+func isCodeOwner(context *ctx.Context, owner, lgtmer string) bool {
+	if isSameLGTMer(owner, strings.TrimPrefix(lgtmer, "@")) {
+		return true
+	}
+	pieces := strings.SplitN(strings.TrimPrefix(owner, "@"), "/", 2)
+	if len(pieces) != 2 {
+		return false
+	}
+	return auth.UserIsTeamMember(context, pieces[0], pieces[1], strings.TrimPrefix(lgtmer, "@"))
+}
+
+// missingCodeOwners returns one entry per path owned by a set of owners none
+// of whom have LGTM'd the PR. Each entry names the set's owners.
+func missingCodeOwners(context *ctx.Context, ref prRef, info *statusInfo) ([]string, error) {
+	pr, _, err := context.GitHub.PullRequests.Get(context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := codeOwnersFor(context, ref, pr.GetBase())
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	filenames, err := changedFiles(context, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, owners := range requiredOwnerSets(rules, filenames) {
+		if !hasOwnerApproval(context, owners, info.lgtmers) {
+			missing = append(missing, strings.Join(owners, " or "))
+		}
+	}
+	return missing, nil
+}
+
+func hasOwnerApproval(context *ctx.Context, owners, lgtmers []string) bool {
+	for _, owner := range owners {
+		for _, lgtmer := range lgtmers {
+			if isCodeOwner(context, owner, lgtmer) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// codeOwnersFor returns the CODEOWNERS rules of the PR's base. If they can't
+// be fetched, no owners are required rather than failing the status.
+func codeOwnersFor(context *ctx.Context, ref prRef, base *github.PullRequestBranch) []codeOwnersRule {
+	sha := base.GetSHA()
+	cacheKey := ref.Repo.Owner + "/" + ref.Repo.Name + "@" + sha
+	if sha != "" {
+		codeOwnersCache.Lock()
+		rules, ok := codeOwnersCache.data[cacheKey]
+		codeOwnersCache.Unlock()
+		if ok {
+			return rules
+		}
+	}
+
+	commitish := sha
+	if commitish == "" {
+		commitish = base.GetRef()
+	}
+	rules, err := fetchCodeOwners(context, ref, commitish)
+	if err != nil {
+		context.Log("lgtm.codeOwnersFor: couldn't fetch CODEOWNERS for %s at %s, requiring no owners: %v", ref, commitish, err)
+		return nil
+	}
+
+	if sha != "" {
+		codeOwnersCache.Lock()
+		codeOwnersCache.data[cacheKey] = rules
+		codeOwnersCache.Unlock()
+	}
+	return rules
+}
+
+func fetchCodeOwners(context *ctx.Context, ref prRef, commitish string) ([]codeOwnersRule, error) {
+	for _, path := range codeOwnersPaths {
+		contents, _, resp, err := context.GitHub.Repositories.GetContents(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, path,
+			&github.RepositoryContentGetOptions{Ref: commitish},
+		)
+		if resp != nil && resp.StatusCode == 404 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := contents.GetContent()
+		if err != nil {
+			return nil, err
+		}
+		return parseCodeOwners(decoded), nil
+	}
+	return nil, nil
+}
+
+func changedFiles(context *ctx.Context, ref prRef) ([]string, error) {
+	filenames := []string{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := context.GitHub.PullRequests.ListFiles(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			filenames = append(filenames, file.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return filenames, nil
+}
@@ -0,0 +1,153 @@
+package lgtm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+var exampleCodeOwners = `# Lines starting with '#' are comments.
+*                           @jekyll/core
+*.md                        @jekyll/documentation docs@jekyllrb.com
+/lib/jekyll/commands/       @jekyll/build
+docs/**/*.html              @parkr
+script/                     @jekyll/build @jekyll/stability # trailing comment
+site/*                      @jekyll/documentation
+/vendor
+`
+
+func TestParseCodeOwners(t *testing.T) {
+	rules := parseCodeOwners(exampleCodeOwners)
+	assert.Len(t, rules, 7)
+	assert.Equal(t, "*.md", rules[1].pattern)
+	assert.Equal(t, []string{"@jekyll/documentation"}, rules[1].owners)
+	assert.Equal(t, []string{"@jekyll/build", "@jekyll/stability"}, rules[4].owners)
+	assert.Equal(t, []string{}, rules[6].owners)
+}
+
+func TestCodeOwnersOwnersFor(t *testing.T) {
+	rules := parseCodeOwners(exampleCodeOwners)
+	cases := map[string][]string{
+		"lib/jekyll.rb":                  {"@jekyll/core"},
+		"README.md":                      {"@jekyll/documentation"},
+		"docs/_docs/usage.md":            {"@jekyll/documentation"},
+		"lib/jekyll/commands/build.rb":   {"@jekyll/build"},
+		"lib/jekyll/commands":            {"@jekyll/core"},
+		"test/lib/jekyll/commands/x.rb":  {"@jekyll/core"},
+		"docs/_layouts/default.html":     {"@parkr"},
+		"docs/index.html":                {"@parkr"},
+		"script/test":                    {"@jekyll/build", "@jekyll/stability"},
+		"vendor/bundle/gems/foo/init.rb": {},
+		"site/index.html":                {"@jekyll/documentation"},
+		"site/_layouts/default.html":     {"@jekyll/core"},
+	}
+	for filename, expected := range cases {
+		assert.Equal(t, expected, ownersFor(rules, filename), "filename: %s", filename)
+	}
+	assert.Nil(t, ownersFor(parseCodeOwners("/lib/ @parkr"), "README.md"))
+}
+
+func TestRequiredOwnerSets(t *testing.T) {
+	rules := parseCodeOwners(exampleCodeOwners)
+	assert.Equal(t,
+		[][]string{{"@jekyll/build"}, {"@jekyll/documentation"}},
+		requiredOwnerSets(rules, []string{
+			"lib/jekyll/commands/build.rb",
+			"lib/jekyll/commands/serve.rb",
+			"README.md",
+			"vendor/foo.rb",
+		}),
+	)
+}
+
+func TestMissingCodeOwners(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	codeOwners := "/lib/ @parkr\n/docs/ @envygeeks @mattr-\n"
+
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Base: &github.PullRequestBranch{Ref: github.String("3.8-stable")},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/contents/.github/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/o/r/contents/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "3.8-stable", r.URL.Query().Get("ref"))
+		fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`,
+			base64.StdEncoding.EncodeToString([]byte(codeOwners)))
+	})
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/pulls/%d/files", ref.Number), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename":"lib/jekyll.rb"},{"filename":"docs/index.md"},{"filename":"Gemfile"}]`)
+	})
+
+	missing, err := missingCodeOwners(context, ref, &statusInfo{lgtmers: []string{"@mattr-"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@parkr"}, missing)
+
+	missing, err = missingCodeOwners(context, ref, &statusInfo{lgtmers: []string{}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@parkr", "@envygeeks or @mattr-"}, missing)
+
+	missing, err = missingCodeOwners(context, ref, &statusInfo{lgtmers: []string{"@PARKR", "@envygeeks"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, missing)
+}
+
+func TestMissingCodeOwnersCachesCodeOwnersByBaseSHA(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	codeOwnersCache = codeOwnersMap{data: make(map[string][]codeOwnersRule)}
+
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Base: &github.PullRequestBranch{Ref: github.String("master"), SHA: github.String("basesha")},
+		})
+	})
+	fetches := 0
+	mux.HandleFunc("/repos/o/r/contents/.github/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		assert.Equal(t, "basesha", r.URL.Query().Get("ref"))
+		fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`,
+			base64.StdEncoding.EncodeToString([]byte("* @parkr\n")))
+	})
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/pulls/%d/files", ref.Number), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename":"lib/jekyll.rb"}]`)
+	})
+
+	for i := 0; i < 3; i++ {
+		missing, err := missingCodeOwners(context, ref, &statusInfo{lgtmers: []string{}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"@parkr"}, missing)
+	}
+	assert.Equal(t, 1, fetches)
+}
+
+func TestMissingCodeOwnersWhenCodeOwnersCantBeFetched(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	codeOwnersCache = codeOwnersMap{data: make(map[string][]codeOwnersRule)}
+
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Base: &github.PullRequestBranch{Ref: github.String("master"), SHA: github.String("basesha")},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/contents/.github/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+
+	missing, err := missingCodeOwners(context, ref, &statusInfo{lgtmers: []string{}})
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
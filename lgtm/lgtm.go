@@ -4,6 +4,7 @@ package lgtm
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/google/go-github/github"
 	"github.com/parkr/auto-reply/auth"
@@ -12,9 +13,22 @@ import (
 
 var lgtmBodyRegexp = regexp.MustCompile(`(?i:\ALGTM[!.,]\s+|\s+LGTM[.!,]*\z|\ALGTM[.!,]*\z)`)
 
+// defaultRetractionRegexp matches comments such as "-LGTM", "un-LGTM" or
+// "LGTM retracted" which take back a previous LGTM.
+var defaultRetractionRegexp = regexp.MustCompile(`(?i:\A\s*(-|un-?)LGTM[.!]*\s*\z|\bLGTM\s+retracted\b)`)
+
 type prRef struct {
 	Repo   Repo
 	Number int
+
+	// targetURL is the status page for this PR, if any.
+	targetURL string
+
+	// checkRuns is whether to publish a check run as well as the status.
+	checkRuns bool
+
+	// retractionRegexp is the handler's retraction pattern, if it has one.
+	retractionRegexp *regexp.Regexp
 }
 
 func (r prRef) String() string {
@@ -25,10 +39,56 @@ type Repo struct {
 	Owner, Name string
 	// The number of LGTM's a PR must get before going state: "success"
 	Quorum int
+	// Whether approvals survive new commits being pushed to the PR.
+	CarryOver CarryOverPolicy
+	// Whether each path with a CODEOWNERS entry needs an owner's LGTM.
+	RequireCodeOwners bool
+	// Additional requirements, e.g. a minimum number of LGTMs from a team.
+	Rules []Rule
 }
 
 type Handler struct {
 	repos []Repo
+	store Store
+
+	statusPageURL string
+	checkRuns     bool
+
+	retractionRegexp *regexp.Regexp
+}
+
+// SetStore configures the Store in which LGTM state is persisted. Without
+// one, the state is parsed from the commit status description.
+func (h *Handler) SetStore(store Store) {
+	h.store = store
+}
+
+// SetRetractionPattern configures the pattern which comments must match to
+// retract a previous LGTM. It defaults to defaultRetractionRegexp.
+func (h *Handler) SetRetractionPattern(pattern string) error {
+	retractionRegexp, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	h.retractionRegexp = retractionRegexp
+	return nil
+}
+
+func (h *Handler) isRetraction(body string) bool {
+	return isRetraction(h.retractionRegexp, body)
+}
+
+func (r prRef) isRetraction(body string) bool {
+	return isRetraction(r.retractionRegexp, body)
+}
+
+// isRetraction returns true if the comment body retracts an LGTM, using
+// defaultRetractionRegexp if retractionRegexp is nil.
+func isRetraction(retractionRegexp *regexp.Regexp, body string) bool {
+	if retractionRegexp != nil {
+		return retractionRegexp.MatchString(body)
+	}
+	return defaultRetractionRegexp.MatchString(body)
 }
 
 func (h *Handler) AddRepo(owner, name string, quorum int) {
@@ -43,10 +103,60 @@ func (h *Handler) AddRepo(owner, name string, quorum int) {
 	}
 }
 
+// SetCarryOverPolicy configures whether approvals on an enabled repo survive
+// new commits being pushed to its PRs.
+func (h *Handler) SetCarryOverPolicy(owner, name string, policy CarryOverPolicy) error {
+	repo := h.findRepo(owner, name)
+	if repo == nil {
+		return fmt.Errorf("lgtm.SetCarryOverPolicy: not enabled for %s/%s", owner, name)
+	}
+	repo.CarryOver = policy
+	return nil
+}
+
+// SetRequireCodeOwners configures whether an enabled repo requires at least
+// one LGTM from an owner of each changed path in its CODEOWNERS file.
+func (h *Handler) SetRequireCodeOwners(owner, name string, required bool) error {
+	repo := h.findRepo(owner, name)
+	if repo == nil {
+		return fmt.Errorf("lgtm.SetRequireCodeOwners: not enabled for %s/%s", owner, name)
+	}
+	repo.RequireCodeOwners = required
+	return nil
+}
+
+// AddRule adds an approval requirement to an enabled repo.
+func (h *Handler) AddRule(owner, name string, rule Rule) error {
+	repo := h.findRepo(owner, name)
+	if repo == nil {
+		return fmt.Errorf("lgtm.AddRule: not enabled for %s/%s", owner, name)
+	}
+	if rule.Team != "" {
+		if _, _, ok := rule.teamSlug(); !ok {
+			return fmt.Errorf("lgtm.AddRule: team %q must look like @org/team", rule.Team)
+		}
+	}
+	repo.Rules = append(repo.Rules, rule)
+	return nil
+}
+
+// SetStatusPageURL configures the base URL at which StatusPageHandler is
+// served. When set, each status links to its PR's approval breakdown.
+func (h *Handler) SetStatusPageURL(baseURL string) {
+	h.statusPageURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetCheckRuns configures whether the LGTM state is also published as a
+// check run with a full summary of the approvals. This requires the bot to
+// be authenticated as a GitHub App. The commit status is always set.
+func (h *Handler) SetCheckRuns(enabled bool) {
+	h.checkRuns = enabled
+}
+
 func (h *Handler) findRepo(owner, name string) *Repo {
-	for _, repo := range h.repos {
-		if repo.Owner == owner && repo.Name == name {
-			return &repo
+	for i := range h.repos {
+		if h.repos[i].Owner == owner && h.repos[i].Name == name {
+			return &h.repos[i]
 		}
 	}
 
@@ -58,17 +168,20 @@ func (h *Handler) isEnabledFor(owner, name string) bool {
 }
 
 func (h *Handler) newPRRef(owner, name string, number int) prRef {
-	repo := h.findRepo(owner, name)
-	if repo != nil {
-		return prRef{
-			Repo:   *repo,
-			Number: number,
-		}
+	ref := prRef{
+		Repo:      Repo{Owner: owner, Name: name, Quorum: 0},
+		Number:    number,
+		checkRuns: h.checkRuns,
+
+		retractionRegexp: h.retractionRegexp,
+	}
+	if repo := h.findRepo(owner, name); repo != nil {
+		ref.Repo = *repo
 	}
-	return prRef{
-		Repo:   Repo{Owner: owner, Name: name, Quorum: 0},
-		Number: number,
+	if h.statusPageURL != "" {
+		ref.targetURL = fmt.Sprintf("%s/%s/%s/%d", h.statusPageURL, owner, name, number)
 	}
+	return ref
 }
 
 func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{}) error {
@@ -77,23 +190,53 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 		return context.NewError("lgtm.IssueCommentHandler: not an issue comment event")
 	}
 
-	// LGTM comment?
-	if !lgtmBodyRegexp.MatchString(*comment.Comment.Body) {
-		return context.NewError("lgtm.IssueCommentHandler: not a LGTM comment")
-	}
-
 	// Is this a pull request?
 	if comment.Issue == nil || comment.Issue.PullRequestLinks == nil {
 		return context.NewError("lgtm.IssueCommentHandler: not a pull request")
 	}
 
 	ref := h.newPRRef(*comment.Repo.Owner.Login, *comment.Repo.Name, *comment.Issue.Number)
-	lgtmer := *comment.Comment.User.Login
 
 	if !h.isEnabledFor(ref.Repo.Owner, ref.Repo.Name) {
 		return context.NewError("lgtm.IssueCommentHandler: not enabled for %s/%s", ref.Repo.Owner, ref.Repo.Name)
 	}
 
+	body := comment.GetComment().GetBody()
+	isLGTM := lgtmBodyRegexp.MatchString(body) && !h.isRetraction(body)
+
+	switch comment.GetAction() {
+	case "created":
+		if h.isRetraction(body) {
+			return h.retract(context, ref, comment)
+		}
+		if isLGTM {
+			return h.approve(context, ref, comment)
+		}
+	case "edited":
+		var previousBody string
+		if comment.Changes != nil && comment.Changes.Body != nil && comment.Changes.Body.From != nil {
+			previousBody = *comment.Changes.Body.From
+		}
+		wasLGTM := lgtmBodyRegexp.MatchString(previousBody) && !h.isRetraction(previousBody)
+		if h.isRetraction(body) || (wasLGTM && !isLGTM) {
+			return h.retract(context, ref, comment)
+		}
+		if isLGTM && !wasLGTM {
+			return h.approve(context, ref, comment)
+		}
+	case "deleted":
+		if isLGTM {
+			return h.retract(context, ref, comment)
+		}
+	}
+
+	return context.NewError("lgtm.IssueCommentHandler: not a LGTM comment")
+}
+
+// approve adds the commenter as an LGTMer if they have push access.
+func (h *Handler) approve(context *ctx.Context, ref prRef, comment *github.IssueCommentEvent) error {
+	lgtmer := *comment.Comment.User.Login
+
 	// Does the user have merge/label abilities?
 	if !auth.CommenterHasPushAccess(context, *comment) {
 		return context.NewError(
@@ -102,7 +245,7 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 	}
 
 	// Get status
-	info, err := getStatus(context, ref)
+	info, err := getStatus(context, h.store, ref)
 	if err != nil {
 		return context.NewError("lgtm.IssueCommentHandler: couldn't get status for %s: %v", ref, err)
 	}
@@ -113,8 +256,10 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 			"lgtm.IssueCommentHandler: no duplicate LGTM allowed for @%s on %s", lgtmer, ref)
 	}
 
-	info.lgtmers = append(info.lgtmers, "@"+lgtmer)
-	if err := setStatus(context, ref, info.sha, info); err != nil {
+	info.addLGTMer(lgtmer, comment.Comment.GetHTMLURL())
+	// The carry-over note only describes the push which set it.
+	info.note = ""
+	if err := setStatus(context, h.store, ref, info.sha, info); err != nil {
 		return context.NewError(
 			"lgtm.IssueCommentHandler: had trouble adding lgtmer '%s' on %s: %v",
 			lgtmer, ref, err)
@@ -122,6 +267,30 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 	return nil
 }
 
+// retract removes the comment author's LGTM, if they gave one.
+func (h *Handler) retract(context *ctx.Context, ref prRef, comment *github.IssueCommentEvent) error {
+	lgtmer := *comment.Comment.User.Login
+
+	info, err := getStatus(context, h.store, ref)
+	if err != nil {
+		return context.NewError("lgtm.IssueCommentHandler: couldn't get status for %s: %v", ref, err)
+	}
+
+	if !info.IsLGTMer(lgtmer) {
+		return context.NewError(
+			"lgtm.IssueCommentHandler: @%s hasn't LGTM'd %s, so there's nothing to retract", lgtmer, ref)
+	}
+
+	info.removeLGTMer(lgtmer)
+	info.note = ""
+	if err := setStatus(context, h.store, ref, info.sha, info); err != nil {
+		return context.NewError(
+			"lgtm.IssueCommentHandler: had trouble removing lgtmer '%s' on %s: %v",
+			lgtmer, ref, err)
+	}
+	return nil
+}
+
 func (h *Handler) PullRequestHandler(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.PullRequestEvent)
 	if !ok {
@@ -134,12 +303,34 @@ func (h *Handler) PullRequestHandler(context *ctx.Context, payload interface{})
 		return context.NewError("lgtm.PullRequestHandler: not enabled for %s", ref)
 	}
 
+	if *event.Action == "closed" {
+		statusCache.Lock()
+		delete(statusCache.data, ref.String())
+		statusCache.Unlock()
+		if h.store != nil {
+			if err := h.store.Delete(ref.Repo.Owner, ref.Repo.Name, ref.Number); err != nil {
+				context.Log("lgtm.PullRequestHandler: couldn't forget %s: %v", ref, err)
+			}
+		}
+		return nil
+	}
+
 	if *event.Action == "opened" || *event.Action == "synchronize" {
-		err := setStatus(context, ref, *event.PullRequest.Head.SHA, &statusInfo{
+		info := &statusInfo{
 			lgtmers: []string{},
 			quorum:  ref.Repo.Quorum,
 			sha:     *event.PullRequest.Head.SHA,
-		})
+		}
+		if *event.Action == "synchronize" {
+			if previous := getLatestStatus(context, h.store, ref); previous != nil {
+				info.lgtmers, info.note = carryOver(context, ref, event.PullRequest, previous)
+				if len(info.lgtmers) > 0 {
+					info.approvalURLs = copyApprovalURLs(previous.approvalURLs)
+					info.carriedFrom = previous.sha
+				}
+			}
+		}
+		err := setStatus(context, h.store, ref, *event.PullRequest.Head.SHA, info)
 		if err != nil {
 			return context.NewError(
 				"lgtm.PullRequestHandler: could not create status on %s: %v",
@@ -1,7 +1,14 @@
 package lgtm
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLGTMBodyRegexp(t *testing.T) {
@@ -24,3 +31,103 @@ func TestLGTMBodyRegexp(t *testing.T) {
 		}
 	}
 }
+
+func TestRetractionRegexp(t *testing.T) {
+	cases := map[string]bool{
+		"-LGTM":                                  true,
+		"-lgtm.":                                 true,
+		"un-LGTM":                                true,
+		"unLGTM":                                 true,
+		"LGTM retracted":                         true,
+		"Sorry, LGTM retracted until CI passes.": true,
+		"LGTM":                                   false,
+		"LGTM!":                                  false,
+		"Yeah, this LGTM.":                       false,
+		"I'd love to get a LGTM for this.":       false,
+	}
+	handler := &Handler{}
+	for input, expected := range cases {
+		if actual := handler.isRetraction(input); actual != expected {
+			t.Fatalf("isRetraction expected '%v' but got '%v' for `%s`", expected, actual, input)
+		}
+	}
+}
+
+func TestSetRetractionPattern(t *testing.T) {
+	handler := &Handler{}
+	assert.Error(t, handler.SetRetractionPattern("(unclosed"))
+	assert.NoError(t, handler.SetRetractionPattern(`(?i)\Anevermind\z`))
+	assert.True(t, handler.isRetraction("Nevermind"))
+	assert.False(t, handler.isRetraction("-LGTM"))
+}
+
+func newTestIssueCommentEvent(action, login, body string) *github.IssueCommentEvent {
+	return &github.IssueCommentEvent{
+		Action: github.String(action),
+		Issue: &github.Issue{
+			Number:           github.Int(ref.Number),
+			PullRequestLinks: &github.PullRequestLinks{},
+		},
+		Comment: &github.IssueComment{
+			User: &github.User{Login: github.String(login)},
+			Body: github.String(body),
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String(ref.Repo.Owner)},
+			Name:  github.String(ref.Repo.Name),
+		},
+	}
+}
+
+func TestIssueCommentHandlerRetracts(t *testing.T) {
+	editedFromLGTM := newTestIssueCommentEvent("edited", "parkr", "Actually, hold on.")
+	editedFromLGTM.Changes = &github.EditChange{}
+	editedFromLGTM.Changes.Body = &struct {
+		From *string `json:"from,omitempty"`
+	}{From: github.String("LGTM")}
+
+	cases := []*github.IssueCommentEvent{
+		newTestIssueCommentEvent("created", "parkr", "-LGTM"),
+		newTestIssueCommentEvent("deleted", "parkr", "LGTM!"),
+		editedFromLGTM,
+	}
+	for _, event := range cases {
+		setup() // server & client!
+		context := &ctx.Context{GitHub: client}
+		statusCache = statusMap{data: make(map[string]*statusInfo)}
+		statusCache.data[ref.String()] = &statusInfo{
+			lgtmers: []string{"@envygeeks", "@parkr"},
+			quorum:  2,
+			sha:     prSHA,
+			note:    "Kept after rebase.",
+		}
+
+		var posted *github.RepoStatus
+		mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			posted = new(github.RepoStatus)
+			json.NewDecoder(r.Body).Decode(posted)
+			fmt.Fprint(w, `{"id":1}`)
+		})
+
+		assert.NoError(t, handler.IssueCommentHandler(context, event), "action: %s", *event.Action)
+		if assert.NotNil(t, posted, "action: %s", *event.Action) {
+			assert.Equal(t, "pending", *posted.State)
+			assert.Equal(t, "Approved by @envygeeks. Requires 1 more LGTM.", *posted.Description)
+		}
+		assert.Equal(t, []string{"@envygeeks"}, statusCache.data[ref.String()].lgtmers)
+		teardown()
+	}
+}
+
+func TestIssueCommentHandlerRetractWithoutLGTM(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.data[ref.String()] = &statusInfo{lgtmers: []string{"@envygeeks"}, quorum: 2, sha: prSHA}
+
+	err := handler.IssueCommentHandler(context, newTestIssueCommentEvent("created", "parkr", "un-LGTM"))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"@envygeeks"}, statusCache.data[ref.String()].lgtmers)
+}
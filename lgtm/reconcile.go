@@ -0,0 +1,261 @@
+package lgtm
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/auth"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// approval is a single LGTM comment or approving review, or a comment
+// retracting one.
+type approval struct {
+	login     string
+	url       string
+	at        time.Time
+	retracted bool
+}
+
+// reconcile rebuilds the LGTM state of a PR's head SHA from the PR's
+// comments and reviews. Only approvals made after the head commit was
+// committed count, matching the reset which happens upon each push, along
+// with any carried over from a previous head. An approval is dropped if its
+// author retracts it later.
+func reconcile(context *ctx.Context, ref prRef, pr *github.PullRequest, carried *statusInfo) (*statusInfo, error) {
+	sha := pr.GetHead().GetSHA()
+
+	commit, _, err := context.GitHub.Git.GetCommit(context.Context(), ref.Repo.Owner, ref.Repo.Name, sha)
+	if err != nil {
+		return nil, err
+	}
+	since := commit.GetCommitter().GetDate()
+
+	approvals := []approval{}
+
+	commentOpts := &github.IssueListCommentsOptions{
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, resp, err := context.GitHub.Issues.ListComments(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, commentOpts)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			if comment.GetCreatedAt().Before(since) {
+				continue
+			}
+			body := comment.GetBody()
+			retracted := ref.isRetraction(body)
+			if !retracted && !lgtmBodyRegexp.MatchString(body) {
+				continue
+			}
+			approvals = append(approvals, approval{
+				login:     comment.GetUser().GetLogin(),
+				url:       comment.GetHTMLURL(),
+				at:        comment.GetCreatedAt(),
+				retracted: retracted,
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		commentOpts.Page = resp.NextPage
+	}
+
+	reviewOpts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := context.GitHub.PullRequests.ListReviews(
+			context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, reviewOpts)
+		if err != nil {
+			return nil, err
+		}
+		for _, review := range reviews {
+			if review.GetState() != "APPROVED" || review.GetCommitID() != sha {
+				continue
+			}
+			approvals = append(approvals, approval{login: review.GetUser().GetLogin(), url: review.GetHTMLURL(), at: review.GetSubmittedAt()})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		reviewOpts.Page = resp.NextPage
+	}
+
+	sort.SliceStable(approvals, func(i, j int) bool {
+		return approvals[i].at.Before(approvals[j].at)
+	})
+
+	info := &statusInfo{lgtmers: []string{}, quorum: ref.Repo.Quorum, sha: sha}
+	if carried != nil {
+		for _, lgtmer := range carried.lgtmers {
+			info.addLGTMer(lgtmer, carried.approvalURL(lgtmer))
+		}
+		info.note, info.carriedFrom = carried.note, carried.carriedFrom
+	}
+	for _, approval := range approvals {
+		if approval.retracted {
+			info.removeLGTMer(approval.login)
+			continue
+		}
+		if approval.login == "" || info.IsLGTMer(approval.login) {
+			continue
+		}
+		if !auth.UserHasPushAccess(context, ref.Repo.Owner, ref.Repo.Name, approval.login) {
+			continue
+		}
+		info.addLGTMer(approval.login, approval.url)
+	}
+
+	return info, nil
+}
+
+// Reconciliation compares the LGTM status currently set on a PR's head SHA
+// with the status recomputed from the PR's comments and reviews.
+type Reconciliation struct {
+	Ref string
+	SHA string
+
+	// CurrentState and CurrentDescription are empty if there is no status.
+	CurrentState, CurrentDescription       string
+	RecomputedState, RecomputedDescription string
+
+	// Err is why the status couldn't be recomputed, if it couldn't.
+	Err error
+}
+
+// Changed returns true if the recomputed status differs from the current one.
+func (r Reconciliation) Changed() bool {
+	return r.Err == nil && (r.CurrentState != r.RecomputedState || r.CurrentDescription != r.RecomputedDescription)
+}
+
+// Diff shows the current and recomputed statuses, one per line.
+func (r Reconciliation) Diff() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s@%s\n! %v", r.Ref, r.SHA, r.Err)
+	}
+	current := "(no status)"
+	if r.CurrentState != "" {
+		current = fmt.Sprintf("%s: %s", r.CurrentState, r.CurrentDescription)
+	}
+	return fmt.Sprintf("%s@%s\n- %s\n+ %s: %s",
+		r.Ref, r.SHA, current, r.RecomputedState, r.RecomputedDescription)
+}
+
+// Repos returns the repos which are enabled.
+func (h *Handler) Repos() []Repo {
+	repos := make([]Repo, len(h.repos))
+	copy(repos, h.repos)
+	return repos
+}
+
+// ReconcileRepo recomputes the LGTM status of each open PR in the repo. If
+// perform is true, statuses which have changed are rewritten; otherwise
+// nothing is modified. A PR whose status can't be recomputed has its
+// Reconciliation's Err set, and the rest of the PRs are still reconciled.
+func (h *Handler) ReconcileRepo(context *ctx.Context, owner, name string, perform bool) ([]Reconciliation, error) {
+	if !h.isEnabledFor(owner, name) {
+		return nil, context.NewError("lgtm.ReconcileRepo: not enabled for %s/%s", owner, name)
+	}
+
+	reconciliations := []Reconciliation{}
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		prs, resp, err := context.GitHub.PullRequests.List(context.Context(), owner, name, opts)
+		if err != nil {
+			return reconciliations, err
+		}
+		for _, pr := range prs {
+			reconciliation, err := h.reconcilePR(context, h.newPRRef(owner, name, pr.GetNumber()), pr, perform)
+			if err != nil {
+				context.Log("lgtm.ReconcileRepo: couldn't reconcile %s: %v", reconciliation.Ref, err)
+				reconciliation.Err = err
+			}
+			reconciliations = append(reconciliations, reconciliation)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return reconciliations, nil
+}
+
+func (h *Handler) reconcilePR(context *ctx.Context, ref prRef, pr *github.PullRequest, perform bool) (Reconciliation, error) {
+	sha := pr.GetHead().GetSHA()
+	reconciliation := Reconciliation{Ref: ref.String(), SHA: sha}
+
+	statuses, _, err := context.GitHub.Repositories.ListStatuses(context.Context(), ref.Repo.Owner, ref.Repo.Name, sha, nil)
+	if err != nil {
+		return reconciliation, err
+	}
+	// Statuses are listed newest first, so the first match is current.
+	for _, status := range statuses {
+		if status.GetContext() == lgtmContext(ref.Repo.Owner) {
+			reconciliation.CurrentState = status.GetState()
+			reconciliation.CurrentDescription = status.GetDescription()
+			break
+		}
+	}
+
+	carried, err := h.carriedApprovals(context, ref, pr)
+	if err != nil {
+		return reconciliation, err
+	}
+	info, err := reconcile(context, ref, pr, carried)
+	if err != nil {
+		return reconciliation, err
+	}
+	if err := evaluateRequirements(context, ref, info); err != nil {
+		return reconciliation, err
+	}
+	reconciliation.RecomputedState = info.newState()
+	reconciliation.RecomputedDescription = info.newDescription()
+
+	if perform && reconciliation.Changed() {
+		if err := setStatus(context, h.store, ref, sha, info); err != nil {
+			return reconciliation, err
+		}
+	}
+	return reconciliation, nil
+}
+
+// carriedApprovals returns the approvals which the repo's carry-over policy
+// keeps from the PR's previous head, or nil if there are none. The previous
+// head is only known from the cached or stored LGTM state, so without a store
+// nothing is carried over in a new process. Like carryOver, it keeps them
+// when the bot merged the base branch in, even if the policy always resets
+// them.
+func (h *Handler) carriedApprovals(context *ctx.Context, ref prRef, pr *github.PullRequest) (*statusInfo, error) {
+	sha := pr.GetHead().GetSHA()
+	previous := getLatestStatus(context, h.store, ref)
+	if previous != nil && previous.sha == sha {
+		// The approvals were already carried over to the head, so decide
+		// again using the state of the head they were carried from.
+		if previous.carriedFrom == "" || h.store == nil {
+			return nil, nil
+		}
+		record, err := h.store.Get(newStoreKey(ref, previous.carriedFrom))
+		if err != nil || record == nil {
+			return nil, err
+		}
+		previous = record.statusInfo(previous.carriedFrom)
+	}
+	if previous == nil || len(previous.lgtmers) == 0 {
+		return nil, nil
+	}
+
+	lgtmers, note := carryOver(context, ref, pr, previous)
+	if len(lgtmers) == 0 {
+		return nil, nil
+	}
+	carried := &statusInfo{lgtmers: []string{}, note: note, carriedFrom: previous.sha}
+	for _, lgtmer := range lgtmers {
+		carried.addLGTMer(lgtmer, previous.approvalURL(lgtmer))
+	}
+	return carried, nil
+}
@@ -0,0 +1,380 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	commitGET      = fmt.Sprintf("/repos/%s/%s/git/commits/%s", ref.Repo.Owner, ref.Repo.Name, prSHA)
+	commentsGET    = fmt.Sprintf("/repos/%s/%s/issues/%d/comments", ref.Repo.Owner, ref.Repo.Name, ref.Number)
+	reviewsGET     = fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews", ref.Repo.Owner, ref.Repo.Name, ref.Number)
+	pushedAt       = time.Date(2018, time.November, 1, 12, 0, 0, 0, time.UTC)
+	maintainerTeam = int64(1)
+)
+
+// handlePushAccess mocks the Teams API such that only the given logins are
+// members of a team with push access to the test repo.
+func handlePushAccess(logins ...string) {
+	maintainers := map[string]bool{}
+	for _, login := range logins {
+		maintainers[login] = true
+	}
+
+	mux.HandleFunc("/orgs/o/teams", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.Team{{ID: github.Int64(maintainerTeam)}})
+	})
+	mux.HandleFunc(fmt.Sprintf("/teams/%d/members/", maintainerTeam), func(w http.ResponseWriter, r *http.Request) {
+		login := r.URL.Path[len(fmt.Sprintf("/teams/%d/members/", maintainerTeam)):]
+		if maintainers[login] {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc(fmt.Sprintf("/teams/%d/repos/o/r", maintainerTeam), func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.Repository{
+			Permissions: &map[string]bool{"push": true},
+		})
+	})
+}
+
+func handleReconcileHistory(t *testing.T, comments []*github.IssueComment, reviews []*github.PullRequestReview) {
+	mux.HandleFunc(commitGET, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		json.NewEncoder(w).Encode(&github.Commit{
+			SHA:       github.String(prSHA),
+			Committer: &github.CommitAuthor{Date: &pushedAt},
+		})
+	})
+	mux.HandleFunc(commentsGET, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		json.NewEncoder(w).Encode(comments)
+	})
+	mux.HandleFunc(reviewsGET, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		json.NewEncoder(w).Encode(reviews)
+	})
+}
+
+func newTestComment(login, body string, at time.Time) *github.IssueComment {
+	return &github.IssueComment{
+		User:      &github.User{Login: github.String(login)},
+		Body:      github.String(body),
+		CreatedAt: &at,
+	}
+}
+
+func newTestReview(login, state, sha string, at time.Time) *github.PullRequestReview {
+	return &github.PullRequestReview{
+		User:        &github.User{Login: github.String(login)},
+		State:       github.String(state),
+		CommitID:    github.String(sha),
+		SubmittedAt: &at,
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	handlePushAccess("parkr", "envygeeks", "mattr-")
+	handleReconcileHistory(t,
+		[]*github.IssueComment{
+			newTestComment("parkr", "LGTM", pushedAt.Add(-time.Hour)),
+			newTestComment("envygeeks", "LGTM!", pushedAt.Add(time.Hour)),
+			newTestComment("someone", "LGTM", pushedAt.Add(2*time.Hour)),
+			newTestComment("parkr", "Can you add a test?", pushedAt.Add(3*time.Hour)),
+			newTestComment("envygeeks", "LGTM", pushedAt.Add(4*time.Hour)),
+		},
+		[]*github.PullRequestReview{
+			newTestReview("mattr-", "APPROVED", prSHA, pushedAt.Add(30*time.Minute)),
+			newTestReview("parkr", "APPROVED", "oldsha", pushedAt.Add(-time.Hour)),
+			newTestReview("parkr", "CHANGES_REQUESTED", prSHA, pushedAt.Add(5*time.Hour)),
+		},
+	)
+
+	pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String(prSHA)}}
+	info, err := reconcile(context, ref, pr, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &statusInfo{
+		lgtmers: []string{"@mattr-", "@envygeeks"},
+		quorum:  ref.Repo.Quorum,
+		sha:     prSHA,
+	}, info)
+}
+
+func TestReconcileAppliesRetractions(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	handlePushAccess("parkr", "envygeeks", "mattr-")
+	handleReconcileHistory(t,
+		[]*github.IssueComment{
+			newTestComment("parkr", "LGTM", pushedAt.Add(time.Hour)),
+			newTestComment("envygeeks", "LGTM", pushedAt.Add(2*time.Hour)),
+			newTestComment("parkr", "-LGTM", pushedAt.Add(3*time.Hour)),
+			newTestComment("mattr-", "un-LGTM", pushedAt.Add(4*time.Hour)),
+			newTestComment("envygeeks", "LGTM retracted, sorry", pushedAt.Add(5*time.Hour)),
+			newTestComment("envygeeks", "LGTM", pushedAt.Add(6*time.Hour)),
+		},
+		[]*github.PullRequestReview{
+			newTestReview("mattr-", "APPROVED", prSHA, pushedAt.Add(30*time.Minute)),
+		},
+	)
+
+	pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String(prSHA)}}
+	info, err := reconcile(context, ref, pr, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@envygeeks"}, info.lgtmers)
+}
+
+func TestGetStatusFromStore(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	context := &ctx.Context{GitHub: client}
+	store := newTestStore()
+	assert.NoError(t, store.Put(newStoreKey(ref, prSHA), &Record{Lgtmers: []string{"@parkr"}, Quorum: 1}))
+
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Number: github.Int(ref.Number),
+			Head:   &github.PullRequestBranch{SHA: github.String(prSHA)},
+		})
+	})
+
+	info, err := getStatus(context, store, ref)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &statusInfo{lgtmers: []string{"@parkr"}, quorum: 1, sha: prSHA}, info)
+	assert.Equal(t, info, statusCache.data[ref.String()])
+}
+
+func TestGetStatusReconcilesWhenStoreIsEmpty(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	context := &ctx.Context{GitHub: client}
+	store := newTestStore()
+	statusesHandled := false
+
+	handlePushAccess("parkr")
+	handleReconcileHistory(t,
+		[]*github.IssueComment{newTestComment("parkr", "LGTM", pushedAt.Add(time.Hour))},
+		[]*github.PullRequestReview{},
+	)
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Number: github.Int(ref.Number),
+			Head:   &github.PullRequestBranch{SHA: github.String(prSHA)},
+		})
+	})
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		statusesHandled = true
+		testMethod(t, r, "POST")
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	info, err := getStatus(context, store, ref)
+
+	expected := &statusInfo{lgtmers: []string{"@parkr"}, quorum: 1, sha: prSHA}
+	assert.NoError(t, err)
+	assert.True(t, statusesHandled, "the reconciled status should be saved to GitHub")
+	assert.Equal(t, expected, info)
+
+	record, err := store.Get(newStoreKey(ref, prSHA))
+	assert.NoError(t, err)
+	assert.Equal(t, &Record{SHA: prSHA, Lgtmers: []string{"@parkr"}, Quorum: 1}, record)
+}
+
+// testStore is an in-memory Store for tests.
+type testStore map[string]*Record
+
+func newTestStore() testStore {
+	return testStore{}
+}
+
+func (s testStore) Get(key StoreKey) (*Record, error) {
+	return s[key.String()], nil
+}
+
+func (s testStore) Put(key StoreKey, record *Record) error {
+	s[key.String()] = record
+	key.SHA = ""
+	s[key.String()] = record
+	return nil
+}
+
+func (s testStore) Delete(owner, name string, number int) error {
+	prefix := StoreKey{Owner: owner, Name: name, Number: number}.prPrefix()
+	for key := range s {
+		if strings.HasPrefix(key, prefix) {
+			delete(s, key)
+		}
+	}
+	return nil
+}
+
+func TestReconciliationDiff(t *testing.T) {
+	reconciliation := Reconciliation{
+		Ref: "o/r#273", SHA: prSHA,
+		RecomputedState: "success", RecomputedDescription: "Approved by @parkr.",
+	}
+	assert.True(t, reconciliation.Changed())
+	assert.Equal(t, "o/r#273@"+prSHA+"\n- (no status)\n+ success: Approved by @parkr.", reconciliation.Diff())
+
+	reconciliation.CurrentState = "success"
+	reconciliation.CurrentDescription = "Approved by @parkr."
+	assert.False(t, reconciliation.Changed())
+}
+
+func TestReconcileRepo(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	handlePushAccess("parkr", "envygeeks", "mattr-")
+	handleReconcileHistory(t,
+		[]*github.IssueComment{newTestComment("envygeeks", "LGTM", pushedAt.Add(time.Hour))},
+		[]*github.PullRequestReview{},
+	)
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		json.NewEncoder(w).Encode([]*github.PullRequest{{
+			Number: github.Int(ref.Number),
+			Head:   &github.PullRequestBranch{SHA: github.String(prSHA)},
+		}})
+	})
+	statusesWritten := 0
+	mux.HandleFunc(statusesGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.RepoStatus{
+			newEmptyStatus("o", 1),
+			{Context: github.String("o/lgtm"), State: github.String("success"), Description: github.String("Approved by @parkr.")},
+		})
+	})
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		statusesWritten++
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	_, err := handler.ReconcileRepo(context, "o", "nope", false)
+	assert.Error(t, err)
+
+	reconciliations, err := handler.ReconcileRepo(context, "o", "r", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []Reconciliation{{
+		Ref:                   ref.String(),
+		SHA:                   prSHA,
+		CurrentState:          "pending",
+		CurrentDescription:    "Awaiting approval from at least 1 maintainer.",
+		RecomputedState:       "success",
+		RecomputedDescription: "Approved by @envygeeks.",
+	}}, reconciliations)
+	assert.Equal(t, 0, statusesWritten, "a dry run shouldn't write any statuses")
+
+	_, err = handler.ReconcileRepo(context, "o", "r", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, statusesWritten, "the out-of-date status should be rewritten")
+}
+
+func TestReconcileRepoKeepsCarriedOverApprovals(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+
+	// @parkr approved oldsha, and their approval was carried over when only
+	// the docs changed in the push of prSHA.
+	store := newTestStore()
+	assert.NoError(t, store.Put(newStoreKey(ref, "oldsha"), &Record{SHA: "oldsha", Lgtmers: []string{"@parkr"}, Quorum: 2}))
+	latest := &Record{SHA: prSHA, Lgtmers: []string{"@parkr"}, Quorum: 2, CarriedFrom: "oldsha"}
+	assert.NoError(t, store.Put(newStoreKey(ref, prSHA), latest))
+	assert.NoError(t, store.Put(newStoreKey(ref, ""), latest))
+
+	carryOverHandler := &Handler{}
+	carryOverHandler.AddRepo("o", "r", 2)
+	assert.NoError(t, carryOverHandler.SetCarryOverPolicy("o", "r", CarryOverPolicy{AllowedPaths: []string{"docs/"}}))
+	carryOverHandler.SetStore(store)
+
+	handlePushAccess("parkr", "envygeeks")
+	handleReconcileHistory(t,
+		[]*github.IssueComment{newTestComment("envygeeks", "LGTM", pushedAt.Add(time.Hour))},
+		[]*github.PullRequestReview{},
+	)
+	mux.HandleFunc("/repos/o/r/compare/oldsha..."+prSHA, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "ahead", "files": [{"filename": "docs/index.md"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequest{
+			{Number: github.Int(ref.Number), Head: &github.PullRequestBranch{SHA: github.String(prSHA)}},
+			{Number: github.Int(1), Head: &github.PullRequestBranch{SHA: github.String("brokensha")}},
+		})
+	})
+	mux.HandleFunc(statusesGET, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/brokensha/statuses", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+
+	reconciliations, err := carryOverHandler.ReconcileRepo(context, "o", "r", false)
+	assert.NoError(t, err)
+	if assert.Len(t, reconciliations, 2) {
+		assert.Equal(t, "success", reconciliations[0].RecomputedState)
+		assert.Equal(t, "Approved by @parkr and @envygeeks. Kept: only allow-listed paths changed.", reconciliations[0].RecomputedDescription)
+		assert.Error(t, reconciliations[1].Err)
+		assert.False(t, reconciliations[1].Changed())
+	}
+}
+
+func TestCarriedApprovalsKeepsBotBaseMergesWhenResetAlways(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+
+	// @parkr approved oldsha, then the bot merged the base branch in.
+	store := newTestStore()
+	assert.NoError(t, store.Put(newStoreKey(ref, "oldsha"), &Record{SHA: "oldsha", Lgtmers: []string{"@parkr"}, Quorum: 1}))
+
+	resetAlwaysHandler := &Handler{}
+	resetAlwaysHandler.AddRepo("o", "r", 1)
+	resetAlwaysHandler.SetStore(store)
+	repoRef := resetAlwaysHandler.newPRRef("o", "r", ref.Number)
+	assert.True(t, repoRef.Repo.CarryOver.isResetAlways())
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "jekyllbot"}`)
+	})
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/commits/%s", prSHA), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"author": {"login": "jekyllbot"}, "parents": [{"sha": "oldsha"}, {"sha": "base"}]}`)
+	})
+
+	pr := &github.PullRequest{
+		Base: &github.PullRequestBranch{Ref: github.String("master")},
+		Head: &github.PullRequestBranch{SHA: github.String(prSHA)},
+	}
+	carried, err := resetAlwaysHandler.carriedApprovals(context, repoRef, pr)
+	assert.NoError(t, err)
+	if assert.NotNil(t, carried) {
+		assert.Equal(t, []string{"@parkr"}, carried.lgtmers)
+		assert.Equal(t, "Kept after merging in the base branch.", carried.note)
+		assert.Equal(t, "oldsha", carried.carriedFrom)
+	}
+}
@@ -0,0 +1,126 @@
+package lgtm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/parkr/auto-reply/auth"
+	"github.com/parkr/auto-reply/ctx"
+)
+
+// Rule is an approval requirement beyond the repo's total Quorum, e.g.
+// "at least 1 LGTM from @jekyll/core" or "1 LGTM from @jekyll/security when
+// labeled security".
+type Rule struct {
+	// Team whose members' LGTMs count towards this rule, e.g. "@jekyll/core".
+	// If empty, any maintainer's LGTM counts.
+	Team string
+	// Count is the minimum number of LGTMs required.
+	Count int
+	// Label, if set, means the rule only applies to PRs with this label.
+	Label string
+}
+
+func (r Rule) String() string {
+	var description string
+	if r.Team == "" {
+		description = fmt.Sprintf("%d from any maintainer", r.Count)
+	} else {
+		description = fmt.Sprintf("%d from %s", r.Count, r.Team)
+	}
+	if r.Label != "" {
+		description += fmt.Sprintf(" when labeled %q", r.Label)
+	}
+	return description
+}
+
+// teamSlug splits the team into its org and slug.
+func (r Rule) teamSlug() (org, slug string, ok bool) {
+	pieces := strings.SplitN(strings.TrimPrefix(r.Team, "@"), "/", 2)
+	if len(pieces) != 2 {
+		return "", "", false
+	}
+	return pieces[0], pieces[1], true
+}
+
+func (r Rule) appliesTo(labels []string) bool {
+	if r.Label == "" {
+		return true
+	}
+	for _, label := range labels {
+		if strings.EqualFold(label, r.Label) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleResult is the evaluation of a Rule against a PR's LGTMers.
+type ruleResult struct {
+	Rule      Rule
+	Approvers []string
+}
+
+func (r ruleResult) Satisfied() bool {
+	return len(r.Approvers) >= r.Rule.Count
+}
+
+func (r ruleResult) Remaining() int {
+	if r.Satisfied() {
+		return 0
+	}
+	return r.Rule.Count - len(r.Approvers)
+}
+
+// shortDescription describes what's still needed to satisfy the rule,
+// without any "@" so it isn't mistaken for an LGTMer when parsed.
+func (r ruleResult) shortDescription() string {
+	who := "maintainers"
+	if r.Rule.Team != "" {
+		who = strings.TrimPrefix(r.Rule.Team, "@")
+	}
+	return fmt.Sprintf("%d more from %s", r.Remaining(), who)
+}
+
+// evaluateRules checks each of the repo's rules which apply to the PR.
+func evaluateRules(context *ctx.Context, ref prRef, lgtmers []string) ([]ruleResult, error) {
+	if len(ref.Repo.Rules) == 0 {
+		return nil, nil
+	}
+
+	labels, _, err := context.GitHub.Issues.ListLabelsByIssue(
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, ref.Number, nil)
+	if err != nil {
+		return nil, err
+	}
+	labelNames := []string{}
+	for _, label := range labels {
+		labelNames = append(labelNames, label.GetName())
+	}
+
+	results := []ruleResult{}
+	for _, rule := range ref.Repo.Rules {
+		if !rule.appliesTo(labelNames) {
+			continue
+		}
+		result := ruleResult{Rule: rule, Approvers: []string{}}
+		for _, lgtmer := range lgtmers {
+			if isRuleApprover(context, rule, lgtmer) {
+				result.Approvers = append(result.Approvers, lgtmer)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func isRuleApprover(context *ctx.Context, rule Rule, lgtmer string) bool {
+	if rule.Team == "" {
+		return true
+	}
+	org, slug, ok := rule.teamSlug()
+	if !ok {
+		return false
+	}
+	return auth.UserIsTeamMember(context, org, slug, strings.TrimPrefix(lgtmer, "@"))
+}
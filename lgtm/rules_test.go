@@ -0,0 +1,145 @@
+package lgtm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleString(t *testing.T) {
+	assert.Equal(t, "2 from any maintainer", Rule{Count: 2}.String())
+	assert.Equal(t, "1 from @jekyll/core", Rule{Team: "@jekyll/core", Count: 1}.String())
+	assert.Equal(t, `1 from @jekyll/security when labeled "security"`,
+		Rule{Team: "@jekyll/security", Count: 1, Label: "security"}.String())
+}
+
+func TestRuleAppliesTo(t *testing.T) {
+	assert.True(t, Rule{}.appliesTo(nil))
+	assert.True(t, Rule{Label: "security"}.appliesTo([]string{"bug", "Security"}))
+	assert.False(t, Rule{Label: "security"}.appliesTo([]string{"bug"}))
+}
+
+func TestAddRule(t *testing.T) {
+	handler := &Handler{}
+	handler.AddRepo("o", "r", 2)
+	assert.Error(t, handler.AddRule("o", "nope", Rule{Count: 1}))
+	assert.Error(t, handler.AddRule("o", "r", Rule{Team: "core", Count: 1}))
+	assert.NoError(t, handler.AddRule("o", "r", Rule{Team: "@o/core", Count: 1}))
+	assert.Equal(t, []Rule{{Team: "@o/core", Count: 1}}, handler.newPRRef("o", "r", 1).Repo.Rules)
+}
+
+func TestEvaluateRules(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+
+	mux.HandleFunc(fmt.Sprintf("/repos/o/r/issues/%d/labels", ref.Number), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name":"bug"}]`)
+	})
+	mux.HandleFunc("/orgs/core-org/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":42,"slug":"core"},{"id":43,"slug":"security"}]`)
+	})
+	mux.HandleFunc("/teams/42/members/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/teams/42/members/parkr" {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	testRef := ref
+	testRef.Repo.Rules = []Rule{
+		{Count: 2},
+		{Team: "@core-org/core", Count: 1},
+		{Team: "@core-org/core", Count: 2},
+		{Team: "@core-org/security", Count: 1, Label: "security"},
+	}
+	results, err := evaluateRules(context, testRef, []string{"@parkr", "@envygeeks"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ruleResult{
+		{Rule: testRef.Repo.Rules[0], Approvers: []string{"@parkr", "@envygeeks"}},
+		{Rule: testRef.Repo.Rules[1], Approvers: []string{"@parkr"}},
+		{Rule: testRef.Repo.Rules[2], Approvers: []string{"@parkr"}},
+	}, results)
+	assert.True(t, results[0].Satisfied())
+	assert.True(t, results[1].Satisfied())
+	assert.False(t, results[2].Satisfied())
+	assert.Equal(t, 1, results[2].Remaining())
+}
+
+func TestNewDescriptionWithRules(t *testing.T) {
+	unmet := ruleResult{Rule: Rule{Team: "@jekyll/core", Count: 1}, Approvers: []string{}}
+	met := ruleResult{Rule: Rule{Count: 1}, Approvers: []string{"@parkr"}}
+
+	info := statusInfo{lgtmers: []string{"@parkr"}, quorum: 1, ruleResults: []ruleResult{met, unmet}}
+	assert.Equal(t, "pending", info.newState())
+	assert.Equal(t, "Approved by @parkr. Needs 1 more from jekyll/core.", info.newDescription())
+
+	info = statusInfo{lgtmers: []string{}, quorum: 0, ruleResults: []ruleResult{unmet}}
+	assert.Equal(t, "Awaiting approval. Needs 1 more from jekyll/core.", info.newDescription())
+
+	info = statusInfo{lgtmers: []string{"@parkr"}, quorum: 1, ruleResults: []ruleResult{met}}
+	assert.Equal(t, "success", info.newState())
+	assert.Equal(t, "Approved by @parkr.", info.newDescription())
+}
+
+func TestStatusPageHandler(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	handler := &Handler{}
+	handler.AddRepo("o", "r", 1)
+	assert.NoError(t, handler.AddRule("o", "r", Rule{Count: 2}))
+
+	// After a restart, only the store knows the status, including the rule
+	// results, so GitHub isn't asked for anything.
+	store := newTestStore()
+	assert.NoError(t, store.Put(newStoreKey(ref, ""), &Record{
+		SHA: prSHA, Lgtmers: []string{"@parkr"}, Quorum: 1,
+		RuleResults: []ruleResult{{Rule: Rule{Count: 2}, Approvers: []string{"@parkr"}}},
+	}))
+	handler.SetStore(store)
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.StatusPageHandler(context).ServeHTTP(recorder, httptest.NewRequest("GET", "/o/r/273", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "<strong>pending</strong>: Approved by @parkr. Needs 1 more from maintainers.")
+	assert.Contains(t, recorder.Body.String(), "<td>2 from any maintainer</td>")
+	assert.Contains(t, recorder.Body.String(), "no, needs 1 more")
+
+	recorder = httptest.NewRecorder()
+	handler.StatusPageHandler(context).ServeHTTP(recorder, httptest.NewRequest("GET", "/o/r/1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "No LGTM status is known")
+
+	recorder = httptest.NewRecorder()
+	handler.StatusPageHandler(context).ServeHTTP(recorder, httptest.NewRequest("GET", "/other/r/1", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := &rateLimiter{limit: 2}
+	assert.True(t, limiter.allow(now))
+	assert.True(t, limiter.allow(now.Add(time.Second)))
+	assert.False(t, limiter.allow(now.Add(2*time.Second)))
+	assert.True(t, limiter.allow(now.Add(time.Minute)))
+}
+
+func TestNewPRRefTargetURL(t *testing.T) {
+	handler := &Handler{}
+	handler.AddRepo("o", "r", 1)
+	assert.Equal(t, "", handler.newPRRef("o", "r", 1).targetURL)
+	handler.SetStatusPageURL("https://bot.example.com/lgtm/")
+	assert.Equal(t, "https://bot.example.com/lgtm/o/r/1", handler.newPRRef("o", "r", 1).targetURL)
+}
@@ -19,13 +19,55 @@ func lgtmContext(owner string) string {
 	return owner + "/lgtm"
 }
 
-func setStatus(context *ctx.Context, ref prRef, sha string, status *statusInfo) error {
+// evaluateRequirements fills in the code owners and rules which the status's
+// LGTMers don't yet satisfy.
+func evaluateRequirements(context *ctx.Context, ref prRef, status *statusInfo) error {
+	if ref.Repo.RequireCodeOwners {
+		missingOwners, err := missingCodeOwners(context, ref, status)
+		if err != nil {
+			return err
+		}
+		status.missingOwners = missingOwners
+	}
+
+	ruleResults, err := evaluateRules(context, ref, status.lgtmers)
+	if err != nil {
+		return err
+	}
+	status.ruleResults = ruleResults
+	return nil
+}
+
+func setStatus(context *ctx.Context, store Store, ref prRef, sha string, status *statusInfo) error {
+	if err := evaluateRequirements(context, ref, status); err != nil {
+		return err
+	}
+
+	repoStatus := status.NewRepoStatus(ref.Repo.Owner)
+	if ref.targetURL != "" {
+		repoStatus.TargetURL = github.String(ref.targetURL)
+	}
 	_, _, err := context.GitHub.Repositories.CreateStatus(
-		context.Context(), ref.Repo.Owner, ref.Repo.Name, sha, status.NewRepoStatus(ref.Repo.Owner))
+		context.Context(), ref.Repo.Owner, ref.Repo.Name, sha, repoStatus)
 	if err != nil {
 		return err
 	}
 
+	if ref.checkRuns {
+		// The status has been set, so a failure here isn't fatal.
+		if err := publishCheckRun(context, ref, sha, status); err != nil {
+			context.Log("lgtm.setStatus: couldn't publish check run for %s at %s: %v", ref, sha, err)
+		}
+	}
+
+	if store != nil {
+		record := newRecord(status)
+		record.SHA = sha
+		if err := store.Put(newStoreKey(ref, sha), record); err != nil {
+			context.Log("lgtm.setStatus: couldn't persist status for %s at %s: %v", ref, sha, err)
+		}
+	}
+
 	statusCache.Lock()
 	statusCache.data[ref.String()] = status
 	statusCache.Unlock()
@@ -33,7 +75,11 @@ func setStatus(context *ctx.Context, ref prRef, sha string, status *statusInfo)
 	return nil
 }
 
-func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
+// getStatus fetches the LGTM state of the PR's head SHA. It checks the
+// in-memory cache, then the store (if any). When a store is configured but has
+// no entry, the state is reconciled from the PR's comments and reviews.
+// Without a store, the state is parsed from the existing commit status.
+func getStatus(context *ctx.Context, store Store, ref prRef) (*statusInfo, error) {
 	statusCache.Lock()
 	cachedStatus, ok := statusCache.data[ref.String()]
 	statusCache.Unlock()
@@ -46,6 +92,10 @@ func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
 		return nil, err
 	}
 
+	if store != nil {
+		return getStatusFromStore(context, store, ref, pr)
+	}
+
 	statuses, _, err := context.GitHub.Repositories.ListStatuses(context.Context(), ref.Repo.Owner, ref.Repo.Name, *pr.Head.SHA, nil)
 	if err != nil {
 		return nil, err
@@ -67,7 +117,7 @@ func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
 	if preExistingStatus == nil {
 		preExistingStatus = newEmptyStatus(ref.Repo.Owner, ref.Repo.Quorum)
 		info = parseStatus(*pr.Head.SHA, preExistingStatus)
-		err := setStatus(context, ref, *pr.Head.SHA, info)
+		err := setStatus(context, store, ref, *pr.Head.SHA, info)
 		if err != nil {
 			fmt.Printf("getStatus: couldn't save new empty status to %s for %s: %v\n", ref, *pr.Head.SHA, err)
 		}
@@ -84,6 +134,62 @@ func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
 	return info, nil
 }
 
+func getStatusFromStore(context *ctx.Context, store Store, ref prRef, pr *github.PullRequest) (*statusInfo, error) {
+	sha := pr.GetHead().GetSHA()
+	record, err := store.Get(newStoreKey(ref, sha))
+	if err != nil {
+		return nil, err
+	}
+
+	var info *statusInfo
+	if record != nil {
+		info = record.statusInfo(sha)
+	} else {
+		info, err = reconcile(context, ref, pr, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := setStatus(context, store, ref, sha, info); err != nil {
+			context.Log("getStatus: couldn't save reconciled status to %s for %s: %v", ref, sha, err)
+		}
+	}
+
+	if ref.Repo.Quorum != 0 {
+		info.quorum = ref.Repo.Quorum
+	}
+
+	statusCache.Lock()
+	statusCache.data[ref.String()] = info
+	statusCache.Unlock()
+
+	return info, nil
+}
+
+// getLatestStatus returns the most recently set LGTM state of the PR, no
+// matter which SHA it was set for. It returns nil if none is known.
+func getLatestStatus(context *ctx.Context, store Store, ref prRef) *statusInfo {
+	statusCache.Lock()
+	cachedStatus, ok := statusCache.data[ref.String()]
+	statusCache.Unlock()
+	if ok && cachedStatus != nil {
+		return cachedStatus
+	}
+
+	if store == nil {
+		return nil
+	}
+
+	record, err := store.Get(newStoreKey(ref, ""))
+	if err != nil {
+		context.Log("lgtm.getLatestStatus: couldn't read latest status for %s: %v", ref, err)
+		return nil
+	}
+	if record == nil {
+		return nil
+	}
+	return record.statusInfo(record.SHA)
+}
+
 func newEmptyStatus(owner string, quorum int) *github.RepoStatus {
 	return &github.RepoStatus{
 		Context:     github.String(lgtmContext(owner)),
@@ -52,7 +52,7 @@ func TestGetStatusInCache(t *testing.T) {
 	statusCache = statusMap{data: make(map[string]*statusInfo)}
 	statusCache.data[ref.String()] = expectedInfo
 
-	info, err := getStatus(context, ref)
+	info, err := getStatus(context, nil, ref)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedInfo, info)
@@ -71,7 +71,7 @@ func TestGetStatusAPIPRError(t *testing.T) {
 		http.Error(w, "huh?", http.StatusNotFound)
 	})
 
-	info, err := getStatus(context, ref)
+	info, err := getStatus(context, nil, ref)
 
 	assert.True(t, prHandled, "the PR API endpoint should be hit")
 	assert.Error(t, err)
@@ -105,7 +105,7 @@ func TestGetStatusAPIStatusesError(t *testing.T) {
 		http.Error(w, "huh?", http.StatusNotFound)
 	})
 
-	info, err := getStatus(context, ref)
+	info, err := getStatus(context, nil, ref)
 
 	assert.True(t, prHandled, "the PR API endpoint should be hit")
 	assert.True(t, statusesHandled, "the Statuses API endpoint should be hit")
@@ -142,7 +142,7 @@ func TestGetStatusAPIStatusesNoneMatch(t *testing.T) {
 		statusesHandled = true
 	})
 
-	info, err := getStatus(context, ref)
+	info, err := getStatus(context, nil, ref)
 
 	expectedStatus := &statusInfo{
 		lgtmers: []string{},
@@ -191,7 +191,7 @@ func TestGetStatusFromAPI(t *testing.T) {
 		statusesHandled = true
 	})
 
-	info, err := getStatus(context, ref)
+	info, err := getStatus(context, nil, ref)
 
 	expectedStatus := &statusInfo{
 		lgtmers: []string{"@parkr", "@envygeeks", "@mattr-"},
@@ -238,6 +238,7 @@ func TestSetStatus(t *testing.T) {
 
 	assert.NoError(t, setStatus(
 		context,
+		nil,
 		ref,
 		prSHA,
 		newStatus,
@@ -268,6 +269,7 @@ func TestSetStatusHTTPError(t *testing.T) {
 
 	assert.Error(t, setStatus(
 		context,
+		nil,
 		ref,
 		prSHA,
 		newStatus,
@@ -17,6 +17,24 @@ type statusInfo struct {
 	quorum     int
 	sha        string
 	repoStatus *github.RepoStatus
+
+	// note explains why approvals were or weren't carried over from a
+	// previous commit. It's appended to the description, which shortens the
+	// rest to make room, and is always shown by the check run and status page.
+	note string
+
+	// carriedFrom is the previous head whose approvals were carried over.
+	carriedFrom string
+
+	// missingOwners lists the CODEOWNERS entries which haven't approved yet.
+	missingOwners []string
+
+	// ruleResults is the evaluation of the repo's approval rules.
+	ruleResults []ruleResult
+
+	// approvalURLs links each LGTMer (keyed by lowercase login, without the
+	// "@") to the comment or review in which they approved, if known.
+	approvalURLs map[string]string
 }
 
 func parseStatus(sha string, repoStatus *github.RepoStatus) *statusInfo {
@@ -55,18 +73,58 @@ func parseStatus(sha string, repoStatus *github.RepoStatus) *statusInfo {
 }
 
 func (s statusInfo) IsLGTMer(username string) bool {
-	lowerUsername := strings.ToLower(username)
 	for _, lgtmer := range s.lgtmers {
-		lowerLgtmer := strings.ToLower(lgtmer)
-		if lowerLgtmer == lowerUsername || lowerLgtmer == "@"+lowerUsername {
+		if isSameLGTMer(lgtmer, username) {
 			return true
 		}
 	}
 	return false
 }
 
+// isSameLGTMer compares an "@"-prefixed LGTMer with a username, which may or
+// may not be prefixed with "@".
+func isSameLGTMer(lgtmer, username string) bool {
+	lowerUsername := strings.ToLower(username)
+	lowerLgtmer := strings.ToLower(lgtmer)
+	return lowerLgtmer == lowerUsername || lowerLgtmer == "@"+lowerUsername
+}
+
+// addLGTMer adds the user to the list of LGTMers, remembering the URL of
+// their approval if there is one.
+func (s *statusInfo) addLGTMer(username, approvalURL string) {
+	s.lgtmers = append(s.lgtmers, "@"+strings.TrimPrefix(username, "@"))
+	if approvalURL == "" {
+		return
+	}
+	if s.approvalURLs == nil {
+		s.approvalURLs = map[string]string{}
+	}
+	s.approvalURLs[approvalKey(username)] = approvalURL
+}
+
+// removeLGTMer removes the user from the list of LGTMers.
+func (s *statusInfo) removeLGTMer(username string) {
+	lgtmers := []string{}
+	for _, lgtmer := range s.lgtmers {
+		if !isSameLGTMer(lgtmer, username) {
+			lgtmers = append(lgtmers, lgtmer)
+		}
+	}
+	s.lgtmers = lgtmers
+	delete(s.approvalURLs, approvalKey(username))
+}
+
+// approvalURL returns the URL of the LGTMer's approval, or "" if unknown.
+func (s statusInfo) approvalURL(lgtmer string) string {
+	return s.approvalURLs[approvalKey(lgtmer)]
+}
+
+func approvalKey(username string) string {
+	return strings.ToLower(strings.TrimPrefix(username, "@"))
+}
+
 func (s statusInfo) newState() string {
-	if len(s.lgtmers) >= s.quorum {
+	if len(s.lgtmers) >= s.quorum && len(s.missingOwners) == 0 && len(s.unsatisfiedRules()) == 0 {
 		return "success"
 	}
 	return "pending"
@@ -75,8 +133,34 @@ func (s statusInfo) newState() string {
 // newDescription produces the LGTM status description based on the LGTMers
 // and quorum values specified for this statusInfo.
 func (s statusInfo) newDescription() string {
+	reserved := 0
+	if s.note != "" {
+		reserved = len(s.note) + 1
+	}
+
+	description := s.newApprovalDescription()
+	if ownersDesc := s.newMissingOwnersDescription(len(description) + 1 + reserved); ownersDesc != "" {
+		description += " " + ownersDesc
+	}
+	if rulesDesc := s.newUnsatisfiedRulesDescription(len(description) + 1 + reserved); rulesDesc != "" {
+		description += " " + rulesDesc
+	}
+	if s.note != "" && len(description)+1+len(s.note) <= 140 {
+		description += " " + s.note
+	}
+	return description
+}
+
+func (s statusInfo) newApprovalDescription() string {
 	if s.quorum == 0 {
-		return "No approval is required."
+		outstanding := len(s.missingOwners) > 0 || len(s.unsatisfiedRules()) > 0
+		if outstanding && len(s.lgtmers) == 0 {
+			return "Awaiting approval."
+		}
+		if !outstanding {
+			return "No approval is required."
+		}
+		return s.newApprovedByDescription()
 	}
 
 	if len(s.lgtmers) == 0 {
@@ -94,6 +178,57 @@ func (s statusInfo) newDescription() string {
 	}
 }
 
+// newMissingOwnersDescription lists the missing code owners, or just counts
+// them if the list won't fit in the remaining space. Owners are listed
+// without their "@" so they aren't mistaken for LGTMers when parsed.
+func (s statusInfo) newMissingOwnersDescription(used int) string {
+	if len(s.missingOwners) == 0 {
+		return ""
+	}
+
+	owners := strings.Replace(strings.Join(s.missingOwners, ", "), "@", "", -1)
+	description := fmt.Sprintf("Missing code owners: %s.", owners)
+	if used+len(description) <= 140 {
+		return description
+	}
+	if len(s.missingOwners) == 1 {
+		return "Missing 1 code owner."
+	}
+	return fmt.Sprintf("Missing %d code owners.", len(s.missingOwners))
+}
+
+func (s statusInfo) unsatisfiedRules() []ruleResult {
+	unsatisfied := []ruleResult{}
+	for _, result := range s.ruleResults {
+		if !result.Satisfied() {
+			unsatisfied = append(unsatisfied, result)
+		}
+	}
+	return unsatisfied
+}
+
+// newUnsatisfiedRulesDescription describes what the unsatisfied rules still
+// need, or just counts them if that won't fit in the remaining space.
+func (s statusInfo) newUnsatisfiedRulesDescription(used int) string {
+	unsatisfied := s.unsatisfiedRules()
+	if len(unsatisfied) == 0 {
+		return ""
+	}
+
+	needs := []string{}
+	for _, result := range unsatisfied {
+		needs = append(needs, result.shortDescription())
+	}
+	description := fmt.Sprintf("Needs %s.", strings.Join(needs, ", "))
+	if used+len(description) <= 140 {
+		return description
+	}
+	if len(unsatisfied) == 1 {
+		return "1 approval rule unmet."
+	}
+	return fmt.Sprintf("%d approval rules unmet.", len(unsatisfied))
+}
+
 func (s statusInfo) newLGTMsRequiredDescription() string {
 	remaining := s.quorum - len(s.lgtmers)
 
@@ -2,6 +2,7 @@ package lgtm
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-github/github"
@@ -57,6 +58,26 @@ func TestStatusInfoIsLGTMer(t *testing.T) {
 	}
 }
 
+func TestStatusInfoRemoveLGTMer(t *testing.T) {
+	cases := []struct {
+		lgtmers  []string
+		removed  string
+		expected []string
+	}{
+		{[]string{}, "parkr", []string{}},
+		{[]string{"@parkr"}, "parkr", []string{}},
+		{[]string{"@parkr"}, "@PARKR", []string{}},
+		{[]string{"@parkr", "@mattr-"}, "mattr-", []string{"@parkr"}},
+		{[]string{"@parkr", "@mattr-"}, "parkr-", []string{"@parkr", "@mattr-"}},
+	}
+	for _, test := range cases {
+		info := &statusInfo{lgtmers: test.lgtmers}
+		info.removeLGTMer(test.removed)
+		assert.Equal(t, test.expected, info.lgtmers,
+			fmt.Sprintf("removing %q from lgtmers: %q", test.removed, test.lgtmers))
+	}
+}
+
 func TestNewState(t *testing.T) {
 	cases := []struct {
 		lgtmers  []string
@@ -102,6 +123,46 @@ func TestNewDescription(t *testing.T) {
 	}
 }
 
+func TestNewDescriptionWithNote(t *testing.T) {
+	info := statusInfo{lgtmers: []string{"@parkr"}, quorum: 2, note: "Kept after rebase."}
+	assert.Equal(t, "Approved by @parkr. Requires 1 more LGTM. Kept after rebase.", info.newDescription())
+
+	info = statusInfo{lgtmers: []string{"@parkr"}, quorum: 1, note: strings.Repeat("x", 130)}
+	assert.Equal(t, "Approved by @parkr.", info.newDescription())
+
+	// The missing owners are counted rather than listed to make room.
+	info = statusInfo{
+		lgtmers:       []string{"@parkr"},
+		quorum:        1,
+		missingOwners: []string{"@jekyll/documentation", "@jekyll/performance", "@jekyll/stability", "@jekyll/windows"},
+		note:          "Kept: only allow-listed paths changed.",
+	}
+	assert.Equal(t, "Approved by @parkr. Missing 4 code owners. Kept: only allow-listed paths changed.", info.newDescription())
+}
+
+func TestNewDescriptionWithMissingOwners(t *testing.T) {
+	cases := []struct {
+		lgtmers       []string
+		quorum        int
+		missingOwners []string
+		state         string
+		description   string
+	}{
+		{nil, 0, []string{"@jekyll/build"}, "pending", "Awaiting approval. Missing code owners: jekyll/build."},
+		{[]string{"@parkr"}, 0, []string{"@jekyll/build"}, "pending", "Approved by @parkr. Missing code owners: jekyll/build."},
+		{[]string{"@parkr"}, 1, []string{"@jekyll/build", "@envygeeks or @mattr-"}, "pending", "Approved by @parkr. Missing code owners: jekyll/build, envygeeks or mattr-."},
+		{[]string{"@parkr"}, 2, []string{}, "pending", "Approved by @parkr. Requires 1 more LGTM."},
+		{[]string{"@parkr"}, 1, []string{}, "success", "Approved by @parkr."},
+		{[]string{"@parkr"}, 1, []string{strings.Repeat("@a", 50), strings.Repeat("@b", 50)}, "pending", "Approved by @parkr. Missing 2 code owners."},
+	}
+	for _, test := range cases {
+		info := statusInfo{lgtmers: test.lgtmers, quorum: test.quorum, missingOwners: test.missingOwners}
+		assert.Equal(t, test.state, info.newState())
+		assert.Equal(t, test.description, info.newDescription())
+		assert.True(t, len(info.newDescription()) <= 140, fmt.Sprintf("%q must be <= 140 chars.", info.newDescription()))
+	}
+}
+
 func TestLGTMsRequiredDescription(t *testing.T) {
 	cases := []struct {
 		lgtmers  []string
@@ -0,0 +1,133 @@
+package lgtm
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parkr/auto-reply/ctx"
+)
+
+var statusPageTemplate = template.Must(template.New("statusPage").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>LGTM status for {{.Ref}}</title></head>
+<body>
+<h1>LGTM status for <a href="https://github.com/{{.Ref.Repo.Owner}}/{{.Ref.Repo.Name}}/pull/{{.Ref.Number}}">{{.Ref}}</a></h1>
+{{with .Info}}
+<p><strong>{{.State}}</strong>: {{.Description}}</p>
+<p>Commit: <code>{{.SHA}}</code></p>
+{{if .Note}}<p>{{.Note}}</p>{{end}}
+<h2>Approvals</h2>
+{{if .LGTMers}}<ul>{{range .LGTMers}}<li>{{.}}</li>{{end}}</ul>{{else}}<p>No approvals yet.</p>{{end}}
+<p>Total required: {{.Quorum}}</p>
+{{if .MissingOwners}}
+<h2>Missing code owners</h2>
+<ul>{{range .MissingOwners}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+{{if .RuleResults}}
+<h2>Rules</h2>
+<table>
+<tr><th>Rule</th><th>Approved by</th><th>Satisfied?</th></tr>
+{{range .RuleResults}}<tr><td>{{.Rule}}</td><td>{{range .Approvers}}{{.}} {{end}}</td><td>{{if .Satisfied}}yes{{else}}no, needs {{.Remaining}} more{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{else}}
+<p>No LGTM status is known for this pull request.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// statusPageRateLimit is how many status pages are served a minute.
+const statusPageRateLimit = 60
+
+// rateLimiter allows a limited number of requests a minute.
+type rateLimiter struct {
+	sync.Mutex  // protects 'windowStart' and 'count'
+	limit       int
+	windowStart time.Time
+	count       int
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.windowStart) >= time.Minute {
+		l.windowStart, l.count = now, 0
+	}
+	if l.count >= l.limit {
+		return false
+	}
+	l.count++
+	return true
+}
+
+type statusPage struct {
+	Ref  prRef
+	Info *statusPageInfo
+}
+
+// statusPageInfo exposes a statusInfo to the status page template.
+type statusPageInfo struct {
+	SHA           string
+	LGTMers       []string
+	Quorum        int
+	MissingOwners []string
+	RuleResults   []ruleResult
+	State         string
+	Description   string
+	Note          string
+}
+
+// StatusPageHandler serves a breakdown of the LGTM status for a PR at
+// /<owner>/<name>/<number>. Mount it at the URL given to SetStatusPageURL.
+// It's public, so it only serves what's in memory or the store and never
+// calls the GitHub API. Without a store, statuses set before the last
+// restart aren't known.
+func (h *Handler) StatusPageHandler(context *ctx.Context) http.Handler {
+	limiter := &rateLimiter{limit: statusPageRateLimit}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.allow(time.Now()) {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		pieces := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pieces) != 3 {
+			http.NotFound(w, r)
+			return
+		}
+		number, err := strconv.Atoi(pieces[2])
+		if err != nil || !h.isEnabledFor(pieces[0], pieces[1]) {
+			http.NotFound(w, r)
+			return
+		}
+
+		ref := h.newPRRef(pieces[0], pieces[1], number)
+		page := statusPage{Ref: ref}
+		if info := getLatestStatus(context, h.store, ref); info != nil {
+			page.Info = newStatusPageInfo(info)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPageTemplate.Execute(w, page); err != nil {
+			context.Log("lgtm.StatusPageHandler: couldn't render status page for %s: %v", ref, err)
+		}
+	})
+}
+
+func newStatusPageInfo(info *statusInfo) *statusPageInfo {
+	return &statusPageInfo{
+		SHA:           info.sha,
+		LGTMers:       info.lgtmers,
+		Quorum:        info.quorum,
+		MissingOwners: info.missingOwners,
+		RuleResults:   info.ruleResults,
+		State:         info.newState(),
+		Description:   info.newDescription(),
+		Note:          info.note,
+	}
+}
@@ -0,0 +1,273 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storeLockTimeout is how long to wait for another process to finish writing
+// the store file, and how old a lock must be to be considered abandoned.
+const storeLockTimeout = 5 * time.Second
+
+// StoreKey identifies the LGTM state of a pull request at a given head SHA.
+// A StoreKey with an empty SHA refers to the most recently stored state of
+// the pull request, whatever its head SHA was.
+type StoreKey struct {
+	Owner, Name string
+	Number      int
+	SHA         string
+}
+
+func (k StoreKey) String() string {
+	return fmt.Sprintf("%s/%s#%d@%s", k.Owner, k.Name, k.Number, k.SHA)
+}
+
+// prPrefix is the start of the String of every key of the PR.
+func (k StoreKey) prPrefix() string {
+	return fmt.Sprintf("%s/%s#%d@", k.Owner, k.Name, k.Number)
+}
+
+// Record is the persisted LGTM state for a pull request's head SHA.
+type Record struct {
+	SHA     string   `json:"sha,omitempty"`
+	Lgtmers []string `json:"lgtmers"`
+	Quorum  int      `json:"quorum"`
+	Note    string   `json:"note,omitempty"`
+
+	// CarriedFrom is the previous head SHA whose approvals were carried over.
+	CarriedFrom string `json:"carried_from,omitempty"`
+
+	// ApprovalURLs maps each LGTMer's lowercase login to their approval.
+	ApprovalURLs map[string]string `json:"approval_urls,omitempty"`
+
+	// MissingOwners and RuleResults are the requirements as they were when
+	// the status was set, for the status page.
+	MissingOwners []string     `json:"missing_owners,omitempty"`
+	RuleResults   []ruleResult `json:"rule_results,omitempty"`
+}
+
+// Store persists LGTM state so it doesn't have to be parsed back out of the
+// commit status description. Get returns a nil Record if there is no entry.
+type Store interface {
+	Get(key StoreKey) (*Record, error)
+	// Put stores the record for the key's SHA and as the PR's latest record.
+	// Records of the PR's other SHAs may be pruned, other than the one the
+	// record's approvals were carried from.
+	Put(key StoreKey, record *Record) error
+	// Delete forgets every record of the PR, e.g. once it's closed.
+	Delete(owner, name string, number int) error
+}
+
+func newStoreKey(ref prRef, sha string) StoreKey {
+	return StoreKey{Owner: ref.Repo.Owner, Name: ref.Repo.Name, Number: ref.Number, SHA: sha}
+}
+
+func newRecord(info *statusInfo) *Record {
+	lgtmers := make([]string, len(info.lgtmers))
+	copy(lgtmers, info.lgtmers)
+	return &Record{
+		SHA:           info.sha,
+		Lgtmers:       lgtmers,
+		Quorum:        info.quorum,
+		Note:          info.note,
+		CarriedFrom:   info.carriedFrom,
+		ApprovalURLs:  copyApprovalURLs(info.approvalURLs),
+		MissingOwners: info.missingOwners,
+		RuleResults:   info.ruleResults,
+	}
+}
+
+func (r *Record) statusInfo(sha string) *statusInfo {
+	lgtmers := make([]string, len(r.Lgtmers))
+	copy(lgtmers, r.Lgtmers)
+	return &statusInfo{
+		lgtmers:       lgtmers,
+		quorum:        r.Quorum,
+		sha:           sha,
+		note:          r.Note,
+		carriedFrom:   r.CarriedFrom,
+		approvalURLs:  copyApprovalURLs(r.ApprovalURLs),
+		missingOwners: r.MissingOwners,
+		ruleResults:   r.RuleResults,
+	}
+}
+
+func copyApprovalURLs(approvalURLs map[string]string) map[string]string {
+	if approvalURLs == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(approvalURLs))
+	for login, url := range approvalURLs {
+		copied[login] = url
+	}
+	return copied
+}
+
+// fileStore is a Store which keeps all records in a single JSON file. Writes
+// are serialized with other processes through a lock file next to it.
+type fileStore struct {
+	sync.Mutex // protects 'records', 'modTime' and the file
+	path       string
+	records    map[string]*Record
+	// modTime and size are the file's when it was last read or written, so
+	// changes made by other processes are noticed.
+	modTime time.Time
+	size    int64
+}
+
+// NewFileStore returns a Store backed by the JSON file at path. The file is
+// created upon the first write if it does not already exist.
+func NewFileStore(path string) (Store, error) {
+	store := &fileStore{path: path, records: map[string]*Record{}}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *fileStore) Get(key StoreKey) (*Record, error) {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s.records[key.String()], nil
+}
+
+func (s *fileStore) Put(key StoreKey, record *Record) error {
+	return s.update(func() {
+		latest := StoreKey{Owner: key.Owner, Name: key.Name, Number: key.Number}
+		keep := map[string]bool{latest.String(): true, key.String(): true}
+		if record.CarriedFrom != "" {
+			carriedFrom := latest
+			carriedFrom.SHA = record.CarriedFrom
+			keep[carriedFrom.String()] = true
+		}
+		s.deletePR(key, keep)
+		s.records[key.String()] = record
+		s.records[latest.String()] = record
+	})
+}
+
+func (s *fileStore) Delete(owner, name string, number int) error {
+	return s.update(func() {
+		s.deletePR(StoreKey{Owner: owner, Name: name, Number: number}, nil)
+	})
+}
+
+// deletePR deletes the records of the key's PR, other than those kept.
+func (s *fileStore) deletePR(key StoreKey, keep map[string]bool) {
+	for k := range s.records {
+		if strings.HasPrefix(k, key.prPrefix()) && !keep[k] {
+			delete(s.records, k)
+		}
+	}
+}
+
+// update applies the change to the latest records while holding the lock
+// file, then writes them out.
+func (s *fileStore) update(change func()) error {
+	s.Lock()
+	defer s.Unlock()
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	change()
+	return s.write()
+}
+
+// load reads the file if it's changed since it was last read or written.
+func (s *fileStore) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	records := map[string]*Record{}
+	if len(contents) > 0 {
+		if err := json.Unmarshal(contents, &records); err != nil {
+			return fmt.Errorf("lgtm.NewFileStore: couldn't parse %s: %v", s.path, err)
+		}
+	}
+	s.records, s.modTime, s.size = records, info.ModTime(), info.Size()
+	return nil
+}
+
+func (s *fileStore) write() error {
+	contents, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so a crash never leaves a
+	// partially-written store behind.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// lockFile takes a lock shared with other processes by creating the file at
+// path, waiting for whoever holds it. A lock older than storeLockTimeout was
+// left behind by a process which died, and is taken over.
+func lockFile(path string) (unlock func(), err error) {
+	deadline := time.Now().Add(storeLockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > storeLockTimeout {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lgtm: timed out waiting for %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
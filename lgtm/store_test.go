@@ -0,0 +1,118 @@
+package lgtm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreKeyString(t *testing.T) {
+	key := StoreKey{Owner: "o", Name: "r", Number: 273, SHA: prSHA}
+	assert.Equal(t, "o/r#273@deadbeef0000000deadbeef", key.String())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lgtm-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lgtm.json")
+
+	store, err := NewFileStore(path)
+	assert.NoError(t, err)
+
+	key := newStoreKey(ref, prSHA)
+	record, err := store.Get(key)
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+
+	expected := &Record{Lgtmers: []string{"@parkr"}, Quorum: 2}
+	assert.NoError(t, store.Put(key, expected))
+
+	record, err = store.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, record)
+
+	// A new store for the same file should see the same records.
+	reopened, err := NewFileStore(path)
+	assert.NoError(t, err)
+	record, err = reopened.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, record)
+
+	// A different SHA has no entry.
+	record, err = reopened.Get(newStoreKey(ref, "abc123"))
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestFileStorePrunes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lgtm-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lgtm.json")
+
+	store, err := NewFileStore(path)
+	assert.NoError(t, err)
+
+	other := StoreKey{Owner: "o", Name: "r", Number: 2730, SHA: "abc"}
+	assert.NoError(t, store.Put(other, &Record{Quorum: 1}))
+	assert.NoError(t, store.Put(newStoreKey(ref, "first"), &Record{SHA: "first", Quorum: 1}))
+	assert.NoError(t, store.Put(newStoreKey(ref, "second"), &Record{SHA: "second", Quorum: 1}))
+	third := &Record{SHA: "third", Quorum: 1, CarriedFrom: "second"}
+	assert.NoError(t, store.Put(newStoreKey(ref, "third"), third))
+
+	// A second process sees the writes, which have replaced the superseded
+	// SHA other than the one approvals were carried from.
+	reopened, err := NewFileStore(path)
+	assert.NoError(t, err)
+	for sha, expected := range map[string]bool{"first": false, "second": true, "third": true, "": true} {
+		record, err := reopened.Get(newStoreKey(ref, sha))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, record != nil, "sha %q", sha)
+	}
+	latest, err := reopened.Get(newStoreKey(ref, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, third, latest)
+
+	// Closed PRs are forgotten, without touching other PRs.
+	assert.NoError(t, reopened.Delete("o", "r", 273))
+	record, err := store.Get(newStoreKey(ref, ""))
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+	record, err = store.Get(other)
+	assert.NoError(t, err)
+	assert.NotNil(t, record)
+
+	_, err = os.Stat(path + ".lock")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileStoreInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lgtm-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lgtm.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0644))
+
+	store, err := NewFileStore(path)
+	assert.Error(t, err)
+	assert.Nil(t, store)
+}
+
+func TestRecordStatusInfo(t *testing.T) {
+	info := &statusInfo{lgtmers: []string{"@parkr", "@envygeeks"}, quorum: 2, sha: prSHA}
+	record := newRecord(info)
+	assert.Equal(t, &Record{SHA: prSHA, Lgtmers: []string{"@parkr", "@envygeeks"}, Quorum: 2}, record)
+	assert.Equal(t, info, record.statusInfo(prSHA))
+}
+
+func TestRecordApprovalURLs(t *testing.T) {
+	info := &statusInfo{lgtmers: []string{}, quorum: 1, sha: prSHA}
+	info.addLGTMer("Parkr", "https://github.com/o/r/pull/273#issuecomment-1")
+	record := newRecord(info)
+	assert.Equal(t, map[string]string{"parkr": "https://github.com/o/r/pull/273#issuecomment-1"}, record.ApprovalURLs)
+	assert.Equal(t, "https://github.com/o/r/pull/273#issuecomment-1", record.statusInfo(prSHA).approvalURL("@parkr"))
+}
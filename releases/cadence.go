@@ -0,0 +1,67 @@
+package releases
+
+import (
+	"fmt"
+	"time"
+)
+
+// CadencePolicy decides when a repo is due a release.
+type CadencePolicy struct {
+	// MaxCommits is how many commits can land on the default branch before
+	// a release is due, however recent the latest release.
+	MaxCommits int
+	// MinCommits is how many commits need to land before a release is due
+	// because of its age.
+	MinCommits int
+	// MaxAge is how long after the latest release a release is due, once
+	// MinCommits have landed.
+	MaxAge time.Duration
+}
+
+// DefaultCadencePolicy applies to repos without their own policy: release
+// after 100 commits, or after three months with at least 3 commits. Use
+// SetDefaultCadencePolicy to change it.
+var DefaultCadencePolicy = CadencePolicy{MaxCommits: 100, MinCommits: 3, MaxAge: 90 * 24 * time.Hour}
+
+var cadencePolicies = map[string]CadencePolicy{}
+
+// SetDefaultCadencePolicy sets the policy of repos without their own.
+func SetDefaultCadencePolicy(policy CadencePolicy) error {
+	if !policy.valid() {
+		return fmt.Errorf("releases.SetDefaultCadencePolicy: needs a positive MaxCommits, MinCommits and MaxAge, got %+v", policy)
+	}
+	DefaultCadencePolicy = policy
+	return nil
+}
+
+// SetCadencePolicy sets the policy deciding when the repo is due a release.
+func SetCadencePolicy(owner, repo string, policy CadencePolicy) error {
+	if !policy.valid() {
+		return fmt.Errorf("releases.SetCadencePolicy: %s/%s needs a positive MaxCommits, MinCommits and MaxAge, got %+v", owner, repo, policy)
+	}
+	cadencePolicies[owner+"/"+repo] = policy
+	return nil
+}
+
+func (p CadencePolicy) valid() bool {
+	return p.MaxCommits > 0 && p.MinCommits > 0 && p.MaxAge > 0
+}
+
+// CadencePolicyFor returns the repo's policy.
+func CadencePolicyFor(owner, repo string) CadencePolicy {
+	if policy, ok := cadencePolicies[owner+"/"+repo]; ok {
+		return policy
+	}
+	return DefaultCadencePolicy
+}
+
+// Due returns true if a release made at releasedAt, with the number of
+// commits since, should be followed by another one now.
+func (p CadencePolicy) Due(commits int, releasedAt, now time.Time) bool {
+	return commits > p.MaxCommits || (commits >= p.MinCommits && now.Sub(releasedAt) >= p.MaxAge)
+}
+
+// MaxAgeDays is MaxAge in days, for describing the policy.
+func (p CadencePolicy) MaxAgeDays() int {
+	return int(p.MaxAge / (24 * time.Hour))
+}
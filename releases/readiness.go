@@ -0,0 +1,179 @@
+package releases
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/chlog"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/parkr/auto-reply/dependencies"
+	"github.com/parkr/auto-reply/jekyll"
+)
+
+// ReadinessReport describes how ready a repo is for its next release.
+type ReadinessReport struct {
+	Repo          jekyll.Repository
+	DefaultBranch string
+	LatestRelease *github.RepositoryRelease
+	// CommitsSinceRelease are on the default branch.
+	CommitsSinceRelease int
+
+	// UnreleasedChanges are the changelog's entries since the latest
+	// release, grouped by section, or empty if there are none.
+	UnreleasedChanges string
+	// Milestone is the open milestone of the next version, if any.
+	Milestone *github.Milestone
+	// MilestonePRs are the open PRs in the milestone.
+	MilestonePRs []*github.Issue
+	// CIState combines the statuses and check runs of the default branch
+	// into "success", "pending" or "failure", or is empty if nothing has
+	// reported on it.
+	CIState string
+	// OutdatedDependencies are the gem dependencies with newer versions
+	// than their constraints allow.
+	OutdatedDependencies []OutdatedDependency
+}
+
+// OutdatedDependency is a dependency with a newer version than its
+// constraint allows.
+type OutdatedDependency struct {
+	Name, Constraint, LatestVersion string
+}
+
+// Readiness gathers the repo's readiness report, relative to its latest
+// release, given its default branch and the commits on it since the
+// release. Parts which can't be fetched are logged and left empty.
+func Readiness(context *ctx.Context, repo jekyll.Repository, latestRelease *github.RepositoryRelease, branch string, commits int) (*ReadinessReport, error) {
+	report := &ReadinessReport{
+		Repo:                repo,
+		DefaultBranch:       branch,
+		LatestRelease:       latestRelease,
+		CommitsSinceRelease: commits,
+	}
+
+	var err error
+	report.UnreleasedChanges, err = chlog.UnreleasedChanges(context, repo.Owner(), repo.Name())
+	if err != nil {
+		context.Log("releases: couldn't read the unreleased changes of %s: %v", repo, err)
+	}
+	report.UnreleasedChanges = strings.TrimSpace(report.UnreleasedChanges)
+
+	report.Milestone, report.MilestonePRs, err = nextMilestonePRs(context, repo, latestRelease.GetTagName())
+	if err != nil {
+		context.Log("releases: couldn't list the next milestone's PRs of %s: %v", repo, err)
+	}
+
+	report.CIState, err = ciState(context, repo, branch)
+	if err != nil {
+		context.Log("releases: couldn't get the CI state of %s on %s: %v", branch, repo, err)
+	}
+
+	checker := dependencies.NewRubyDependencyChecker(repo.Owner(), repo.Name())
+	for _, dependency := range checker.AllOutdatedDependencies(context) {
+		outdated := OutdatedDependency{Name: dependency.GetName(), Constraint: dependency.GetConstraint().String()}
+		if latest := dependency.GetLatestVersion(context); latest != nil {
+			outdated.LatestVersion = latest.String()
+		}
+		report.OutdatedDependencies = append(report.OutdatedDependencies, outdated)
+	}
+
+	return report, nil
+}
+
+// ciState combines the branch's combined status with its check runs, so
+// repos using either are covered. A failure of either is a failure, and
+// anything still running is pending.
+func ciState(context *ctx.Context, repo jekyll.Repository, branch string) (string, error) {
+	status, _, err := context.GitHub.Repositories.GetCombinedStatus(context.Context(), repo.Owner(), repo.Name(), branch, nil)
+	if err != nil {
+		return "", err
+	}
+	checkRuns, _, err := context.GitHub.Checks.ListCheckRunsForRef(context.Context(), repo.Owner(), repo.Name(), branch,
+		&github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}})
+	if err != nil {
+		return "", err
+	}
+
+	states := []string{}
+	if status.GetTotalCount() > 0 {
+		states = append(states, status.GetState())
+	}
+	for _, checkRun := range checkRuns.CheckRuns {
+		if checkRun.GetStatus() != "completed" {
+			states = append(states, "pending")
+			continue
+		}
+		switch checkRun.GetConclusion() {
+		case "success", "neutral", "skipped":
+			states = append(states, "success")
+		default:
+			states = append(states, "failure")
+		}
+	}
+
+	state := ""
+	for _, s := range states {
+		switch {
+		case s == "failure" || s == "error":
+			return "failure", nil
+		case s == "pending":
+			state = "pending"
+		case state == "":
+			state = s
+		}
+	}
+	return state, nil
+}
+
+// DefaultBranch returns the repo's default branch.
+func DefaultBranch(context *ctx.Context, repo jekyll.Repository) (string, error) {
+	info, _, err := context.GitHub.Repositories.Get(context.Context(), repo.Owner(), repo.Name())
+	if err != nil {
+		return "", err
+	}
+	if info.GetDefaultBranch() == "" {
+		return "master", nil
+	}
+	return info.GetDefaultBranch(), nil
+}
+
+// nextMilestonePRs finds the open milestone with the lowest version after
+// the latest release, and its open PRs.
+func nextMilestonePRs(context *ctx.Context, repo jekyll.Repository, latestTag string) (*github.Milestone, []*github.Issue, error) {
+	milestones, _, err := context.GitHub.Issues.ListMilestones(context.Context(), repo.Owner(), repo.Name(), &github.MilestoneListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next := chlog.NextMilestone(latestTag, milestones)
+	if next == nil {
+		return nil, nil, nil
+	}
+
+	prs := []*github.Issue{}
+	opts := &github.IssueListByRepoOptions{
+		Milestone:   strconv.Itoa(next.GetNumber()),
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := context.GitHub.Issues.ListByRepo(context.Context(), repo.Owner(), repo.Name(), opts)
+		if err != nil {
+			return next, nil, err
+		}
+		for _, issue := range issues {
+			if issue.IsPullRequest() {
+				prs = append(prs, issue)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return next, prs, nil
+}
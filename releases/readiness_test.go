@@ -0,0 +1,123 @@
+package releases
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/auto-reply/ctx"
+	"github.com/parkr/auto-reply/jekyll"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCadencePolicyDue(t *testing.T) {
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy := DefaultCadencePolicy
+
+	assert.True(t, policy.Due(101, now.AddDate(0, 0, -1), now))
+	assert.False(t, policy.Due(100, now.AddDate(0, 0, -1), now))
+	assert.True(t, policy.Due(3, now.AddDate(0, 0, -90), now))
+	assert.False(t, policy.Due(2, now.AddDate(0, 0, -90), now))
+	assert.False(t, policy.Due(3, now.AddDate(0, 0, -89), now))
+	assert.Equal(t, 90, policy.MaxAgeDays())
+}
+
+func TestSetDefaultCadencePolicy(t *testing.T) {
+	defer func(policy CadencePolicy) { DefaultCadencePolicy = policy }(DefaultCadencePolicy)
+	own := CadencePolicy{MaxCommits: 20, MinCommits: 1, MaxAge: 7 * 24 * time.Hour}
+	assert.NoError(t, SetCadencePolicy("o", "own", own))
+
+	assert.Error(t, SetDefaultCadencePolicy(CadencePolicy{MaxCommits: 50}))
+	policy := CadencePolicy{MaxCommits: 50, MinCommits: 1, MaxAge: 30 * 24 * time.Hour}
+	assert.NoError(t, SetDefaultCadencePolicy(policy))
+	assert.Equal(t, policy, CadencePolicyFor("o", "default"))
+	assert.Equal(t, own, CadencePolicyFor("o", "own"))
+}
+
+func TestSetCadencePolicy(t *testing.T) {
+	assert.Error(t, SetCadencePolicy("o", "r", CadencePolicy{MaxCommits: 50}))
+	assert.Equal(t, DefaultCadencePolicy, CadencePolicyFor("o", "r"))
+
+	policy := CadencePolicy{MaxCommits: 50, MinCommits: 1, MaxAge: 30 * 24 * time.Hour}
+	assert.NoError(t, SetCadencePolicy("o", "r", policy))
+	assert.Equal(t, policy, CadencePolicyFor("o", "r"))
+}
+
+func TestReadiness(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/contents/History.markdown", func(w http.ResponseWriter, r *http.Request) {
+		history := "## HEAD\n\n### Bug Fixes\n\n  * Fix a bug (#3)\n\n## 1.1.0 / 2019-01-01\n\n  * Fix another bug (#2)\n"
+		fmt.Fprintf(w, `{"encoding": "base64", "content": %q}`, base64.StdEncoding.EncodeToString([]byte(history)))
+	})
+	mux.HandleFunc("/repos/o/r/milestones", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"number": 1, "title": "v1.0.0"}, {"number": 3, "title": "v2.0.0"}, {"number": 4, "title": "v1.2.0"}, {"number": 2, "title": "v1.2.0.rc1"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("milestone"))
+		fmt.Fprint(w, `[{"number": 4, "pull_request": {"url": "https://api.github.com/repos/o/r/pulls/4"}}, {"number": 5}]`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/main/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state": "failure", "total_count": 2}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/main/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"check_runs": [{"name": "test", "status": "completed", "conclusion": "success"}]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	context := &ctx.Context{GitHub: client}
+
+	report, err := Readiness(context, jekyll.NewRepository("o", "r"), &github.RepositoryRelease{TagName: github.String("v1.1.0")}, "main", 12)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "main", report.DefaultBranch)
+	assert.Equal(t, 12, report.CommitsSinceRelease)
+	assert.Equal(t, "### Bug Fixes\n\n  * Fix a bug (#3)", report.UnreleasedChanges)
+	// Pre-releases come before their release, as RubyGems orders them.
+	assert.Equal(t, "v1.2.0.rc1", report.Milestone.GetTitle())
+	if assert.Len(t, report.MilestonePRs, 1) {
+		assert.Equal(t, 4, report.MilestonePRs[0].GetNumber())
+	}
+	assert.Equal(t, "failure", report.CIState)
+	assert.Empty(t, report.OutdatedDependencies)
+}
+
+func TestCIState(t *testing.T) {
+	cases := []struct {
+		status, checkRuns string
+		state             string
+	}{
+		{`{"state": "pending", "total_count": 0}`, `[]`, ""},
+		{`{"state": "pending", "total_count": 0}`, `[{"status": "completed", "conclusion": "success"}]`, "success"},
+		{`{"state": "pending", "total_count": 0}`, `[{"status": "completed", "conclusion": "success"}, {"status": "in_progress"}]`, "pending"},
+		{`{"state": "pending", "total_count": 0}`, `[{"status": "completed", "conclusion": "timed_out"}, {"status": "queued"}]`, "failure"},
+		{`{"state": "success", "total_count": 1}`, `[]`, "success"},
+		{`{"state": "success", "total_count": 1}`, `[{"status": "in_progress"}]`, "pending"},
+		{`{"state": "failure", "total_count": 1}`, `[{"status": "completed", "conclusion": "neutral"}]`, "failure"},
+	}
+	for _, c := range cases {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/repos/o/r/commits/main/status", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, c.status)
+		})
+		mux.HandleFunc("/repos/o/r/commits/main/check-runs", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"check_runs": %s}`, c.checkRuns)
+		})
+		server := httptest.NewServer(mux)
+
+		client := github.NewClient(nil)
+		client.BaseURL, _ = url.Parse(server.URL + "/")
+
+		state, err := ciState(&ctx.Context{GitHub: client}, jekyll.NewRepository("o", "r"), "main")
+		assert.NoError(t, err)
+		assert.Equal(t, c.state, state, "status=%s checkRuns=%s", c.status, c.checkRuns)
+		server.Close()
+	}
+}
@@ -41,14 +41,15 @@ func LatestRelease(context *ctx.Context, repo jekyll.Repository) (*github.Reposi
 	return nil, fmt.Errorf("%s: couldn't find %s in versions %+v", repo, versions[0], versions)
 }
 
-func CommitsSinceRelease(context *ctx.Context, repo jekyll.Repository, latestRelease *github.RepositoryRelease) (int, error) {
+// CommitsSinceRelease counts the commits on the branch since the release.
+func CommitsSinceRelease(context *ctx.Context, repo jekyll.Repository, latestRelease *github.RepositoryRelease, branch string) (int, error) {
 	comparison, _, err := context.GitHub.Repositories.CompareCommits(
 		context.Context(),
 		repo.Owner(), repo.Name(),
-		latestRelease.GetTagName(), "master",
+		latestRelease.GetTagName(), branch,
 	)
 	if err != nil {
-		return -1, fmt.Errorf("error fetching commit comparison for %s...master for %s: %v", latestRelease.GetTagName(), repo, err)
+		return -1, fmt.Errorf("error fetching commit comparison for %s...%s for %s: %v", latestRelease.GetTagName(), branch, repo, err)
 	}
 
 	return comparison.GetTotalCommits(), nil